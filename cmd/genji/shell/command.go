@@ -1,7 +1,9 @@
 package shell
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/asdine/genji"
 )
@@ -24,3 +26,22 @@ func runTablesCmd(db *genji.DB) error {
 
 	return nil
 }
+
+// runReIndexCmd rebuilds indexes. Without arguments, it rebuilds all the indexes of the database.
+// It accepts either the name of an index or "table" followed by the name of a table,
+// to rebuild all the indexes of that table.
+func runReIndexCmd(db *genji.DB, args []string) error {
+	q := "REINDEX"
+
+	switch {
+	case len(args) == 0:
+	case len(args) == 1:
+		q += " `" + args[0] + "`"
+	case len(args) == 2 && strings.EqualFold(args[0], "table"):
+		q += " TABLE `" + args[1] + "`"
+	default:
+		return errors.New("usage: .reindex [index_name | table table_name]")
+	}
+
+	return db.Exec(q)
+}
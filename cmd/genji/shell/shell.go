@@ -209,7 +209,10 @@ func (sh *Shell) executeInput(in string) error {
 	return nil
 }
 
-func (sh *Shell) runCommand(cmd string) error {
+func (sh *Shell) runCommand(in string) error {
+	args := strings.Fields(in)
+	cmd, args := args[0], args[1:]
+
 	switch cmd {
 	case ".tables":
 		db, err := sh.getDB()
@@ -217,6 +220,12 @@ func (sh *Shell) runCommand(cmd string) error {
 			return err
 		}
 		return runTablesCmd(db)
+	case ".reindex":
+		db, err := sh.getDB()
+		if err != nil {
+			return err
+		}
+		return runReIndexCmd(db, args)
 	}
 
 	return fmt.Errorf("unknown command %q", cmd)
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"reflect"
+
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/document/encoding"
 	"github.com/asdine/genji/engine"
@@ -9,8 +11,13 @@ import (
 
 // TableConfig holds the configuration of a table
 type TableConfig struct {
-	PrimaryKey       FieldConstraint
+	PrimaryKey FieldConstraint
+	// Paths of the fields of a composite primary key, in order. PrimaryKey is empty if they are set.
+	// Documents are sorted by the value of the first field, then by the value of the second field, and so on.
+	PrimaryKeyPaths  []document.ValuePath
 	FieldConstraints []FieldConstraint
+	// CHECK constraints that every document of the table must satisfy.
+	Checks []CheckConstraint
 
 	LastKey int64
 }
@@ -19,10 +26,125 @@ type TableConfig struct {
 type FieldConstraint struct {
 	Path document.ValuePath
 	Type document.ValueType
+	// If set to true, the field must be present in every document and must not be NULL.
+	NotNull bool
+	// If set to true, a unique index is created on the field with the table.
+	Unique bool
+	// Value of the field in inserted documents that don't contain it.
+	// Its Type is zero if there is no default value.
+	DefaultValue document.Value
+	// Field of another table that the value of the field must refer to.
+	// Its Table is empty if the field doesn't reference any table.
+	References ForeignKey
+}
+
+// HasDefaultValue returns true if the field has a default value.
+func (f FieldConstraint) HasDefaultValue() bool {
+	return f.DefaultValue.Type != 0
+}
+
+// ForeignKey describes a reference from a field to a field of another table,
+// which must be its primary key or be indexed by a unique index.
+type ForeignKey struct {
+	Table string
+	Path  document.ValuePath
+	// Action performed on the referencing documents when the referenced document is deleted.
+	OnDelete ForeignKeyAction
+	// Action performed on the referencing documents when the referenced field is modified.
+	OnUpdate ForeignKeyAction
+}
+
+// ForeignKeyAction is the action performed on the documents referencing a deleted or modified document.
+type ForeignKeyAction uint8
+
+// List of foreign key actions.
+const (
+	// ForeignKeyRestrict prevents referenced documents from being deleted or modified.
+	ForeignKeyRestrict ForeignKeyAction = iota
+	// ForeignKeyCascade deletes the referencing documents, or sets their referencing field
+	// to the new value of the referenced field.
+	ForeignKeyCascade
+	// ForeignKeySetNull sets the referencing fields to NULL.
+	ForeignKeySetNull
+)
+
+// CheckConstraint is a boolean expression that every document of a table must satisfy.
+type CheckConstraint struct {
+	// Name of the constraint, reported by CheckError.
+	Name string
+	// SQL representation of the expression, compiled by Database.ParseCheck.
+	Expr string
 }
 
 type tableConfigStore struct {
 	st engine.Store
+
+	// refs caches the field constraints of all the tables that reference a table.
+	// It is nil until they are read, and reset when they may have changed.
+	refs []reference
+}
+
+// references returns the field constraints of all the tables that reference a table.
+// They are only read from the store once per transaction, unless a table is created,
+// deleted or has its references modified.
+func (t *tableConfigStore) references() ([]reference, error) {
+	if t.refs != nil {
+		return t.refs, nil
+	}
+
+	refs := []reference{}
+	err := t.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		var cfg TableConfig
+		err := document.StructScan(encoding.EncodedDocument(v), &cfg)
+		if err != nil {
+			return err
+		}
+
+		refs = append(refs, tableReferences(string(k), &cfg)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.refs = refs
+	return refs, nil
+}
+
+// tableReferences returns the field constraints of cfg that reference a table.
+func tableReferences(tableName string, cfg *TableConfig) []reference {
+	var refs []reference
+	for _, fc := range append([]FieldConstraint{cfg.PrimaryKey}, cfg.FieldConstraints...) {
+		if fc.References.Table != "" {
+			refs = append(refs, reference{tableName: tableName, fc: fc})
+		}
+	}
+
+	return refs
+}
+
+// resetReferences resets the cache of the references if the references of the table
+// are not the ones of cfg. A nil cfg means that the table is deleted.
+func (t *tableConfigStore) resetReferences(tableName string, cfg *TableConfig) {
+	if t.refs == nil {
+		return
+	}
+
+	var cached []reference
+	for _, ref := range t.refs {
+		if ref.tableName == tableName {
+			cached = append(cached, ref)
+		}
+	}
+
+	var refs []reference
+	if cfg != nil {
+		refs = tableReferences(tableName, cfg)
+	}
+
+	if !reflect.DeepEqual(cached, refs) {
+		t.refs = nil
+	}
 }
 
 func (t *tableConfigStore) Insert(tableName string, cfg TableConfig) error {
@@ -35,6 +157,8 @@ func (t *tableConfigStore) Insert(tableName string, cfg TableConfig) error {
 		return err
 	}
 
+	t.resetReferences(tableName, &cfg)
+
 	doc, err := document.NewFromStruct(cfg)
 	if err != nil {
 		return err
@@ -58,6 +182,8 @@ func (t *tableConfigStore) Replace(tableName string, cfg *TableConfig) error {
 		return err
 	}
 
+	t.resetReferences(tableName, cfg)
+
 	doc, err := document.NewFromStruct(cfg)
 	if err != nil {
 		return err
@@ -96,7 +222,12 @@ func (t *tableConfigStore) Delete(tableName string) error {
 	if err == engine.ErrKeyNotFound {
 		return ErrTableNotFound
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	t.resetReferences(tableName, nil)
+	return nil
 }
 
 // Index of a table field. Contains information about
@@ -107,9 +238,60 @@ type Index struct {
 	IndexName string
 	TableName string
 	Path      document.ValuePath
+	Paths     []document.ValuePath
 	Unique    bool
 }
 
+// Value returns the value to index for the document d, which is the value of the indexed field
+// or NULL if d doesn't contain it.
+// For composite indexes, it returns the values of all the indexed fields, encoded
+// with index.EncodeTuple, as a bytes value.
+func (idx *Index) Value(d document.Document) (document.Value, error) {
+	if len(idx.Paths) == 0 {
+		return getIndexedValue(d, idx.Path), nil
+	}
+
+	values := make([]document.Value, len(idx.Paths))
+	for i, p := range idx.Paths {
+		values[i] = getIndexedValue(d, p)
+	}
+
+	data, err := index.EncodeTuple(values)
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	return document.NewBytesValue(data), nil
+}
+
+func getIndexedValue(d document.Document, p document.ValuePath) document.Value {
+	v, err := p.GetValue(d)
+	if err != nil {
+		return document.NewNullValue()
+	}
+
+	return v
+}
+
+// newIndex returns the index described by opts.
+func newIndex(tx engine.Transaction, opts IndexConfig) *Index {
+	var idx index.Index
+	if opts.Unique {
+		idx = index.NewUniqueIndex(tx, opts.IndexName)
+	} else {
+		idx = index.NewListIndex(tx, opts.IndexName)
+	}
+
+	return &Index{
+		Index:     idx,
+		IndexName: opts.IndexName,
+		TableName: opts.TableName,
+		Path:      opts.Path,
+		Paths:     opts.Paths,
+		Unique:    opts.Unique,
+	}
+}
+
 type indexStore struct {
 	st engine.Store
 }
@@ -137,6 +319,29 @@ func (t *indexStore) Insert(cfg IndexConfig) error {
 	return t.st.Put(key, v)
 }
 
+func (t *indexStore) Replace(cfg IndexConfig) error {
+	key := []byte(cfg.IndexName)
+	_, err := t.st.Get(key)
+	if err == engine.ErrKeyNotFound {
+		return ErrIndexNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	doc, err := document.NewFromStruct(&cfg)
+	if err != nil {
+		return err
+	}
+
+	v, err := encoding.EncodeDocument(doc)
+	if err != nil {
+		return err
+	}
+
+	return t.st.Put(key, v)
+}
+
 func (t *indexStore) Get(indexName string) (*IndexConfig, error) {
 	key := []byte(indexName)
 	v, err := t.st.Get(key)
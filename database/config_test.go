@@ -21,7 +21,7 @@ func TestTableConfigStore(t *testing.T) {
 	st, err := tx.Store("foo")
 	require.NoError(t, err)
 
-	tcs := tableConfigStore{st}
+	tcs := tableConfigStore{st: st}
 
 	cfg := TableConfig{
 		PrimaryKey: FieldConstraint{
@@ -4,20 +4,41 @@ package database
 import (
 	"sync"
 
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/engine"
 )
 
+// DefaultSortMemoryLimit is the default value of Database.SortMemoryLimit.
+const DefaultSortMemoryLimit = 64 << 20
+
 // A Database manages a list of tables in an engine.
 type Database struct {
 	ng engine.Engine
 
+	// SortMemoryLimit is the approximate size in bytes of the documents that ORDER BY clauses
+	// sort in memory. Above this limit, documents are sorted by chunks written to temporary files,
+	// which are then merged. If it is zero or negative, documents are always sorted in memory.
+	SortMemoryLimit int
+	// SortTempDir is the directory of the temporary files used to sort documents.
+	// If it is empty, the default directory for temporary files is used.
+	SortTempDir string
+
+	// ParseCheck compiles the expression of a CHECK constraint.
+	// The genji package sets it to a function using the SQL parser.
+	// If it is nil, documents can't be written to tables with CHECK constraints.
+	ParseCheck func(expr string) (CheckFunc, error)
+
 	mu sync.Mutex
 }
 
+// A CheckFunc reports whether the document d satisfies a CHECK constraint.
+type CheckFunc func(tx *Transaction, d document.Document) (bool, error)
+
 // New initializes the DB using the given engine.
 func New(ng engine.Engine) (*Database, error) {
 	db := Database{
-		ng: ng,
+		ng:              ng,
+		SortMemoryLimit: DefaultSortMemoryLimit,
 	}
 
 	ntx, err := db.ng.Begin(true)
@@ -67,6 +88,7 @@ func (db *Database) Begin(writable bool) (*Transaction, error) {
 		db:       db,
 		Tx:       ntx,
 		writable: writable,
+		checks:   make(map[string]CheckFunc),
 	}
 
 	tx.tcfgStore, err = tx.getTableConfigStore()
@@ -2,6 +2,9 @@ package database
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/asdine/genji/document"
 )
 
 var (
@@ -26,3 +29,27 @@ var (
 	// or if there is a unique index violation.
 	ErrDuplicateDocument = errors.New("duplicate document")
 )
+
+// A CheckError is returned when a document doesn't satisfy a CHECK constraint of its table.
+type CheckError struct {
+	// Name of the failed constraint.
+	Constraint string
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("document violates check constraint %q", e.Constraint)
+}
+
+// A ForeignKeyError is returned when a document references a document that doesn't exist,
+// or when deleting or modifying a document that is still referenced.
+type ForeignKeyError struct {
+	// Table and Path of the referencing field.
+	Table string
+	Path  document.ValuePath
+	// Name of the referenced table.
+	References string
+}
+
+func (e *ForeignKeyError) Error() string {
+	return fmt.Sprintf("foreign key violation: field %q of table %q references table %q", e.Path.String(), e.Table, e.References)
+}
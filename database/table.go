@@ -76,17 +76,8 @@ func (t *Table) generateKey(d document.Document) ([]byte, error) {
 		return nil, err
 	}
 
-	var key []byte
-	if len(cfg.PrimaryKey.Path) != 0 {
-		v, err := cfg.PrimaryKey.Path.GetValue(d)
-		if err == document.ErrFieldNotFound {
-			return nil, fmt.Errorf("missing primary key at path %q", cfg.PrimaryKey.Path)
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		return encoding.EncodeValue(v)
+	if len(cfg.PrimaryKeyPaths) != 0 || len(cfg.PrimaryKey.Path) != 0 {
+		return primaryKey(cfg, d)
 	}
 
 	t.tx.db.mu.Lock()
@@ -98,7 +89,7 @@ func (t *Table) generateKey(d document.Document) ([]byte, error) {
 	}
 
 	cfg.LastKey++
-	key = encoding.EncodeInt64(cfg.LastKey)
+	key := encoding.EncodeInt64(cfg.LastKey)
 	err = t.cfgStore.Replace(t.name, cfg)
 	if err != nil {
 		return nil, err
@@ -107,6 +98,40 @@ func (t *Table) generateKey(d document.Document) ([]byte, error) {
 	return key, nil
 }
 
+// primaryKey returns the key of d encoded from the values of the primary key of cfg,
+// which must have one.
+func primaryKey(cfg *TableConfig, d document.Document) ([]byte, error) {
+	if len(cfg.PrimaryKeyPaths) != 0 {
+		values := make([]document.Value, len(cfg.PrimaryKeyPaths))
+		for i, p := range cfg.PrimaryKeyPaths {
+			var err error
+			values[i], err = p.GetValue(d)
+			if err == document.ErrFieldNotFound {
+				return nil, fmt.Errorf("missing primary key at path %q", p)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return index.EncodeTuple(values)
+	}
+
+	if len(cfg.PrimaryKey.Path) != 0 {
+		v, err := cfg.PrimaryKey.Path.GetValue(d)
+		if err == document.ErrFieldNotFound {
+			return nil, fmt.Errorf("missing primary key at path %q", cfg.PrimaryKey.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return encoding.EncodeValue(v)
+	}
+
+	return nil, errors.New("missing primary key")
+}
+
 func getParentValue(d document.Document, p document.ValuePath) (document.Value, error) {
 	if len(p) == 0 {
 		return document.Value{}, errors.New("empty path")
@@ -123,14 +148,21 @@ func getParentValue(d document.Document, p document.ValuePath) (document.Value,
 // against them. If the types defined by the constraints are different than the ones found in
 // the document, the fields are converted to these types when possible. if the conversion
 // fails, an error is returned.
-func (t *Table) validateConstraints(d document.Document) (document.Document, error) {
+// If setDefaults is true, missing fields that have a default value are added to the document
+// before it is validated.
+func (t *Table) validateConstraints(d document.Document, setDefaults bool) (document.Document, error) {
 	cfg, err := t.Config()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(cfg.FieldConstraints) == 0 && len(cfg.PrimaryKey.Path) == 0 {
-		return d, nil
+	constraints := cfg.FieldConstraints
+	if len(cfg.PrimaryKey.Path) != 0 {
+		constraints = append([]FieldConstraint{cfg.PrimaryKey}, constraints...)
+	}
+
+	if len(constraints) == 0 {
+		return d, t.validateChecks(cfg, d)
 	}
 
 	var fb document.FieldBuffer
@@ -142,21 +174,106 @@ func (t *Table) validateConstraints(d document.Document) (document.Document, err
 		return nil, err
 	}
 
-	if len(cfg.PrimaryKey.Path) != 0 {
-		err = validateConstraint(&fb, cfg.PrimaryKey)
+	for _, fc := range constraints {
+		if setDefaults && fc.HasDefaultValue() {
+			err = setDefaultValue(&fb, fc)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// NULL values are checked before being converted
+		if fc.NotNull {
+			err = validateNotNull(&fb, fc)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = validateConstraint(&fb, fc)
 		if err != nil {
 			return nil, err
 		}
+
+		if fc.References.Table != "" {
+			err = t.validateReference(&fb, fc)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	for _, fc := range cfg.FieldConstraints {
-		err := validateConstraint(&fb, fc)
+	return &fb, t.validateChecks(cfg, &fb)
+}
+
+// validateChecks evaluates the CHECK constraints of the table on the document d
+// and returns a CheckError for the first one it doesn't satisfy.
+func (t *Table) validateChecks(cfg *TableConfig, d document.Document) error {
+	for _, c := range cfg.Checks {
+		check, err := t.tx.compileCheck(c)
 		if err != nil {
-			return nil, err
+			return err
 		}
+
+		ok, err := check(t.tx, d)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &CheckError{Constraint: c.Name}
+		}
+	}
+
+	return nil
+}
+
+// setDefaultValue adds the default value of the constraint to the document
+// if the field is missing. Nothing is added if the parent of the field doesn't exist
+// or is not a document.
+func setDefaultValue(d document.Document, c FieldConstraint) error {
+	parent, err := getParentValue(d, c.Path)
+	if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if parent.Type != document.DocumentValue {
+		return nil
+	}
+
+	// if it's a document, we can assume it's a FieldBuffer
+	buf := parent.V.(*document.FieldBuffer)
+
+	field := c.Path[len(c.Path)-1]
+	_, err = buf.GetByField(field)
+	if err == nil {
+		return nil
+	}
+	if err != document.ErrFieldNotFound {
+		return err
+	}
+
+	buf.Add(field, c.DefaultValue)
+	return nil
+}
+
+// validateNotNull returns an error if the field is missing from the document or is NULL.
+func validateNotNull(d document.Document, c FieldConstraint) error {
+	v, err := c.Path.GetValue(d)
+	if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+		return fmt.Errorf("field %q is required and must be not null", c.Path)
+	}
+	if err != nil {
+		return err
 	}
 
-	return &fb, err
+	if v.Type == document.NullValue {
+		return fmt.Errorf("field %q is required and must be not null", c.Path)
+	}
+
+	return nil
 }
 
 func validateConstraint(d document.Document, c FieldConstraint) error {
@@ -175,9 +292,9 @@ func validateConstraint(d document.Document, c FieldConstraint) error {
 		field := c.Path[len(c.Path)-1]
 
 		v, err := buf.GetByField(field)
-		// if the field is not found we simply skip it,
+		// if the field is not found or is NULL we simply skip it,
 		// if not we convert it and replace it in the buffer
-		if err == nil {
+		if err == nil && v.Type != document.NullValue {
 			v, err = v.ConvertTo(c.Type)
 			if err != nil {
 				return err
@@ -201,9 +318,9 @@ func validateConstraint(d document.Document, c FieldConstraint) error {
 		}
 
 		v, err := buf.GetByIndex(index)
-		// if the field is not found we simply skip it,
+		// if the value is not found or is NULL we simply skip it,
 		// if not we convert it and replace it in the buffer
-		if err == nil {
+		if err == nil && v.Type != document.NullValue {
 			v, err = v.ConvertTo(c.Type)
 			if err != nil {
 				return err
@@ -224,7 +341,7 @@ func validateConstraint(d document.Document, c FieldConstraint) error {
 // in the given document.
 // If no primary key has been selected, a monotonic autoincremented integer key will be generated.
 func (t *Table) Insert(d document.Document) ([]byte, error) {
-	d, err := t.validateConstraints(d)
+	d, err := t.validateConstraints(d, true)
 	if err != nil {
 		return nil, err
 	}
@@ -255,9 +372,9 @@ func (t *Table) Insert(d document.Document) ([]byte, error) {
 	}
 
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		v, err := idx.Value(d)
 		if err != nil {
-			v = document.NewNullValue()
+			return nil, err
 		}
 
 		err = idx.Set(v, key)
@@ -275,19 +392,27 @@ func (t *Table) Insert(d document.Document) ([]byte, error) {
 
 // Delete a document by key.
 // Indexes are automatically updated.
+// If the document is referenced by documents of other tables, they are deleted or modified
+// according to the ON DELETE action of their foreign key, or a ForeignKeyError is returned.
 func (t *Table) Delete(key []byte) error {
 	d, err := t.GetDocument(key)
 	if err != nil {
 		return err
 	}
 
+	// the referencing documents are looked up before d is deleted
+	refs, err := t.referencingKeys(key, d, nil)
+	if err != nil {
+		return err
+	}
+
 	indexes, err := t.Indexes()
 	if err != nil {
 		return err
 	}
 
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		v, err := idx.Value(d)
 		if err != nil {
 			return err
 		}
@@ -298,19 +423,368 @@ func (t *Table) Delete(key []byte) error {
 		}
 	}
 
-	return t.Store.Delete(key)
+	err = t.Store.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	return applyReferences(refs)
+}
+
+// referencingDocuments holds the keys of the documents of a table that reference a deleted or modified document.
+type referencingDocuments struct {
+	table *Table
+	fc    FieldConstraint
+	keys  [][]byte
+	// update is true if the referenced field is modified rather than deleted,
+	// in which case v is its new value.
+	update bool
+	v      document.Value
+}
+
+// applyReferences runs the ON DELETE or the ON UPDATE action of the foreign keys on the referencing documents.
+// The fields of a document referencing the same document through several foreign keys are modified at once,
+// so that its constraints are only validated once all of its references are up to date.
+func applyReferences(refs []*referencingDocuments) error {
+	var changes []*referencingChange
+	byKey := make(map[string]*referencingChange)
+
+	for _, r := range refs {
+		action := r.fc.References.OnDelete
+		if r.update {
+			action = r.fc.References.OnUpdate
+		}
+
+		for _, key := range r.keys {
+			var v document.Value
+
+			switch {
+			case action == ForeignKeyCascade && r.update:
+				v = r.v
+			case action == ForeignKeyCascade:
+				err := r.table.Delete(key)
+				// the document may have been deleted by another cascade
+				if err != nil && err != ErrDocumentNotFound {
+					return err
+				}
+				continue
+			case action == ForeignKeySetNull:
+				v = document.NewNullValue()
+			default:
+				continue
+			}
+
+			id := r.table.name + "/" + string(key)
+			c, ok := byKey[id]
+			if !ok {
+				c = &referencingChange{table: r.table, key: key}
+				byKey[id] = c
+				changes = append(changes, c)
+			}
+			c.paths = append(c.paths, r.fc.Path)
+			c.values = append(c.values, v)
+		}
+	}
+
+	for _, c := range changes {
+		err := c.apply()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referencingChange holds the new values of the referencing fields of a document.
+type referencingChange struct {
+	table  *Table
+	key    []byte
+	paths  []document.ValuePath
+	values []document.Value
+}
+
+// apply replaces the referencing fields of the document with their new values.
+func (c *referencingChange) apply() error {
+	d, err := c.table.GetDocument(c.key)
+	if err == ErrDocumentNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var fb document.FieldBuffer
+	err = fb.Copy(d)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range c.paths {
+		parent, err := getParentValue(&fb, path)
+		if err != nil {
+			return err
+		}
+
+		switch parent.Type {
+		case document.DocumentValue:
+			err = parent.V.(*document.FieldBuffer).Replace(path[len(path)-1], c.values[i])
+		case document.ArrayValue:
+			var idx int
+			idx, err = strconv.Atoi(path[len(path)-1])
+			if err == nil {
+				err = parent.V.(*document.ValueBuffer).Replace(idx, c.values[i])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.table.Replace(c.key, &fb)
+}
+
+// referencingKeys returns the keys of the documents referencing the document d, grouped by foreign key.
+// If nd is not nil, d is about to be replaced by nd and only the foreign keys whose referenced value
+// changes are considered. If one of the documents can't be deleted or modified because its foreign key
+// restricts it, a ForeignKeyError is returned.
+func (t *Table) referencingKeys(key []byte, d, nd document.Document) ([]*referencingDocuments, error) {
+	refs, err := t.tx.referencesTo(t.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*referencingDocuments
+	for _, ref := range refs {
+		v, err := ref.fc.References.Path.GetValue(d)
+		if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v.Type == document.NullValue {
+			continue
+		}
+
+		r := referencingDocuments{fc: ref.fc, update: nd != nil}
+		action := ref.fc.References.OnDelete
+		if r.update {
+			action = ref.fc.References.OnUpdate
+
+			r.v, err = ref.fc.References.Path.GetValue(nd)
+			if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+				r.v, err = document.NewNullValue(), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := v.IsEqual(r.v)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
+		}
+
+		r.table, err = t.tx.GetTable(ref.tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.table.lookupKeys(ref.fc.Path, v, func(k []byte) error {
+			// a document referencing itself doesn't prevent its deletion or modification
+			if ref.tableName == t.name && bytes.Equal(k, key) {
+				return nil
+			}
+
+			r.keys = append(r.keys, append([]byte(nil), k...))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(r.keys) == 0 {
+			continue
+		}
+
+		if action == ForeignKeyRestrict {
+			return nil, &ForeignKeyError{Table: ref.tableName, Path: ref.fc.Path, References: t.name}
+		}
+
+		list = append(list, &r)
+	}
+
+	return list, nil
+}
+
+// errStopLookup is used to stop a lookup once a document has been found.
+var errStopLookup = errors.New("stop lookup")
+
+// lookupKeys calls fn with the key of every document whose field at path p is equal to v.
+// p must be the primary key of the table or be indexed.
+func (t *Table) lookupKeys(p document.ValuePath, v document.Value, fn func(key []byte) error) error {
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+
+	indexes, err := t.Indexes()
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.PrimaryKey.Path) != 0 && cfg.PrimaryKey.Path.String() == p.String() {
+		var key []byte
+		var ok bool
+		key, ok, err = encodePrimaryKey(cfg.PrimaryKey, v)
+		if err != nil || !ok {
+			return err
+		}
+
+		_, err = t.Store.Get(key)
+		if err == engine.ErrKeyNotFound {
+			return nil
+		}
+		if err == nil {
+			err = fn(key)
+		}
+	} else if idx, ok := indexes[p.String()]; ok {
+		err = idx.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
+			ok, err := v.IsEqual(val)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errStopLookup
+			}
+
+			return fn(key)
+		})
+	} else {
+		return errors.Errorf("field %q of table %q is not indexed", p.String(), t.name)
+	}
+	if err == errStopLookup {
+		err = nil
+	}
+
+	return err
+}
+
+// encodePrimaryKey returns the key of the document whose primary key is v.
+// It returns false if v can't be converted to the type of the primary key without losing information.
+func encodePrimaryKey(pk FieldConstraint, v document.Value) ([]byte, bool, error) {
+	if v.Type.IsNumber() && pk.Type.IsNumber() {
+		c, err := v.ConvertTo(pk.Type)
+		if err != nil {
+			return nil, false, nil
+		}
+
+		ok, err := c.IsEqual(v)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		v = c
+	}
+
+	key, err := encoding.EncodeValue(v)
+	return key, true, err
+}
+
+// validateReference returns a ForeignKeyError if the value of the field of d constrained by fc
+// doesn't refer to a document of the referenced table. Missing fields and NULL values are not checked.
+func (t *Table) validateReference(d document.Document, fc FieldConstraint) error {
+	v, err := fc.Path.GetValue(d)
+	if err == document.ErrFieldNotFound || err == document.ErrValueNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if v.Type == document.NullValue {
+		return nil
+	}
+
+	tb, err := t.tx.GetTable(fc.References.Table)
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	err = tb.lookupKeys(fc.References.Path, v, func(key []byte) error {
+		found = true
+		return errStopLookup
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return &ForeignKeyError{Table: t.name, Path: fc.Path, References: fc.References.Table}
+	}
+
+	return nil
 }
 
 // Replace a document by key.
-// An error is returned if the key doesn't exist.
+// An error is returned if the key doesn't exist or if the document
+// doesn't satisfy the constraints of the table.
+// If the primary key of the document is modified, the document is moved to its new key,
+// and ErrDuplicateDocument is returned if that key is used by another document.
 // Indexes are automatically updated.
+// If a field referenced by documents of other tables is modified, they are modified
+// according to the ON UPDATE action of their foreign key, or a ForeignKeyError is returned.
 func (t *Table) Replace(key []byte, d document.Document) error {
+	d, err := t.validateConstraints(d, false)
+	if err != nil {
+		return err
+	}
+
+	old, err := t.GetDocument(key)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return err
+	}
+
+	newKey := key
+	if len(cfg.PrimaryKeyPaths) != 0 || len(cfg.PrimaryKey.Path) != 0 {
+		newKey, err = primaryKey(cfg, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the referencing documents are looked up before the referenced fields are modified
+	refs, err := t.referencingKeys(key, old, d)
+	if err != nil {
+		return err
+	}
+
 	indexes, err := t.Indexes()
 	if err != nil {
 		return err
 	}
 
-	return t.replace(indexes, key, d)
+	// the document is moved before the referencing documents are modified
+	// to refer to its new primary key
+	if bytes.Equal(newKey, key) {
+		err = t.replace(indexes, key, d)
+	} else {
+		err = t.move(indexes, key, newKey, old, d)
+	}
+	if err != nil {
+		return err
+	}
+
+	return applyReferences(refs)
 }
 
 func (t *Table) replace(indexes map[string]Index, key []byte, d document.Document) error {
@@ -322,7 +796,7 @@ func (t *Table) replace(indexes map[string]Index, key []byte, d document.Documen
 
 	// remove key from indexes
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(old)
+		v, err := idx.Value(old)
 		if err != nil {
 			return err
 		}
@@ -347,13 +821,17 @@ func (t *Table) replace(indexes map[string]Index, key []byte, d document.Documen
 
 	// update indexes
 	for _, idx := range indexes {
-		v, err := idx.Path.GetValue(d)
+		v, err := idx.Value(d)
 		if err != nil {
-			continue
+			return err
 		}
 
 		err = idx.Set(v, key)
 		if err != nil {
+			if err == index.ErrDuplicate {
+				return ErrDuplicateDocument
+			}
+
 			return err
 		}
 	}
@@ -361,6 +839,62 @@ func (t *Table) replace(indexes map[string]Index, key []byte, d document.Documen
 	return err
 }
 
+// move deletes the document old stored under key and stores d under newKey.
+func (t *Table) move(indexes map[string]Index, key, newKey []byte, old, d document.Document) error {
+	_, err := t.Store.Get(newKey)
+	if err == nil {
+		return ErrDuplicateDocument
+	}
+	if err != engine.ErrKeyNotFound {
+		return err
+	}
+
+	for _, idx := range indexes {
+		v, err := idx.Value(old)
+		if err != nil {
+			return err
+		}
+
+		err = idx.Delete(v, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = t.Store.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	v, err := encoding.EncodeDocument(d)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode document")
+	}
+
+	err = t.Store.Put(newKey, v)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indexes {
+		v, err := idx.Value(d)
+		if err != nil {
+			return err
+		}
+
+		err = idx.Set(v, newKey)
+		if err != nil {
+			if err == index.ErrDuplicate {
+				return ErrDuplicateDocument
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Truncate deletes all the documents from the table.
 func (t *Table) Truncate() error {
 	return t.Store.Truncate()
@@ -371,7 +905,8 @@ func (t *Table) TableName() string {
 	return t.name
 }
 
-// Indexes returns a map of all the indexes of a table.
+// Indexes returns a map of all the indexes of a table, keyed by the path of the indexed field.
+// Composite indexes are keyed by the comma separated list of their paths.
 func (t *Table) Indexes() (map[string]Index, error) {
 	s, err := t.tx.Tx.Store(indexStoreName)
 	if err != nil {
@@ -408,20 +943,7 @@ func (t *Table) Indexes() (map[string]Index, error) {
 				return err
 			}
 
-			var idx index.Index
-			if opts.Unique {
-				idx = index.NewUniqueIndex(t.tx.Tx, opts.IndexName)
-			} else {
-				idx = index.NewListIndex(t.tx.Tx, opts.IndexName)
-			}
-
-			indexes[opts.Path.String()] = Index{
-				Index:     idx,
-				IndexName: opts.IndexName,
-				TableName: opts.TableName,
-				Path:      opts.Path,
-				Unique:    opts.Unique,
-			}
+			indexes[opts.String()] = *newIndex(t.tx.Tx, opts)
 
 			return nil
 		})
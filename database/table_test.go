@@ -268,8 +268,8 @@ func TestTableInsert(t *testing.T) {
 
 		err := tx.CreateTable("test", &database.TableConfig{
 			FieldConstraints: []database.FieldConstraint{
-				{[]string{"foo"}, document.Int32Value},
-				{[]string{"bar"}, document.Uint8Value},
+				{Path: []string{"foo"}, Type: document.Int32Value},
+				{Path: []string{"bar"}, Type: document.Uint8Value},
 			},
 		})
 		require.NoError(t, err)
@@ -298,6 +298,151 @@ func TestTableInsert(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, document.NewStringValue("baaaaz"), v)
 	})
+
+	t.Run("Should not convert NULL values if FieldsConstraints are specified", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"foo"}, Type: document.Int64Value},
+				{Path: []string{"bar"}, Type: document.ArrayValue},
+				{Path: []string{"bar", "0"}, Type: document.StringValue},
+			},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		doc := document.NewFieldBuffer().
+			Add("foo", document.NewNullValue()).
+			Add("bar", document.NewArrayValue(document.NewValueBuffer(document.NewNullValue())))
+
+		key, err := tb.Insert(doc)
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewNullValue(), v)
+		v, err = document.NewValuePath("bar.0").GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewNullValue(), v)
+	})
+
+	t.Run("Should set default values and check NOT NULL constraints", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"foo"}, Type: document.Int32Value, NotNull: true, DefaultValue: document.NewInt8Value(10)},
+				{Path: []string{"bar"}, Type: document.StringValue, NotNull: true},
+				{Path: []string{"baz", "a"}, Type: document.StringValue, DefaultValue: document.NewStringValue("a")},
+			},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		// missing NOT NULL field
+		_, err = tb.Insert(document.NewFieldBuffer().Add("foo", document.NewIntValue(1)))
+		require.Error(t, err)
+
+		// NULL NOT NULL field
+		_, err = tb.Insert(document.NewFieldBuffer().Add("bar", document.NewNullValue()))
+		require.Error(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().
+			Add("bar", document.NewStringValue("bar")).
+			Add("baz", document.NewDocumentValue(document.NewFieldBuffer())))
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt32Value(10), v)
+		v, err = document.NewValuePath("baz.a").GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("a"), v)
+	})
+}
+
+func TestTableCheck(t *testing.T) {
+	// the check only accepts documents with a "valid" field set to true
+	parseCheck := func(expr string) (database.CheckFunc, error) {
+		return func(tx *database.Transaction, d document.Document) (bool, error) {
+			v, err := d.GetByField(expr)
+			if err != nil {
+				return false, nil
+			}
+			return v.IsTruthy(), nil
+		}, nil
+	}
+
+	t.Run("Should validate documents on insert and replace", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+		tx.DB().ParseCheck = parseCheck
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			Checks: []database.CheckConstraint{{Expr: "valid"}},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		_, err = tb.Insert(document.NewFieldBuffer().Add("valid", document.NewBoolValue(false)))
+		require.Equal(t, &database.CheckError{Constraint: "test_check_1"}, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("valid", document.NewBoolValue(true)))
+		require.NoError(t, err)
+
+		err = tb.Replace(key, document.NewFieldBuffer())
+		require.Equal(t, &database.CheckError{Constraint: "test_check_1"}, err)
+	})
+
+	t.Run("Should compile each check once per transaction", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		var calls int
+		tx.DB().ParseCheck = func(expr string) (database.CheckFunc, error) {
+			calls++
+			return parseCheck(expr)
+		}
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			Checks: []database.CheckConstraint{{Expr: "valid"}},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		calls = 0
+		for i := 0; i < 3; i++ {
+			_, err = tb.Insert(document.NewFieldBuffer().Add("valid", document.NewBoolValue(true)))
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("Should fail without ParseCheck", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			Checks: []database.CheckConstraint{{Name: "foo", Expr: "valid"}},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		_, err = tb.Insert(document.NewFieldBuffer().Add("valid", document.NewBoolValue(true)))
+		require.Error(t, err)
+	})
 }
 
 // TestTableDelete verifies Delete behaviour.
@@ -388,6 +533,72 @@ func TestTableReplace(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, "c", string(f.V.([]byte)))
 	})
+
+	t.Run("Should validate the constraints", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"foo"}, Type: document.Int32Value, NotNull: true},
+			},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("foo", document.NewInt32Value(1)))
+		require.NoError(t, err)
+
+		err = tb.Replace(key, document.NewFieldBuffer().Add("foo", document.NewNullValue()))
+		require.Error(t, err)
+
+		err = tb.Replace(key, document.NewFieldBuffer().Add("foo", document.NewFloat64Value(2)))
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt32Value(2), v)
+	})
+	t.Run("Should move the document if its primary key is modified", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			PrimaryKey: database.FieldConstraint{Path: []string{"foo"}, Type: document.Int32Value},
+		})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key1, err := tb.Insert(document.NewFieldBuffer().Add("foo", document.NewInt32Value(1)))
+		require.NoError(t, err)
+		key2, err := tb.Insert(document.NewFieldBuffer().Add("foo", document.NewInt32Value(2)))
+		require.NoError(t, err)
+
+		// the new key is used by another document
+		err = tb.Replace(key1, document.NewFieldBuffer().Add("foo", document.NewInt32Value(2)))
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = tb.Replace(key1, document.NewFieldBuffer().Add("foo", document.NewInt32Value(3)))
+		require.NoError(t, err)
+
+		_, err = tb.GetDocument(key1)
+		require.Equal(t, database.ErrDocumentNotFound, err)
+
+		_, err = tb.GetDocument(key2)
+		require.NoError(t, err)
+
+		key3, err := encoding.EncodeValue(document.NewInt32Value(3))
+		require.NoError(t, err)
+		d, err := tb.GetDocument(key3)
+		require.NoError(t, err)
+		v, err := d.GetByField("foo")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt32Value(3), v)
+	})
 }
 
 // TestTableTruncate verifies Truncate behaviour.
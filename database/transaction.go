@@ -1,6 +1,8 @@
 package database
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
 
 	"github.com/asdine/genji/document"
@@ -25,6 +27,13 @@ type Transaction struct {
 	writable   bool
 	tcfgStore  *tableConfigStore
 	indexStore *indexStore
+	// checks contains the CHECK constraints compiled during the transaction, by expression.
+	checks map[string]CheckFunc
+}
+
+// DB returns the database the transaction was started from.
+func (tx *Transaction) DB() *Database {
+	return tx.db
 }
 
 // Rollback the transaction. Can be used safely after commit.
@@ -69,7 +78,43 @@ func (tx Transaction) CreateTable(name string, cfg *TableConfig) error {
 	if cfg == nil {
 		cfg = new(TableConfig)
 	}
-	err := tx.tcfgStore.Insert(name, *cfg)
+	// the configuration of the caller is not modified
+	cfg = &TableConfig{
+		PrimaryKey:       cfg.PrimaryKey,
+		PrimaryKeyPaths:  cfg.PrimaryKeyPaths,
+		FieldConstraints: cfg.FieldConstraints,
+		Checks:           cfg.Checks,
+		LastKey:          cfg.LastKey,
+	}
+
+	// default values are stored with the type of their field
+	// so that they are not converted on every insertion
+	constraints := append([]FieldConstraint{cfg.PrimaryKey}, cfg.FieldConstraints...)
+	for i, fc := range constraints {
+		if !fc.HasDefaultValue() || fc.DefaultValue.Type == fc.Type {
+			continue
+		}
+
+		v, err := fc.DefaultValue.ConvertTo(fc.Type)
+		if err != nil {
+			return errors.Wrapf(err, "invalid default value for field %q", fc.Path.String())
+		}
+		constraints[i].DefaultValue = v
+	}
+	cfg.PrimaryKey = constraints[0]
+	cfg.FieldConstraints = constraints[1:]
+
+	err := tx.validateChecks(name, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = tx.validateReferences(name, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Insert(name, *cfg)
 	if err != nil {
 		return err
 	}
@@ -79,9 +124,162 @@ func (tx Transaction) CreateTable(name string, cfg *TableConfig) error {
 		return errors.Wrapf(err, "failed to create table %q", name)
 	}
 
+	// UNIQUE fields are indexed to enforce the constraint, and fields referencing another table
+	// to look up the documents referencing a document when it is deleted or modified
+	for _, fc := range cfg.FieldConstraints {
+		if !fc.Unique && fc.References.Table == "" {
+			continue
+		}
+
+		err = tx.CreateIndex(IndexConfig{
+			IndexName: autoIndexName(name, fc.Path),
+			TableName: name,
+			Path:      fc.Path,
+			Unique:    fc.Unique,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// validateChecks names the CHECK constraints of cfg that don't have a name
+// and makes sure they have distinct names and valid expressions.
+func (tx Transaction) validateChecks(tableName string, cfg *TableConfig) error {
+	if len(cfg.Checks) == 0 {
+		return nil
+	}
+
+	checks := make([]CheckConstraint, len(cfg.Checks))
+	for i, c := range cfg.Checks {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("%s_check_%d", tableName, i+1)
+		}
+
+		for _, other := range checks[:i] {
+			if other.Name == c.Name {
+				return errors.Errorf("duplicate check constraint %q", c.Name)
+			}
+		}
+
+		if tx.db.ParseCheck != nil {
+			_, err := tx.db.ParseCheck(c.Expr)
+			if err != nil {
+				return errors.Wrapf(err, "invalid check constraint %q", c.Name)
+			}
+		}
+
+		checks[i] = c
+	}
+
+	cfg.Checks = checks
+	return nil
+}
+
+// compileCheck returns the compiled expression of the CHECK constraint c.
+// Expressions are compiled once per transaction.
+func (tx *Transaction) compileCheck(c CheckConstraint) (CheckFunc, error) {
+	if check, ok := tx.checks[c.Expr]; ok {
+		return check, nil
+	}
+
+	if tx.db.ParseCheck == nil {
+		return nil, errors.New("cannot evaluate CHECK constraints without a parser")
+	}
+
+	check, err := tx.db.ParseCheck(c.Expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid check constraint %q", c.Name)
+	}
+
+	if tx.checks == nil {
+		tx.checks = make(map[string]CheckFunc)
+	}
+	tx.checks[c.Expr] = check
+
+	return check, nil
+}
+
+// validateReferences makes sure the fields referenced by the foreign keys of cfg
+// are primary keys or are indexed by unique indexes.
+func (tx Transaction) validateReferences(tableName string, cfg *TableConfig) error {
+	for _, fc := range append([]FieldConstraint{cfg.PrimaryKey}, cfg.FieldConstraints...) {
+		fk := fc.References
+		if fk.Table == "" {
+			continue
+		}
+
+		var unique bool
+		if fk.Table == tableName {
+			// a table referencing itself can reference a field with a UNIQUE constraint,
+			// whose index is not created yet
+			unique = cfg.PrimaryKey.Path.String() == fk.Path.String()
+			for _, c := range cfg.FieldConstraints {
+				unique = unique || (c.Unique && c.Path.String() == fk.Path.String())
+			}
+		} else {
+			tb, err := tx.GetTable(fk.Table)
+			if err != nil {
+				return errors.Wrapf(err, "invalid reference of field %q", fc.Path.String())
+			}
+
+			refCfg, err := tb.Config()
+			if err != nil {
+				return err
+			}
+
+			indexes, err := tb.Indexes()
+			if err != nil {
+				return err
+			}
+
+			idx, ok := indexes[fk.Path.String()]
+			unique = (ok && idx.Unique) ||
+				(len(refCfg.PrimaryKey.Path) != 0 && refCfg.PrimaryKey.Path.String() == fk.Path.String())
+		}
+
+		if !unique {
+			return errors.Errorf("field %q of table %q must be a primary key or have a unique index to be referenced", fk.Path.String(), fk.Table)
+		}
+	}
+
+	return nil
+}
+
+// reference is a field constraint of a table that references another table.
+type reference struct {
+	tableName string
+	fc        FieldConstraint
+}
+
+// referencesTo returns the field constraints of all the tables, including the given table,
+// that reference the given table.
+func (tx Transaction) referencesTo(tableName string) ([]reference, error) {
+	all, err := tx.tcfgStore.references()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []reference
+	for _, ref := range all {
+		if ref.fc.References.Table == tableName {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// autoIndexPrefix is the prefix of the names of the indexes created for UNIQUE constraints and foreign keys.
+const autoIndexPrefix = "__genji_autoindex_"
+
+// autoIndexName returns the name of the index created for a UNIQUE constraint or a foreign key on the given path.
+func autoIndexName(tableName string, path document.ValuePath) string {
+	return autoIndexPrefix + tableName + "_" + path.String()
+}
+
 // GetTable returns a table by name. The table instance is only valid for the lifetime of the transaction.
 func (tx Transaction) GetTable(name string) (*Table, error) {
 	_, err := tx.tcfgStore.Get(name)
@@ -103,8 +301,20 @@ func (tx Transaction) GetTable(name string) (*Table, error) {
 }
 
 // DropTable deletes a table from the database.
+// It fails if the table is referenced by the foreign keys of another table.
 func (tx Transaction) DropTable(name string) error {
-	err := tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+	refs, err := tx.referencesTo(name)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.tableName != name {
+			return errors.Errorf("table %q is referenced by table %q", name, ref.tableName)
+		}
+	}
+
+	err = tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
 		var opts IndexConfig
 		err := document.StructScan(encoding.EncodedDocument(v), &opts)
 		if err != nil {
@@ -125,6 +335,577 @@ func (tx Transaction) DropTable(name string) error {
 	return tx.Tx.DropStore(name)
 }
 
+// RenameTable changes the name of a table. Its documents are moved to a store
+// named after the new name and its indexes are updated to refer to the new name.
+// If a table with the new name already exists, returns ErrTableAlreadyExists.
+func (tx Transaction) RenameTable(oldName, newName string) error {
+	cfg, err := tx.tcfgStore.Get(oldName)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Insert(newName, *cfg)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Delete(oldName)
+	if err != nil {
+		return err
+	}
+
+	src, err := tx.Tx.Store(oldName)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Tx.CreateStore(newName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create table %q", newName)
+	}
+
+	dst, err := tx.Tx.Store(newName)
+	if err != nil {
+		return err
+	}
+
+	err = copyStore(src, dst, nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Tx.DropStore(oldName)
+	if err != nil {
+		return err
+	}
+
+	// the index store can't be modified while iterating on it
+	var indexes []IndexConfig
+	err = tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		var opts IndexConfig
+		err := document.StructScan(encoding.EncodedDocument(v), &opts)
+		if err != nil {
+			return err
+		}
+
+		if opts.TableName == oldName {
+			indexes = append(indexes, opts)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, opts := range indexes {
+		// the indexes created for UNIQUE constraints and foreign keys are named after their table
+		if opts.IndexName == autoIndexName(oldName, opts.Path) {
+			err = tx.DropIndex(opts.IndexName)
+			if err != nil {
+				return err
+			}
+
+			opts.IndexName = autoIndexName(newName, opts.Path)
+			opts.TableName = newName
+			err = tx.CreateIndex(opts)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		opts.TableName = newName
+		err = tx.indexStore.Replace(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.renameReferences(oldName, newName)
+}
+
+// renameReferences updates the foreign keys referencing the table oldName to reference newName.
+func (tx Transaction) renameReferences(oldName, newName string) error {
+	refs, err := tx.referencesTo(oldName)
+	if err != nil {
+		return err
+	}
+
+	// a table may have several foreign keys referencing the renamed table
+	updated := make(map[string]bool)
+	for _, ref := range refs {
+		if updated[ref.tableName] {
+			continue
+		}
+		updated[ref.tableName] = true
+
+		cfg, err := tx.tcfgStore.Get(ref.tableName)
+		if err != nil {
+			return err
+		}
+
+		if cfg.PrimaryKey.References.Table == oldName {
+			cfg.PrimaryKey.References.Table = newName
+		}
+		for i := range cfg.FieldConstraints {
+			if cfg.FieldConstraints[i].References.Table == oldName {
+				cfg.FieldConstraints[i].References.Table = newName
+			}
+		}
+
+		err = tx.tcfgStore.Replace(ref.tableName, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyBatchSize is the number of key-value pairs copied at once by copyStore.
+const copyBatchSize = 100
+
+var errBatchFull = errors.New("batch full")
+
+// copyStore copies all the key-value pairs of src to dst. If rekey is not nil, each value
+// is stored under the key returned by rekey instead of its key in src.
+// Pairs are read by batches of copyBatchSize and written after each batch,
+// since some engines can't write while iterating.
+func copyStore(src, dst engine.Store, rekey func(k, v []byte) ([]byte, error)) error {
+	var pivot []byte
+
+	for {
+		var keys, values [][]byte
+
+		err := src.AscendGreaterOrEqual(pivot, func(k, v []byte) error {
+			// the pivot was copied with the previous batch
+			if pivot != nil && bytes.Equal(k, pivot) {
+				return nil
+			}
+
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+			if len(keys) == copyBatchSize {
+				return errBatchFull
+			}
+			return nil
+		})
+		if err != nil && err != errBatchFull {
+			return err
+		}
+
+		for i := range keys {
+			k := keys[i]
+			if rekey != nil {
+				k, err = rekey(k, values[i])
+				if err != nil {
+					return err
+				}
+			}
+
+			err = dst.Put(k, values[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < copyBatchSize {
+			return nil
+		}
+
+		pivot = keys[len(keys)-1]
+	}
+}
+
+// AddFieldConstraint adds a field constraint to the configuration of a table.
+// The documents already stored in the table must satisfy it: the documents that don't contain the field
+// receive its default value, if any, and the values of the field are converted to the type of the constraint.
+// If one of them doesn't satisfy the constraint, an error is returned and the table is left unchanged.
+// As with CreateTable, UNIQUE fields and fields referencing another table are indexed.
+func (tx Transaction) AddFieldConstraint(tableName string, fc FieldConstraint) error {
+	tb, err := tx.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := tb.Config()
+	if err != nil {
+		return err
+	}
+
+	if cfg.PrimaryKey.Path.String() == fc.Path.String() {
+		return errors.Errorf("field %q already has a constraint", fc.Path.String())
+	}
+
+	for _, c := range cfg.FieldConstraints {
+		if c.Path.String() == fc.Path.String() {
+			return errors.Errorf("field %q already has a constraint", fc.Path.String())
+		}
+	}
+
+	if fc.HasDefaultValue() && fc.DefaultValue.Type != fc.Type {
+		fc.DefaultValue, err = fc.DefaultValue.ConvertTo(fc.Type)
+		if err != nil {
+			return errors.Wrapf(err, "invalid default value for field %q", fc.Path.String())
+		}
+	}
+
+	cfg.FieldConstraints = append(cfg.FieldConstraints, fc)
+
+	err = tx.validateReferences(tableName, cfg)
+	if err != nil {
+		return err
+	}
+
+	// the documents are modified without updating the index of the constraint,
+	// which is built while they are validated
+	indexes, err := tb.Indexes()
+	if err != nil {
+		return err
+	}
+
+	var idx *Index
+	if fc.Unique || fc.References.Table != "" {
+		opts := IndexConfig{
+			IndexName: autoIndexName(tableName, fc.Path),
+			TableName: tableName,
+			Path:      fc.Path,
+			Unique:    fc.Unique,
+		}
+		err = tx.indexStore.Insert(opts)
+		if err != nil {
+			return err
+		}
+
+		idx = newIndex(tx.Tx, opts)
+	}
+
+	keys, err := tx.validateFieldConstraint(tb, cfg, fc, idx)
+	if err != nil {
+		if idx != nil {
+			if derr := tx.DropIndex(idx.IndexName); derr != nil {
+				return derr
+			}
+		}
+		return err
+	}
+
+	for _, key := range keys {
+		d, err := tb.GetDocument(key)
+		if err != nil {
+			return err
+		}
+
+		fb, err := applyFieldConstraint(d, fc)
+		if err != nil {
+			return err
+		}
+
+		err = tb.replace(indexes, key, fb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.tcfgStore.Replace(tableName, cfg)
+}
+
+// validateFieldConstraint checks that every document of the table satisfies the field constraint fc
+// and the CHECK constraints of cfg once fc is applied, and adds the documents to idx if it is not nil.
+// It returns the keys of the documents modified by fc.
+func (tx Transaction) validateFieldConstraint(tb *Table, cfg *TableConfig, fc FieldConstraint, idx *Index) ([][]byte, error) {
+	var keys [][]byte
+	err := tb.Iterate(func(d document.Document) error {
+		key := d.(document.Keyer).Key()
+
+		fb, err := applyFieldConstraint(d, fc)
+		if err != nil {
+			return err
+		}
+
+		if fc.References.Table != "" {
+			err = tb.validateReference(fb, fc)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tb.validateChecks(cfg, fb)
+		if err != nil {
+			return err
+		}
+
+		if idx != nil {
+			v, err := idx.Value(fb)
+			if err != nil {
+				return err
+			}
+
+			err = idx.Set(v, key)
+			if err == index.ErrDuplicate {
+				return duplicateIndexValueError(idx, v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		v, err := fc.Path.GetValue(d)
+		if err == document.ErrFieldNotFound && fc.HasDefaultValue() || err == nil && v.Type != fc.Type {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		return nil
+	})
+
+	return keys, err
+}
+
+// applyFieldConstraint returns a copy of d where the field of fc has its default value if it is missing
+// and is converted to the type of fc. It returns an error if the field is required but missing or NULL,
+// or if it can't be converted.
+func applyFieldConstraint(d document.Document, fc FieldConstraint) (*document.FieldBuffer, error) {
+	var fb document.FieldBuffer
+	err := fb.Copy(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if fc.HasDefaultValue() {
+		err = setDefaultValue(&fb, fc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fc.NotNull {
+		err = validateNotNull(&fb, fc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = validateConstraint(&fb, fc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "field %q", fc.Path.String())
+	}
+
+	return &fb, nil
+}
+
+// DropFieldConstraint removes the constraint on the field at the given path from the configuration of a table.
+// The documents of the table are left unchanged.
+func (tx Transaction) DropFieldConstraint(tableName string, path document.ValuePath) error {
+	cfg, err := tx.tcfgStore.Get(tableName)
+	if err != nil {
+		return err
+	}
+
+	if cfg.PrimaryKey.Path.String() == path.String() {
+		return errors.Errorf("cannot drop the constraint of the primary key %q", path.String())
+	}
+
+	for i, fc := range cfg.FieldConstraints {
+		if fc.Path.String() != path.String() {
+			continue
+		}
+
+		cfg.FieldConstraints = append(cfg.FieldConstraints[:i], cfg.FieldConstraints[i+1:]...)
+		err = tx.tcfgStore.Replace(tableName, cfg)
+		if err != nil {
+			return err
+		}
+
+		if !fc.Unique && fc.References.Table == "" {
+			return nil
+		}
+
+		return tx.dropAutoIndex(tableName, path)
+	}
+
+	return errors.Errorf("field %q has no constraint", path.String())
+}
+
+// dropAutoIndex drops the index created for the UNIQUE constraint or the foreign key on the given path, if any.
+func (tx Transaction) dropAutoIndex(tableName string, path document.ValuePath) error {
+	err := tx.DropIndex(autoIndexName(tableName, path))
+	if err == ErrIndexNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// rekeyStorePrefix is the prefix of the name of the store holding the documents of a table
+// while its primary key is changed.
+const rekeyStorePrefix = "__genji_rekey_"
+
+// SetPrimaryKey replaces the primary key of a table by the fields at the given paths.
+// The documents are stored under the key made of the values of these fields and the indexes
+// of the table are rebuilt. If a document doesn't contain one of the fields, or if two documents
+// have the same values for all of them, an error is returned and the table is left unchanged.
+// If the primary key is a single field with a field constraint, that constraint becomes the constraint
+// of the primary key. The constraint of the former primary key, if any, becomes a field constraint.
+func (tx Transaction) SetPrimaryKey(tableName string, paths []document.ValuePath) error {
+	if len(paths) == 0 {
+		return errors.New("missing primary key")
+	}
+
+	tb, err := tx.GetTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := tb.Config()
+	if err != nil {
+		return err
+	}
+
+	old := cfg.PrimaryKey
+	cfg.PrimaryKey = FieldConstraint{}
+	cfg.PrimaryKeyPaths = paths
+	if len(paths) == 1 && old.Path.String() == paths[0].String() {
+		cfg.PrimaryKey = old
+		cfg.PrimaryKeyPaths = nil
+	}
+
+	var fcs []FieldConstraint
+	for _, fc := range cfg.FieldConstraints {
+		if len(paths) == 1 && fc.Path.String() == paths[0].String() {
+			cfg.PrimaryKey = fc
+			cfg.PrimaryKeyPaths = nil
+			continue
+		}
+		fcs = append(fcs, fc)
+	}
+
+	demoted := len(old.Path) != 0 && old.Path.String() != cfg.PrimaryKey.Path.String()
+	if demoted {
+		fcs = append(fcs, old)
+
+		// the former primary key can only be referenced if it is still unique
+		indexes, err := tb.Indexes()
+		if err != nil {
+			return err
+		}
+
+		idx, ok := indexes[old.Path.String()]
+		if !old.Unique && !(ok && idx.Unique) {
+			refs, err := tx.referencesTo(tableName)
+			if err != nil {
+				return err
+			}
+
+			for _, ref := range refs {
+				if ref.fc.References.Path.String() == old.Path.String() {
+					return errors.Errorf("field %q of table %q is referenced by table %q and must remain the primary key or have a unique index", old.Path.String(), tableName, ref.tableName)
+				}
+			}
+		}
+	}
+	cfg.FieldConstraints = fcs
+
+	err = tx.rekeyTable(tb, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = tx.tcfgStore.Replace(tableName, cfg)
+	if err != nil {
+		return err
+	}
+
+	// the primary key isn't indexed, unlike the other UNIQUE fields and fields referencing another table
+	if demoted && (old.Unique || old.References.Table != "") {
+		name := autoIndexName(tableName, old.Path)
+		_, err = tx.GetIndex(name)
+		if err == ErrIndexNotFound {
+			err = tx.CreateIndex(IndexConfig{
+				IndexName: name,
+				TableName: tableName,
+				Path:      old.Path,
+				Unique:    old.Unique,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// indexes refer to the documents by their key
+	var names []string
+	err = tx.indexStore.st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
+		var opts IndexConfig
+		err := document.StructScan(encoding.EncodedDocument(v), &opts)
+		if err != nil {
+			return err
+		}
+
+		if opts.TableName == tableName {
+			names = append(names, opts.IndexName)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		err = tx.ReIndex(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rekeyTable stores the documents of the table under the keys of the primary key of cfg.
+// They are first copied to a temporary store, so that the table is left unchanged
+// if the key of a document can't be computed or is used by another document.
+func (tx Transaction) rekeyTable(tb *Table, cfg *TableConfig) error {
+	name := rekeyStorePrefix + tb.name
+	err := tx.Tx.CreateStore(name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := tx.Tx.Store(name)
+	if err != nil {
+		return err
+	}
+
+	err = copyStore(tb.Store, tmp, func(k, v []byte) ([]byte, error) {
+		key, err := primaryKey(cfg, encoding.EncodedDocument(v))
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tmp.Get(key)
+		if err == nil {
+			return nil, ErrDuplicateDocument
+		}
+		if err != engine.ErrKeyNotFound {
+			return nil, err
+		}
+
+		return key, nil
+	})
+	if err == nil {
+		err = tb.Store.Truncate()
+	}
+	if err == nil {
+		err = copyStore(tmp, tb.Store, nil)
+	}
+	if err != nil {
+		if derr := tx.Tx.DropStore(name); derr != nil {
+			return derr
+		}
+		return err
+	}
+
+	return tx.Tx.DropStore(name)
+}
+
 // ListTables lists all the tables.
 func (tx Transaction) ListTables() ([]string, error) {
 	stores, err := tx.Tx.ListStores("")
@@ -155,18 +936,41 @@ type IndexConfig struct {
 
 	IndexName string
 	TableName string
-	Path      document.ValuePath
+	// Path of the indexed field. It is empty for composite indexes.
+	Path document.ValuePath
+	// Paths of the fields of a composite index, in order. Documents are sorted by the value
+	// of the first field, then by the value of the second field, and so on.
+	Paths []document.ValuePath
+}
+
+// String returns the list of the indexed fields.
+func (opts IndexConfig) String() string {
+	if len(opts.Paths) == 0 {
+		return opts.Path.String()
+	}
+
+	paths := make([]string, len(opts.Paths))
+	for i, p := range opts.Paths {
+		paths[i] = p.String()
+	}
+
+	return strings.Join(paths, ", ")
 }
 
-// CreateIndex creates an index with the given name.
+// CreateIndex creates an index with the given name and indexes the documents already stored in the table.
 // If it already exists, returns ErrTableAlreadyExists.
 func (tx Transaction) CreateIndex(opts IndexConfig) error {
-	_, err := tx.GetTable(opts.TableName)
+	tb, err := tx.GetTable(opts.TableName)
 	if err != nil {
 		return err
 	}
 
-	return tx.indexStore.Insert(opts)
+	err = tx.indexStore.Insert(opts)
+	if err != nil {
+		return err
+	}
+
+	return buildIndex(newIndex(tx.Tx, opts), tb)
 }
 
 // GetIndex returns an index by name.
@@ -176,20 +980,7 @@ func (tx Transaction) GetIndex(name string) (*Index, error) {
 		return nil, err
 	}
 
-	var idx index.Index
-	if opts.Unique {
-		idx = index.NewUniqueIndex(tx.Tx, opts.IndexName)
-	} else {
-		idx = index.NewListIndex(tx.Tx, opts.IndexName)
-	}
-
-	return &Index{
-		Index:     idx,
-		IndexName: opts.IndexName,
-		TableName: opts.TableName,
-		Path:      opts.Path,
-		Unique:    opts.Unique,
-	}, nil
+	return newIndex(tx.Tx, *opts), nil
 }
 
 // DropIndex deletes an index from the database.
@@ -230,14 +1021,7 @@ func (tx Transaction) ReIndex(indexName string) error {
 		return err
 	}
 
-	return tb.Iterate(func(d document.Document) error {
-		v, err := idx.Path.GetValue(d)
-		if err != nil {
-			return err
-		}
-
-		return idx.Set(v, d.(document.Keyer).Key())
-	})
+	return buildIndex(idx, tb)
 }
 
 // ReIndexAll truncates and recreates all indexes of the database from scratch.
@@ -249,12 +1033,7 @@ func (tx Transaction) ReIndexAll() error {
 			return err
 		}
 
-		var idx index.Index
-		if opts.Unique {
-			idx = index.NewUniqueIndex(tx.Tx, opts.IndexName)
-		} else {
-			idx = index.NewListIndex(tx.Tx, opts.IndexName)
-		}
+		idx := newIndex(tx.Tx, opts)
 
 		tb, err := tx.GetTable(opts.TableName)
 		if err != nil {
@@ -266,17 +1045,46 @@ func (tx Transaction) ReIndexAll() error {
 			return err
 		}
 
-		return tb.Iterate(func(d document.Document) error {
-			v, err := opts.Path.GetValue(d)
-			if err != nil {
-				return err
-			}
+		return buildIndex(idx, tb)
+	})
+}
 
-			return idx.Set(v, d.(document.Keyer).Key())
-		})
+// buildIndex indexes all the documents of the table.
+// If the index is unique and a value is found more than once, it returns an error
+// naming the index and the duplicate value.
+func buildIndex(idx *Index, tb *Table) error {
+	return tb.Iterate(func(d document.Document) error {
+		v, err := idx.Value(d)
+		if err != nil {
+			return err
+		}
+
+		err = idx.Set(v, d.(document.Keyer).Key())
+		if err == index.ErrDuplicate {
+			return duplicateIndexValueError(idx, v)
+		}
+
+		return err
 	})
 }
 
+// duplicateIndexValueError returns an error naming the unique index idx and the value v
+// that is associated with more than one document.
+func duplicateIndexValueError(idx *Index, v document.Value) error {
+	if len(idx.Paths) != 0 {
+		if values, err := index.DecodeTuple(v.V.([]byte)); err == nil {
+			v = document.NewArrayValue(document.NewValueBuffer(values...))
+		}
+	}
+
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ErrDuplicateDocument, "unique index %q: duplicate value %s", idx.IndexName, data)
+}
+
 func (tx *Transaction) getTableConfigStore() (*tableConfigStore, error) {
 	st, err := tx.Tx.Store(tableConfigStoreName)
 	if err != nil {
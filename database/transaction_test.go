@@ -68,6 +68,43 @@ func TestTxCreateIndex(t *testing.T) {
 		require.Equal(t, database.ErrIndexAlreadyExists, err)
 	})
 
+	t.Run("Should index the existing documents", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			_, err = tb.Insert(document.NewFieldBuffer().Add("foo", document.NewIntValue(i%5)))
+			require.NoError(t, err)
+		}
+
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idxFoo", TableName: "test", Path: document.NewValuePath("foo"),
+		})
+		require.NoError(t, err)
+		idx, err := tx.GetIndex("idxFoo")
+		require.NoError(t, err)
+
+		var i int
+		err = idx.AscendGreaterOrEqual(index.EmptyPivot(document.IntValue), func(val document.Value, key []byte) error {
+			i++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10, i)
+
+		// unique indexes can't be created on duplicate values
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idxFooUnique", TableName: "test", Path: document.NewValuePath("foo"), Unique: true,
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unique index "idxFooUnique": duplicate value 0`)
+	})
+
 	t.Run("Should fail if table doesn't exists", func(t *testing.T) {
 		tx, cleanup := newTestDB(t)
 		defer cleanup()
@@ -114,6 +151,30 @@ func TestTxDropTable(t *testing.T) {
 		err := tx.DropTable("foo")
 		require.Equal(t, database.ErrTableNotFound, err)
 	})
+
+	t.Run("Should fail if it is referenced by another table", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("foo", &database.TableConfig{
+			PrimaryKey: database.FieldConstraint{Path: []string{"id"}, Type: document.IntValue},
+		})
+		require.NoError(t, err)
+		err = tx.CreateTable("bar", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"foo"}, Type: document.IntValue, References: database.ForeignKey{Table: "foo", Path: []string{"id"}}},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.DropTable("foo")
+		require.Error(t, err)
+
+		err = tx.DropTable("bar")
+		require.NoError(t, err)
+		err = tx.DropTable("foo")
+		require.NoError(t, err)
+	})
 }
 
 func TestTxDropIndex(t *testing.T) {
@@ -189,6 +250,14 @@ func TestTxReIndex(t *testing.T) {
 		tx, _, cleanup := newTestTableFn(t)
 		defer cleanup()
 
+		// the documents are indexed when the indexes are created
+		for _, name := range []string{"a", "b"} {
+			idx, err := tx.GetIndex(name)
+			require.NoError(t, err)
+			err = idx.Truncate()
+			require.NoError(t, err)
+		}
+
 		err := tx.ReIndex("a")
 		require.NoError(t, err)
 
@@ -217,6 +286,52 @@ func TestTxReIndex(t *testing.T) {
 	})
 }
 
+func TestTxReIndexOutdatedEncoding(t *testing.T) {
+	tx, cleanup := newTestDB(t)
+	defer cleanup()
+
+	err := tx.CreateTable("test", nil)
+	require.NoError(t, err)
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+
+	key, err := tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(1<<53+1)))
+	require.NoError(t, err)
+
+	err = tx.CreateIndex(database.IndexConfig{
+		IndexName: "a", TableName: "test", Path: document.NewValuePath("a"),
+	})
+	require.NoError(t, err)
+
+	// numbers used to be stored as float64, followed by the separator and the key
+	storeName := index.StorePrefix + "a\x1e" + string(byte(index.Float))
+	st, err := tx.Tx.Store(storeName)
+	require.NoError(t, err)
+	err = st.Truncate()
+	require.NoError(t, err)
+	err = st.Put(append([]byte{0xC3, 0x40, 0, 0, 0, 0, 0, 0, 0x1E}, key...), nil)
+	require.NoError(t, err)
+
+	idx, err := tx.GetIndex("a")
+	require.NoError(t, err)
+	err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+		return nil
+	})
+	require.Equal(t, index.ErrOutdatedEncoding, err)
+
+	err = tx.ReIndex("a")
+	require.NoError(t, err)
+
+	var values []document.Value
+	err = idx.AscendGreaterOrEqual(nil, func(val document.Value, k []byte) error {
+		require.Equal(t, key, k)
+		values = append(values, val)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []document.Value{document.NewInt64Value(1<<53 + 1)}, values)
+}
+
 func TestReIndexAll(t *testing.T) {
 	t.Run("Should succeed if not indexes", func(t *testing.T) {
 		tx, cleanup := newTestDB(t)
@@ -339,3 +454,451 @@ func TestTxListTables(t *testing.T) {
 		require.Equal(t, []string{"a", "b"}, list)
 	})
 }
+
+func TestTxRenameTable(t *testing.T) {
+	t.Run("Should rename a table and its indexes", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("foo", nil)
+		require.NoError(t, err)
+
+		err = tx.CreateIndex(database.IndexConfig{
+			IndexName: "idxFoo", TableName: "foo", Path: document.NewValuePath("fielda"),
+		})
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("foo")
+		require.NoError(t, err)
+
+		// insert more documents than copied at once
+		for i := 0; i < 250; i++ {
+			_, err = tb.Insert(newDocument())
+			require.NoError(t, err)
+		}
+
+		err = tx.RenameTable("foo", "bar")
+		require.NoError(t, err)
+
+		_, err = tx.GetTable("foo")
+		require.Equal(t, database.ErrTableNotFound, err)
+
+		tb, err = tx.GetTable("bar")
+		require.NoError(t, err)
+
+		var count int
+		err = tb.Iterate(func(d document.Document) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 250, count)
+
+		idx, err := tx.GetIndex("idxFoo")
+		require.NoError(t, err)
+		require.Equal(t, "bar", idx.TableName)
+
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 1)
+
+		// the table can be written to after being renamed
+		_, err = tb.Insert(newDocument())
+		require.NoError(t, err)
+	})
+
+	t.Run("Should rename the indexes of the unique fields", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("foo", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: document.NewValuePath("a"), Type: document.Int64Value, Unique: true},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("foo", database.FieldConstraint{Path: document.NewValuePath("b"), Type: document.Int64Value, Unique: true})
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("foo")
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().
+			Add("a", document.NewInt64Value(1)).
+			Add("b", document.NewInt64Value(2)))
+		require.NoError(t, err)
+
+		err = tx.RenameTable("foo", "bar")
+		require.NoError(t, err)
+
+		_, err = tx.GetIndex("__genji_autoindex_foo_a")
+		require.Equal(t, database.ErrIndexNotFound, err)
+		_, err = tx.GetIndex("__genji_autoindex_foo_b")
+		require.Equal(t, database.ErrIndexNotFound, err)
+
+		for _, name := range []string{"__genji_autoindex_bar_a", "__genji_autoindex_bar_b"} {
+			idx, err := tx.GetIndex(name)
+			require.NoError(t, err)
+			require.Equal(t, "bar", idx.TableName)
+		}
+
+		// the renamed indexes contain the existing documents
+		tb, err = tx.GetTable("bar")
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("b", document.NewInt64Value(2)))
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		// a new table can use the old name
+		err = tx.CreateTable("foo", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: document.NewValuePath("a"), Type: document.Int64Value, Unique: true},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.DropFieldConstraint("bar", document.NewValuePath("b"))
+		require.NoError(t, err)
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 1)
+	})
+
+	t.Run("Should fail if the table doesn't exist", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.RenameTable("foo", "bar")
+		require.Equal(t, database.ErrTableNotFound, err)
+	})
+
+	t.Run("Should fail if the new name is already used", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("foo", nil)
+		require.NoError(t, err)
+		err = tx.CreateTable("bar", nil)
+		require.NoError(t, err)
+
+		err = tx.RenameTable("foo", "bar")
+		require.Equal(t, database.ErrTableAlreadyExists, err)
+	})
+
+	t.Run("Should update the foreign keys referencing the table", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("foo", &database.TableConfig{
+			PrimaryKey: database.FieldConstraint{Path: []string{"id"}, Type: document.IntValue},
+		})
+		require.NoError(t, err)
+		err = tx.CreateTable("bar", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: []string{"foo"}, Type: document.IntValue, References: database.ForeignKey{Table: "foo", Path: []string{"id"}}},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.RenameTable("foo", "baz")
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("bar")
+		require.NoError(t, err)
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Equal(t, "baz", cfg.FieldConstraints[0].References.Table)
+	})
+}
+
+func TestTxAddFieldConstraint(t *testing.T) {
+	t.Run("Should convert the existing documents", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt8Value(10)))
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("b", document.NewInt8Value(10)))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.Float64Value})
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewFloat64Value(10), v)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Len(t, cfg.FieldConstraints, 1)
+
+		// new documents are validated against the constraint
+		key, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt8Value(5)))
+		require.NoError(t, err)
+		d, err = tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err = d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewFloat64Value(5), v)
+	})
+
+	t.Run("Should fail if a document can't be converted", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewStringValue("foo")))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue})
+		require.Error(t, err)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Len(t, cfg.FieldConstraints, 0)
+	})
+
+	t.Run("Should fail if the field already has a constraint", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{{Path: document.NewValuePath("a"), Type: document.IntValue}},
+		})
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.StringValue})
+		require.Error(t, err)
+	})
+
+	t.Run("Should set the default value of the existing documents", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		key, err := tb.Insert(document.NewFieldBuffer().Add("b", document.NewInt8Value(10)))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{
+			Path:         document.NewValuePath("a"),
+			Type:         document.IntValue,
+			NotNull:      true,
+			DefaultValue: document.NewInt8Value(1),
+		})
+		require.NoError(t, err)
+
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewIntValue(1), v)
+	})
+
+	t.Run("Should fail if a document doesn't satisfy the constraint", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt8Value(1)))
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewFloat64Value(1)))
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("b", document.NewInt8Value(1)))
+		require.NoError(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue, NotNull: true})
+		require.Error(t, err)
+
+		err = tx.AddFieldConstraint("test", database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue, Unique: true})
+		require.Error(t, err)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Len(t, cfg.FieldConstraints, 0)
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 0)
+	})
+}
+
+func TestTxSetPrimaryKey(t *testing.T) {
+	t.Run("Should store the documents under their new key", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{{Path: document.NewValuePath("a"), Type: document.IntValue}},
+		})
+		require.NoError(t, err)
+		err = tx.CreateIndex(database.IndexConfig{IndexName: "idx_test_b", TableName: "test", Path: document.NewValuePath("b")})
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		for _, a := range []int64{3, 1, 2} {
+			_, err = tb.Insert(document.NewFieldBuffer().
+				Add("a", document.NewInt64Value(a)).
+				Add("b", document.NewInt64Value(a*10)))
+			require.NoError(t, err)
+		}
+
+		err = tx.SetPrimaryKey("test", []document.ValuePath{document.NewValuePath("a")})
+		require.NoError(t, err)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Equal(t, database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue}, cfg.PrimaryKey)
+		require.Len(t, cfg.FieldConstraints, 0)
+
+		var values []int64
+		err = tb.Iterate(func(d document.Document) error {
+			v, err := d.GetByField("a")
+			if err != nil {
+				return err
+			}
+			x, err := v.ConvertToInt64()
+			values = append(values, x)
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1, 2, 3}, values)
+
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		var keys [][]byte
+		err = indexes["b"].AscendGreaterOrEqual(nil, func(v document.Value, k []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, keys, 3)
+		for i, k := range keys {
+			d, err := tb.GetDocument(k)
+			require.NoError(t, err)
+			v, err := d.GetByField("a")
+			require.NoError(t, err)
+			require.Equal(t, document.NewIntValue(int(values[i])), v)
+		}
+	})
+
+	t.Run("Should fail if two documents have the same key", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(1)))
+		require.NoError(t, err)
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewInt64Value(1)))
+		require.NoError(t, err)
+
+		err = tx.SetPrimaryKey("test", []document.ValuePath{document.NewValuePath("a")})
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Len(t, cfg.PrimaryKeyPaths, 0)
+
+		var n int
+		err = tb.Iterate(func(d document.Document) error {
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+	})
+}
+
+func TestTxDropFieldConstraint(t *testing.T) {
+	t.Run("Should remove the constraint", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: document.NewValuePath("a"), Type: document.IntValue},
+				{Path: document.NewValuePath("b"), Type: document.IntValue},
+			},
+		})
+		require.NoError(t, err)
+
+		err = tx.DropFieldConstraint("test", document.NewValuePath("a"))
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+		cfg, err := tb.Config()
+		require.NoError(t, err)
+		require.Equal(t, []database.FieldConstraint{{Path: document.NewValuePath("b"), Type: document.IntValue}}, cfg.FieldConstraints)
+	})
+
+	t.Run("Should fail if the field has no constraint", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", nil)
+		require.NoError(t, err)
+
+		err = tx.DropFieldConstraint("test", document.NewValuePath("a"))
+		require.Error(t, err)
+	})
+
+	t.Run("Should drop the index of a UNIQUE constraint", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			FieldConstraints: []database.FieldConstraint{
+				{Path: document.NewValuePath("a"), Type: document.IntValue, Unique: true},
+			},
+		})
+		require.NoError(t, err)
+
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+		indexes, err := tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 1)
+
+		err = tx.DropFieldConstraint("test", document.NewValuePath("a"))
+		require.NoError(t, err)
+
+		indexes, err = tb.Indexes()
+		require.NoError(t, err)
+		require.Len(t, indexes, 0)
+	})
+
+	t.Run("Should fail on the primary key", func(t *testing.T) {
+		tx, cleanup := newTestDB(t)
+		defer cleanup()
+
+		err := tx.CreateTable("test", &database.TableConfig{
+			PrimaryKey: database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue},
+		})
+		require.NoError(t, err)
+
+		err = tx.DropFieldConstraint("test", document.NewValuePath("a"))
+		require.Error(t, err)
+	})
+}
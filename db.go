@@ -45,11 +45,23 @@ func New(ng engine.Engine) (*DB, error) {
 		return nil, err
 	}
 
+	db.ParseCheck = parseCheck
+
 	return &DB{
 		DB: db,
 	}, nil
 }
 
+// parseCheck compiles the expression of a CHECK constraint.
+func parseCheck(expr string) (database.CheckFunc, error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.NewCheckFunc(e)
+}
+
 // Close the database.
 func (db *DB) Close() error {
 	return db.DB.Close()
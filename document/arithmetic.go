@@ -0,0 +1,235 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	errIntegerOverflow = errors.New("integer out of range")
+	errFloatOverflow   = errors.New("float out of range")
+	errDivisionByZero  = errors.New("division by zero")
+)
+
+type arithmeticOperator uint8
+
+const (
+	operatorAdd arithmeticOperator = iota + 1
+	operatorSub
+	operatorMul
+	operatorDiv
+	operatorMod
+	operatorBitwiseAnd
+	operatorBitwiseOr
+	operatorBitwiseXor
+)
+
+func (op arithmeticOperator) String() string {
+	switch op {
+	case operatorAdd:
+		return "+"
+	case operatorSub:
+		return "-"
+	case operatorMul:
+		return "*"
+	case operatorDiv:
+		return "/"
+	case operatorMod:
+		return "%"
+	case operatorBitwiseAnd:
+		return "&"
+	case operatorBitwiseOr:
+		return "|"
+	case operatorBitwiseXor:
+		return "^"
+	}
+
+	return ""
+}
+
+func (op arithmeticOperator) isBitwise() bool {
+	return op == operatorBitwiseAnd || op == operatorBitwiseOr || op == operatorBitwiseXor
+}
+
+// Add u to v and return the result.
+// If both values are integers, the result is an Int64 value,
+// if one of them is a float, the result is a Float64 value.
+// If one of the values is null, the result is null.
+func (v Value) Add(u Value) (Value, error) {
+	return calculateValues(operatorAdd, v, u)
+}
+
+// Sub calculates v - u and returns the result.
+// It follows the same conversion rules as Add.
+func (v Value) Sub(u Value) (Value, error) {
+	return calculateValues(operatorSub, v, u)
+}
+
+// Mul calculates v * u and returns the result.
+// It follows the same conversion rules as Add.
+func (v Value) Mul(u Value) (Value, error) {
+	return calculateValues(operatorMul, v, u)
+}
+
+// Div calculates v / u and returns the result.
+// The division of two integers is an integer division.
+// It follows the same conversion rules as Add.
+func (v Value) Div(u Value) (Value, error) {
+	return calculateValues(operatorDiv, v, u)
+}
+
+// Mod calculates v % u and returns the result.
+// It follows the same conversion rules as Add.
+func (v Value) Mod(u Value) (Value, error) {
+	return calculateValues(operatorMod, v, u)
+}
+
+// BitwiseAnd calculates v & u and returns the result.
+// Both values must be integers.
+func (v Value) BitwiseAnd(u Value) (Value, error) {
+	return calculateValues(operatorBitwiseAnd, v, u)
+}
+
+// BitwiseOr calculates v | u and returns the result.
+// Both values must be integers.
+func (v Value) BitwiseOr(u Value) (Value, error) {
+	return calculateValues(operatorBitwiseOr, v, u)
+}
+
+// BitwiseXor calculates v ^ u and returns the result.
+// Both values must be integers.
+func (v Value) BitwiseXor(u Value) (Value, error) {
+	return calculateValues(operatorBitwiseXor, v, u)
+}
+
+func calculateValues(op arithmeticOperator, l, r Value) (Value, error) {
+	if l.Type == NullValue || r.Type == NullValue {
+		return NewNullValue(), nil
+	}
+
+	if !l.Type.IsNumber() || !r.Type.IsNumber() {
+		return Value{}, fmt.Errorf("cannot apply operator %s to %s and %s values", op, l.Type, r.Type)
+	}
+
+	if l.Type.IsInteger() && r.Type.IsInteger() {
+		return calculateIntegers(op, l, r)
+	}
+
+	if op.isBitwise() {
+		return Value{}, fmt.Errorf("cannot apply bitwise operator %s to %s and %s values", op, l.Type, r.Type)
+	}
+
+	return calculateFloats(op, l, r)
+}
+
+func convertIntegerToInt64(v Value) (int64, error) {
+	// uint64 numbers can be bigger than int64
+	if v.Type == Uint64Value && v.V.(uint64) > math.MaxInt64 {
+		return 0, errIntegerOverflow
+	}
+
+	return convertNumberToInt64(v)
+}
+
+func calculateIntegers(op arithmeticOperator, l, r Value) (Value, error) {
+	a, err := convertIntegerToInt64(l)
+	if err != nil {
+		return Value{}, err
+	}
+
+	b, err := convertIntegerToInt64(r)
+	if err != nil {
+		return Value{}, err
+	}
+
+	var res int64
+
+	switch op {
+	case operatorAdd:
+		if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+			return Value{}, errIntegerOverflow
+		}
+		res = a + b
+	case operatorSub:
+		if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+			return Value{}, errIntegerOverflow
+		}
+		res = a - b
+	case operatorMul:
+		if a == 0 || b == 0 {
+			break
+		}
+		res = a * b
+		if res/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return Value{}, errIntegerOverflow
+		}
+	case operatorDiv:
+		if b == 0 {
+			return Value{}, errDivisionByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return Value{}, errIntegerOverflow
+		}
+		res = a / b
+	case operatorMod:
+		if b == 0 {
+			return Value{}, errDivisionByZero
+		}
+		// avoid the overflow of math.MinInt64 % -1
+		if b != -1 {
+			res = a % b
+		}
+	case operatorBitwiseAnd:
+		res = a & b
+	case operatorBitwiseOr:
+		res = a | b
+	case operatorBitwiseXor:
+		res = a ^ b
+	default:
+		return Value{}, fmt.Errorf("unknown operator %v", op)
+	}
+
+	return NewInt64Value(res), nil
+}
+
+func calculateFloats(op arithmeticOperator, l, r Value) (Value, error) {
+	a, err := l.ConvertToFloat64()
+	if err != nil {
+		return Value{}, err
+	}
+
+	b, err := r.ConvertToFloat64()
+	if err != nil {
+		return Value{}, err
+	}
+
+	var res float64
+
+	switch op {
+	case operatorAdd:
+		res = a + b
+	case operatorSub:
+		res = a - b
+	case operatorMul:
+		res = a * b
+	case operatorDiv:
+		if b == 0 {
+			return Value{}, errDivisionByZero
+		}
+		res = a / b
+	case operatorMod:
+		if b == 0 {
+			return Value{}, errDivisionByZero
+		}
+		res = math.Mod(a, b)
+	default:
+		return Value{}, fmt.Errorf("unknown operator %v", op)
+	}
+
+	if math.IsInf(res, 0) {
+		return Value{}, errFloatOverflow
+	}
+
+	return NewFloat64Value(res), nil
+}
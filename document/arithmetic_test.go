@@ -0,0 +1,63 @@
+package document_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueArithmetic(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(a, b document.Value) (document.Value, error)
+		a, b     document.Value
+		expected document.Value
+		fails    bool
+	}{
+		{"int8 + int16", document.Value.Add, document.NewInt8Value(10), document.NewInt16Value(1000), document.NewInt64Value(1010), false},
+		{"uint8 + int64", document.Value.Add, document.NewUint8Value(10), document.NewInt64Value(-20), document.NewInt64Value(-10), false},
+		{"int + float64", document.Value.Add, document.NewInt8Value(10), document.NewFloat64Value(1.5), document.NewFloat64Value(11.5), false},
+		{"int64 + int64 overflow", document.Value.Add, document.NewInt64Value(math.MaxInt64), document.NewInt8Value(1), document.Value{}, true},
+		{"uint64 too big", document.Value.Add, document.NewUint64Value(math.MaxUint64), document.NewInt8Value(1), document.Value{}, true},
+		{"int - int", document.Value.Sub, document.NewInt8Value(10), document.NewInt8Value(20), document.NewInt64Value(-10), false},
+		{"int - int overflow", document.Value.Sub, document.NewInt64Value(math.MinInt64), document.NewInt8Value(1), document.Value{}, true},
+		{"float - int", document.Value.Sub, document.NewFloat64Value(10.5), document.NewInt8Value(1), document.NewFloat64Value(9.5), false},
+		{"int * int", document.Value.Mul, document.NewInt8Value(10), document.NewInt32Value(-3), document.NewInt64Value(-30), false},
+		{"int * int overflow", document.Value.Mul, document.NewInt64Value(math.MaxInt64 / 2), document.NewInt8Value(3), document.Value{}, true},
+		{"int * int min overflow", document.Value.Mul, document.NewInt64Value(math.MinInt64), document.NewInt8Value(-1), document.Value{}, true},
+		{"float * float overflow", document.Value.Mul, document.NewFloat64Value(math.MaxFloat64), document.NewFloat64Value(2), document.Value{}, true},
+		{"int / int", document.Value.Div, document.NewInt8Value(10), document.NewInt8Value(4), document.NewInt64Value(2), false},
+		{"int / float", document.Value.Div, document.NewInt8Value(10), document.NewFloat64Value(4), document.NewFloat64Value(2.5), false},
+		{"int / 0", document.Value.Div, document.NewInt8Value(10), document.NewInt8Value(0), document.Value{}, true},
+		{"float / 0", document.Value.Div, document.NewFloat64Value(10), document.NewFloat64Value(0), document.Value{}, true},
+		{"int / int overflow", document.Value.Div, document.NewInt64Value(math.MinInt64), document.NewInt8Value(-1), document.Value{}, true},
+		{"int % int", document.Value.Mod, document.NewInt8Value(10), document.NewInt8Value(4), document.NewInt64Value(2), false},
+		{"int % -1", document.Value.Mod, document.NewInt64Value(math.MinInt64), document.NewInt8Value(-1), document.NewInt64Value(0), false},
+		{"float % int", document.Value.Mod, document.NewFloat64Value(10.5), document.NewInt8Value(4), document.NewFloat64Value(2.5), false},
+		{"int % 0", document.Value.Mod, document.NewInt8Value(10), document.NewInt8Value(0), document.Value{}, true},
+		{"int & int", document.Value.BitwiseAnd, document.NewInt8Value(6), document.NewInt8Value(3), document.NewInt64Value(2), false},
+		{"int | int", document.Value.BitwiseOr, document.NewInt8Value(6), document.NewInt8Value(3), document.NewInt64Value(7), false},
+		{"int ^ int", document.Value.BitwiseXor, document.NewInt8Value(6), document.NewInt8Value(3), document.NewInt64Value(5), false},
+		{"float & int", document.Value.BitwiseAnd, document.NewFloat64Value(6), document.NewInt8Value(3), document.Value{}, true},
+		{"null + int", document.Value.Add, document.NewNullValue(), document.NewInt8Value(3), document.NewNullValue(), false},
+		{"int / null", document.Value.Div, document.NewInt8Value(3), document.NewNullValue(), document.NewNullValue(), false},
+		{"string + int", document.Value.Add, document.NewStringValue("a"), document.NewInt8Value(3), document.Value{}, true},
+		{"bool + int", document.Value.Add, document.NewBoolValue(true), document.NewInt8Value(3), document.Value{}, true},
+		{"document + int", document.Value.Add, document.NewDocumentValue(document.NewFieldBuffer()), document.NewInt8Value(3), document.Value{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := test.fn(test.a, test.b)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, res)
+		})
+	}
+}
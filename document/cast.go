@@ -0,0 +1,153 @@
+package document
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// CastAs converts v to the type t. It is more permissive than ConvertTo:
+// any value can be cast as a string, and strings can be parsed as
+// numbers or booleans.
+// Integers are checked to fit in the target type, and NULL values remain NULL.
+func (v Value) CastAs(t ValueType) (Value, error) {
+	if v.Type == t || v.Type == NullValue {
+		return v, nil
+	}
+
+	switch {
+	case t == StringValue:
+		switch v.Type {
+		case BytesValue:
+			return NewStringValue(string(v.V.([]byte))), nil
+		case DocumentValue, ArrayValue:
+			data, err := v.MarshalJSON()
+			if err != nil {
+				return Value{}, err
+			}
+			return NewStringValue(string(data)), nil
+		}
+		return NewStringValue(v.String()), nil
+	case t == BytesValue:
+		if v.Type == StringValue {
+			return NewBytesValue(v.V.([]byte)), nil
+		}
+	case t == BoolValue:
+		if v.Type == StringValue || v.Type == BytesValue {
+			b, err := strconv.ParseBool(string(v.V.([]byte)))
+			if err != nil {
+				return Value{}, fmt.Errorf("cannot cast %q as %s", v.V, t)
+			}
+			return NewBoolValue(b), nil
+		}
+		if v.Type.IsNumber() {
+			return v.ConvertTo(t)
+		}
+	case t.IsNumber():
+		if v.Type == StringValue || v.Type == BytesValue {
+			var err error
+			v, err = parseNumber(string(v.V.([]byte)), t)
+			if err != nil {
+				return Value{}, fmt.Errorf("cannot cast %q as %s", v.V, t)
+			}
+		}
+		if v.Type == BoolValue {
+			return v.ConvertTo(t)
+		}
+		if v.Type.IsNumber() {
+			if t.IsInteger() {
+				if err := checkIntegerRange(v, t); err != nil {
+					return Value{}, err
+				}
+			}
+			return v.ConvertTo(t)
+		}
+	}
+
+	return Value{}, fmt.Errorf("cannot cast %s as %s", v.Type, t)
+}
+
+// parseNumber parses s as an integer if t is an integer type,
+// or as a float otherwise.
+func parseNumber(s string, t ValueType) (Value, error) {
+	if t.IsFloat() {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return NewStringValue(s), err
+		}
+		return NewFloat64Value(f), nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return NewInt64Value(i), nil
+	}
+
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return NewStringValue(s), err
+	}
+
+	return NewUint64Value(u), nil
+}
+
+// checkIntegerRange returns an error if the number v cannot be converted to the integer type t
+// without overflowing or losing precision.
+func checkIntegerRange(v Value, t ValueType) error {
+	var min int64
+	var max uint64
+
+	switch t {
+	case Int8Value:
+		min, max = math.MinInt8, math.MaxInt8
+	case Int16Value:
+		min, max = math.MinInt16, math.MaxInt16
+	case Int32Value:
+		min, max = math.MinInt32, math.MaxInt32
+	case IntValue, Int64Value:
+		min, max = math.MinInt64, math.MaxInt64
+	case Uint8Value:
+		max = math.MaxUint8
+	case Uint16Value:
+		max = math.MaxUint16
+	case Uint32Value:
+		max = math.MaxUint32
+	case UintValue, Uint64Value:
+		max = math.MaxUint64
+	}
+
+	errOutOfRange := fmt.Errorf("cannot cast %v as %s: out of range", v, t)
+
+	switch v.Type {
+	case Uint64Value, UintValue:
+		u, err := v.ConvertToUint64()
+		if err != nil {
+			return err
+		}
+		if u > max {
+			return errOutOfRange
+		}
+		return nil
+	case Float64Value:
+		f := v.V.(float64)
+		if math.Trunc(f) != f {
+			return fmt.Errorf("cannot cast %v as %s without loss of precision", v, t)
+		}
+		// floats bigger than math.MaxInt64 can't be converted without overflowing
+		if f < float64(min) || f > float64(max) || f >= -math.MinInt64 {
+			return errOutOfRange
+		}
+		return nil
+	}
+
+	i, err := v.ConvertToInt64()
+	if err != nil {
+		return err
+	}
+
+	if i < min || (i > 0 && uint64(i) > max) {
+		return errOutOfRange
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package document_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCastAs(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        document.Value
+		t        document.ValueType
+		expected document.Value
+		fails    bool
+	}{
+		{"null", document.NewNullValue(), document.Int64Value, document.NewNullValue(), false},
+		{"same type", document.NewInt8Value(10), document.Int8Value, document.NewInt8Value(10), false},
+		{"int8 to int64", document.NewInt8Value(10), document.Int64Value, document.NewInt64Value(10), false},
+		{"int64 to int8", document.NewInt64Value(-10), document.Int8Value, document.NewInt8Value(-10), false},
+		{"int64 to int8 overflow", document.NewInt64Value(300), document.Int8Value, document.Value{}, true},
+		{"negative int to uint", document.NewInt64Value(-1), document.Uint64Value, document.Value{}, true},
+		{"uint64 to int64 overflow", document.NewUint64Value(math.MaxUint64), document.Int64Value, document.Value{}, true},
+		{"uint64 to uint64", document.NewUint64Value(math.MaxUint64), document.UintValue, document.NewUintValue(math.MaxUint64), false},
+		{"int to float64", document.NewInt16Value(10), document.Float64Value, document.NewFloat64Value(10), false},
+		{"float64 to int64", document.NewFloat64Value(10), document.Int64Value, document.NewInt64Value(10), false},
+		{"float64 with decimals to int64", document.NewFloat64Value(10.5), document.Int64Value, document.Value{}, true},
+		{"float64 to int8 overflow", document.NewFloat64Value(1000), document.Int8Value, document.Value{}, true},
+		{"float64 to int64 overflow", document.NewFloat64Value(1e20), document.Int64Value, document.Value{}, true},
+		{"bool to int64", document.NewBoolValue(true), document.Int64Value, document.NewInt64Value(1), false},
+		{"int to bool", document.NewInt8Value(10), document.BoolValue, document.NewBoolValue(true), false},
+		{"string to int64", document.NewStringValue("-10"), document.Int64Value, document.NewInt64Value(-10), false},
+		{"string to uint64", document.NewStringValue("18446744073709551615"), document.Uint64Value, document.NewUint64Value(math.MaxUint64), false},
+		{"string to int8 overflow", document.NewStringValue("300"), document.Int8Value, document.Value{}, true},
+		{"string to float64", document.NewStringValue("10.5"), document.Float64Value, document.NewFloat64Value(10.5), false},
+		{"invalid string to int64", document.NewStringValue("foo"), document.Int64Value, document.Value{}, true},
+		{"string to bool", document.NewStringValue("true"), document.BoolValue, document.NewBoolValue(true), false},
+		{"invalid string to bool", document.NewStringValue("foo"), document.BoolValue, document.Value{}, true},
+		{"string to bytes", document.NewStringValue("foo"), document.BytesValue, document.NewBytesValue([]byte("foo")), false},
+		{"bytes to string", document.NewBytesValue([]byte("foo")), document.StringValue, document.NewStringValue("foo"), false},
+		{"int to string", document.NewInt64Value(10), document.StringValue, document.NewStringValue("10"), false},
+		{"float to string", document.NewFloat64Value(10.5), document.StringValue, document.NewStringValue("10.5"), false},
+		{"bool to string", document.NewBoolValue(true), document.StringValue, document.NewStringValue("true"), false},
+		{"document to string", document.NewDocumentValue(document.NewFieldBuffer().Add("a", document.NewInt64Value(1))), document.StringValue, document.NewStringValue(`{"a":1}`), false},
+		{"int to bytes", document.NewInt64Value(10), document.BytesValue, document.Value{}, true},
+		{"document to int64", document.NewDocumentValue(document.NewFieldBuffer()), document.Int64Value, document.Value{}, true},
+		{"string to document", document.NewStringValue("foo"), document.DocumentValue, document.Value{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := test.v.CastAs(test.t)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, res)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 )
 
 type operator uint8
@@ -262,24 +263,53 @@ func compareNumbers(op operator, l, r Value) (bool, error) {
 		return false, err
 	}
 
+	// integers can't always be converted to float64 without loss of precision,
+	// compare them with floats exactly
+	var cmp int
+	switch {
+	case math.IsNaN(af) || math.IsNaN(bf):
+		return false, nil
+	case l.Type.IsInteger():
+		cmp = exactFloat(l).Cmp(big.NewFloat(bf))
+	case r.Type.IsInteger():
+		cmp = big.NewFloat(af).Cmp(exactFloat(r))
+	case af < bf:
+		cmp = -1
+	case af > bf:
+		cmp = 1
+	}
+
 	var ok bool
 
 	switch op {
 	case operatorEq:
-		ok = af == bf
+		ok = cmp == 0
 	case operatorGt:
-		ok = af > bf
+		ok = cmp > 0
 	case operatorGte:
-		ok = af >= bf
+		ok = cmp >= 0
 	case operatorLt:
-		ok = af < bf
+		ok = cmp < 0
 	case operatorLte:
-		ok = af <= bf
+		ok = cmp <= 0
 	}
 
 	return ok, nil
 }
 
+// exactFloat returns the value of the integer v as a big.Float, without loss of precision.
+func exactFloat(v Value) *big.Float {
+	switch v.Type {
+	case UintValue:
+		return new(big.Float).SetUint64(uint64(v.V.(uint)))
+	case Uint64Value:
+		return new(big.Float).SetUint64(v.V.(uint64))
+	}
+
+	i, _ := convertNumberToInt64(v)
+	return new(big.Float).SetInt64(i)
+}
+
 var errStop = errors.New("stop")
 
 func compareDocuments(op operator, l, r Value) (bool, error) {
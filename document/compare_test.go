@@ -121,6 +121,32 @@ func TestComparisonNumbers(t *testing.T) {
 		require.NoError(t, err)
 		require.True(t, ok)
 	})
+
+	t.Run("large integers and floats", func(t *testing.T) {
+		// 2^53 + 1 can't be represented by a float64
+		a := document.NewInt64Value(1<<53 + 1)
+		b := document.NewFloat64Value(1 << 53)
+
+		ok, err := a.IsEqual(b)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		ok, err = a.IsGreaterThan(b)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = b.IsLesserThan(a)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = document.NewUint64Value(math.MaxUint64).IsLesserThan(document.NewFloat64Value(1 << 64))
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = document.NewInt64Value(1 << 53).IsEqual(b)
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
 }
 
 func TestComparisonNumbersWithNull(t *testing.T) {
@@ -66,9 +66,13 @@ func (j jsonDocument) MarshalJSON() ([]byte, error) {
 		}
 		notFirst = true
 
-		buf.WriteByte('"')
-		buf.WriteString(f)
-		buf.WriteString(`":`)
+		// field names can contain any character, e.g. the names of computed fields
+		key, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
 
 		data, err := v.MarshalJSON()
 		if err != nil {
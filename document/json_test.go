@@ -39,6 +39,12 @@ func TestToJSON(t *testing.T) {
 				)),
 			`{"name":"John","age":10,"address":{"city":"Ajaccio","country":"France"},"friends":["fred","jamie"]}` + "\n",
 		},
+		{
+			"Escaped field names",
+			document.NewFieldBuffer().
+				Add(`name = "John"`, document.NewBoolValue(true)),
+			`{"name = \"John\"":true}` + "\n",
+		},
 	}
 
 	for _, test := range tests {
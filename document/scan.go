@@ -312,6 +312,10 @@ func scanValue(v Value, ref reflect.Value) error {
 
 		return mapScan(d, ref)
 	case reflect.Interface:
+		if v.Type == NullValue {
+			ref.Set(reflect.Zero(ref.Type()))
+			return nil
+		}
 		ref.Set(reflect.ValueOf(v.V))
 		return nil
 	}
@@ -123,6 +123,13 @@ func TestScan(t *testing.T) {
 		require.Len(t, m, 19)
 	})
 
+	t.Run("NULL into interface", func(t *testing.T) {
+		var x interface{} = 10
+		err := document.ScanValue(document.NewNullValue(), &x)
+		require.NoError(t, err)
+		require.Nil(t, x)
+	})
+
 	t.Run("Small Slice", func(t *testing.T) {
 		s := make([]int, 1)
 		arr := document.NewValueBuffer().Append(document.NewInt16Value(1)).Append(document.NewInt16Value(2))
@@ -433,10 +433,7 @@ func (v Value) ConvertTo(t ValueType) (Value, error) {
 		if err != nil {
 			return Value{}, err
 		}
-		return Value{
-			Type: StringValue,
-			V:    x,
-		}, nil
+		return NewStringValue(x), nil
 	case BoolValue:
 		x, err := v.ConvertToBool()
 		if err != nil {
@@ -99,11 +99,14 @@ func (s *Store) Truncate() error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	err := s.tx.DeleteBucket(s.name)
-	if err != nil {
-		return err
+	// keys are deleted in place so that every handle on the bucket sees the changes
+	c := s.bucket.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.First() {
+		err := c.Delete()
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = s.tx.CreateBucket(s.name)
-	return err
+	return nil
 }
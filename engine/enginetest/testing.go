@@ -277,6 +277,47 @@ func TestTransactionCommitRollback(t *testing.T, builder Builder) {
 		}
 	})
 
+	t.Run("Rollback should undo successive changes to the same key", func(t *testing.T) {
+		ng, cleanup := builder()
+		defer cleanup()
+
+		tx, err := ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		err = tx.CreateStore("store")
+		require.NoError(t, err)
+		st, err := tx.Store("store")
+		require.NoError(t, err)
+		err = st.Put([]byte("foo"), []byte("FOO"))
+		require.NoError(t, err)
+		err = tx.Commit()
+		require.NoError(t, err)
+
+		tx, err = ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		st, err = tx.Store("store")
+		require.NoError(t, err)
+		err = st.Delete([]byte("foo"))
+		require.NoError(t, err)
+		err = st.Put([]byte("foo"), []byte("BAR"))
+		require.NoError(t, err)
+		err = tx.Rollback()
+		require.NoError(t, err)
+
+		tx, err = ng.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		st, err = tx.Store("store")
+		require.NoError(t, err)
+		v, err := st.Get([]byte("foo"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("FOO"), v)
+	})
+
 	t.Run("Data should be visible within the same transaction", func(t *testing.T) {
 		tests := []struct {
 			name    string
@@ -841,6 +882,46 @@ func TestStoreTruncate(t *testing.T, builder Builder) {
 		})
 		require.NoError(t, err)
 	})
+
+	t.Run("Should truncate the store for the whole transaction", func(t *testing.T) {
+		ng, cleanup := builder()
+		defer cleanup()
+
+		tx, err := ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		err = tx.CreateStore("test")
+		require.NoError(t, err)
+		st, err := tx.Store("test")
+		require.NoError(t, err)
+
+		err = st.Put([]byte("foo"), []byte("FOO"))
+		require.NoError(t, err)
+		err = st.Put([]byte("bar"), []byte("BAR"))
+		require.NoError(t, err)
+
+		err = st.Truncate()
+		require.NoError(t, err)
+		err = st.Put([]byte("foo"), []byte("BAZ"))
+		require.NoError(t, err)
+
+		err = tx.Commit()
+		require.NoError(t, err)
+
+		tx, err = ng.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		st, err = tx.Store("test")
+		require.NoError(t, err)
+
+		_, err = st.Get([]byte("bar"))
+		require.Equal(t, engine.ErrKeyNotFound, err)
+		v, err := st.Get([]byte("foo"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("BAZ"), v)
+	})
 }
 
 // TestQueries test simple queries against the engine.
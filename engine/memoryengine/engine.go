@@ -61,8 +61,10 @@ func (tx *transaction) Rollback() error {
 		return nil
 	}
 
-	for _, undo := range tx.onRollback {
-		undo()
+	// undo changes in reverse order, so that successive
+	// changes to the same item are restored correctly
+	for i := len(tx.onRollback) - 1; i >= 0; i-- {
+		tx.onRollback[i]()
 	}
 
 	tx.terminated = true
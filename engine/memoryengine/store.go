@@ -94,7 +94,10 @@ func (s *storeTx) Delete(k []byte) error {
 	})
 
 	s.tx.onCommit = append(s.tx.onCommit, func() {
-		s.tr.Delete(i)
+		// the key may have been put again after being deleted
+		if i.deleted {
+			s.tr.Delete(i)
+		}
 	})
 	return nil
 }
@@ -104,11 +107,31 @@ func (s *storeTx) Truncate() error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	old := s.tr
-	s.tr = btree.New(3)
+	// items are deleted in place so that every handle on the store sees the changes
+	var items []*item
+	s.tr.Ascend(func(i btree.Item) bool {
+		if it := i.(*item); !it.deleted {
+			items = append(items, it)
+		}
+		return true
+	})
+
+	for _, it := range items {
+		it.deleted = true
+	}
 
 	s.tx.onRollback = append(s.tx.onRollback, func() {
-		s.tr = old
+		for _, it := range items {
+			it.deleted = false
+		}
+	})
+
+	s.tx.onCommit = append(s.tx.onCommit, func() {
+		for _, it := range items {
+			if it.deleted {
+				s.tr.Delete(it)
+			}
+		}
 	})
 
 	return nil
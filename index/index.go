@@ -22,7 +22,7 @@ const (
 // They are automatically converted to one of the following types:
 //
 // Strings and Bytes values are stored in Bytes indexes.
-// Signed, unsigned integers, and floats are stored in Float indexes.
+// Signed, unsigned integers, and floats are stored in Float indexes, without losing the precision of integers.
 // Booleans are stores in Bool indexes.
 type Type byte
 
@@ -145,7 +145,9 @@ func (i *ListIndex) Set(val document.Value, key []byte) error {
 	buf = append(buf, separator)
 	buf = append(buf, key...)
 
-	return st.Put(buf, nil)
+	// the key is also stored as value, since both the encoded value and the key
+	// can contain the separator
+	return st.Put(buf, key)
 }
 
 // Delete all the references to the key from the index.
@@ -184,13 +186,13 @@ func (i *ListIndex) AscendGreaterOrEqual(pivot *Pivot, fn func(val document.Valu
 			}
 
 			err = st.AscendGreaterOrEqual(nil, func(k, v []byte) error {
-				idx := bytes.LastIndexByte(k, separator)
-				f, err := decodeIndexValueToField(t, k[:idx])
+				data, key := splitListEntry(k, v)
+				f, err := decodeIndexValueToField(t, data)
 				if err != nil {
 					return err
 				}
 
-				return fn(f, k[idx+1:])
+				return fn(f, key)
 			})
 			if err != nil {
 				return err
@@ -217,13 +219,13 @@ func (i *ListIndex) AscendGreaterOrEqual(pivot *Pivot, fn func(val document.Valu
 	}
 
 	return st.AscendGreaterOrEqual(data, func(k, v []byte) error {
-		idx := bytes.LastIndexByte(k, separator)
-		f, err := decodeIndexValueToField(NewTypeFromValueType(pivot.Value.Type), k[:idx])
+		data, key := splitListEntry(k, v)
+		f, err := decodeIndexValueToField(NewTypeFromValueType(pivot.Value.Type), data)
 		if err != nil {
 			return err
 		}
 
-		return fn(f, k[idx+1:])
+		return fn(f, key)
 	})
 }
 
@@ -243,13 +245,13 @@ func (i *ListIndex) DescendLessOrEqual(pivot *Pivot, fn func(val document.Value,
 			}
 
 			err = st.DescendLessOrEqual(nil, func(k, v []byte) error {
-				idx := bytes.LastIndexByte(k, separator)
-				f, err := decodeIndexValueToField(t, k[:idx])
+				data, key := splitListEntry(k, v)
+				f, err := decodeIndexValueToField(t, data)
 				if err != nil {
 					return err
 				}
 
-				return fn(f, k[idx+1:])
+				return fn(f, key)
 			})
 			if err != nil {
 				return err
@@ -281,39 +283,42 @@ func (i *ListIndex) DescendLessOrEqual(pivot *Pivot, fn func(val document.Value,
 	}
 
 	return st.DescendLessOrEqual(data, func(k, v []byte) error {
-		idx := bytes.LastIndexByte(k, separator)
-		f, err := decodeIndexValueToField(NewTypeFromValueType(pivot.Value.Type), k[:idx])
+		data, key := splitListEntry(k, v)
+		f, err := decodeIndexValueToField(NewTypeFromValueType(pivot.Value.Type), data)
 		if err != nil {
 			return err
 		}
 
-		return fn(f, k[idx+1:])
+		return fn(f, key)
 	})
 }
 
-// Truncate deletes all the index data.
-func (i *ListIndex) Truncate() error {
-	err := dropStore(i.tx, Float, i.name)
-	if err != nil {
-		return err
+// splitListEntry returns the encoded value and the key of an entry of a list index.
+// Entries written by previous versions don't store the key as value,
+// their key is found after the last separator.
+func splitListEntry(k, v []byte) ([]byte, []byte) {
+	if len(v) > 0 {
+		return k[:len(k)-len(v)-1], v
 	}
 
-	err = dropStore(i.tx, Bytes, i.name)
-	if err != nil {
-		return err
-	}
+	idx := bytes.LastIndexByte(k, separator)
+	return k[:idx], k[idx+1:]
+}
 
-	return dropStore(i.tx, Bool, i.name)
+// Truncate deletes all the index data.
+func (i *ListIndex) Truncate() error {
+	return dropStores(i.tx, i.name)
 }
 
 // UniqueIndex is an implementation that associates a value with a exactly one key.
+// NULL values are not unique: they can be associated with any number of keys.
 type UniqueIndex struct {
 	tx   engine.Transaction
 	name string
 }
 
 // Set associates a value with exactly one key.
-// If the association already exists, it returns an error.
+// If the association already exists, it returns an error, unless the value is NULL.
 func (i *UniqueIndex) Set(val document.Value, key []byte) error {
 	v, err := encodeFieldToIndexValue(val)
 	if err != nil {
@@ -330,6 +335,11 @@ func (i *UniqueIndex) Set(val document.Value, key []byte) error {
 	buf = append(buf, separator)
 	buf = append(buf, v...)
 
+	// the entries of NULL values also contain the key, to tell them apart
+	if val.Type == document.NullValue {
+		return st.Put(append(buf, key...), key)
+	}
+
 	_, err = st.Get(buf)
 	if err == nil {
 		return ErrDuplicate
@@ -358,6 +368,14 @@ func (i *UniqueIndex) Delete(val document.Value, key []byte) error {
 	buf = append(buf, separator)
 	buf = append(buf, v...)
 
+	if val.Type == document.NullValue {
+		err = st.Delete(append(buf, key...))
+		// entries written by previous versions don't contain the key
+		if err != engine.ErrKeyNotFound {
+			return err
+		}
+	}
+
 	return st.Delete(buf)
 }
 
@@ -488,27 +506,12 @@ func (i *UniqueIndex) DescendLessOrEqual(pivot *Pivot, fn func(val document.Valu
 
 // Truncate deletes all the index data.
 func (i *UniqueIndex) Truncate() error {
-	err := dropStore(i.tx, Float, i.name)
-	if err != nil {
-		return err
-	}
-
-	err = dropStore(i.tx, Bytes, i.name)
-	if err != nil {
-		return err
-	}
-
-	return dropStore(i.tx, Bool, i.name)
+	return dropStores(i.tx, i.name)
 }
 
 func encodeFieldToIndexValue(val document.Value) ([]byte, error) {
-	if val.V != nil && val.Type.IsNumber() && val.Type != document.Float64Value {
-		x, err := val.ConvertToFloat64()
-		if err != nil {
-			return nil, err
-		}
-
-		return encoding.EncodeFloat64(x), nil
+	if val.V != nil && val.Type.IsNumber() {
+		return encodeNumber(val)
 	}
 
 	return encoding.EncodeValue(val)
@@ -521,8 +524,7 @@ func decodeIndexValueToField(t Type, data []byte) (document.Value, error) {
 	case Bytes:
 		return document.NewBytesValue(data), nil
 	case Float:
-		f, err := encoding.DecodeFloat64(data)
-		return document.NewFloat64Value(f), err
+		return decodeNumber(data)
 	case Bool:
 		b, err := encoding.DecodeBool(data)
 		return document.NewBoolValue(b), err
@@ -560,6 +562,18 @@ func getStore(tx engine.Transaction, t Type, name string) (engine.Store, error)
 	return nil, err
 }
 
+// dropStores drops the stores of all the index types.
+func dropStores(tx engine.Transaction, name string) error {
+	for t := Null; t <= Bytes; t++ {
+		err := dropStore(tx, t, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func dropStore(tx engine.Transaction, t Type, name string) error {
 	idxName := buildIndexName(name, t)
 	_, err := tx.Store(idxName)
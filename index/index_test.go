@@ -56,6 +56,46 @@ func TestIndexSet(t *testing.T) {
 		require.NoError(t, idx.Set(document.NewIntValue(11), []byte("key")))
 		require.Equal(t, index.ErrDuplicate, idx.Set(document.NewIntValue(10), []byte("key")))
 	})
+
+	t.Run("Unique: true, NULL values are not unique", func(t *testing.T) {
+		idx, cleanup := getIndex(t, true)
+		defer cleanup()
+
+		require.NoError(t, idx.Set(document.NewNullValue(), []byte("key1")))
+		require.NoError(t, idx.Set(document.NewNullValue(), []byte("key2")))
+		require.NoError(t, idx.Delete(document.NewNullValue(), []byte("key1")))
+
+		var keys []string
+		err := idx.AscendGreaterOrEqual(index.EmptyPivot(document.NullValue), func(val document.Value, key []byte) error {
+			require.Equal(t, document.NewNullValue(), val)
+			keys = append(keys, string(key))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"key2"}, keys)
+	})
+
+	for _, unique := range []bool{true, false} {
+		text := fmt.Sprintf("Unique: %v, ", unique)
+
+		t.Run(text+"Values and keys containing the separator", func(t *testing.T) {
+			idx, cleanup := getIndex(t, unique)
+			defer cleanup()
+
+			key := []byte{0, 0, 0, 0x1E}
+			require.NoError(t, idx.Set(document.NewStringValue("a\x1Eb"), key))
+
+			var i int
+			err := idx.AscendGreaterOrEqual(nil, func(val document.Value, k []byte) error {
+				require.Equal(t, document.NewBytesValue([]byte("a\x1Eb")), val)
+				require.Equal(t, key, k)
+				i++
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, i)
+		})
+	}
 }
 
 func TestIndexDelete(t *testing.T) {
@@ -129,6 +169,31 @@ func TestIndexDelete(t *testing.T) {
 	}
 }
 
+func TestIndexTruncate(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		text := fmt.Sprintf("Unique: %v, ", unique)
+
+		t.Run(text+"Truncate removes all the values", func(t *testing.T) {
+			idx, cleanup := getIndex(t, unique)
+			defer cleanup()
+
+			require.NoError(t, idx.Set(document.NewNullValue(), []byte("key1")))
+			require.NoError(t, idx.Set(document.NewBoolValue(true), []byte("key2")))
+			require.NoError(t, idx.Set(document.NewIntValue(10), []byte("key3")))
+			require.NoError(t, idx.Set(document.NewStringValue("foo"), []byte("key4")))
+			require.NoError(t, idx.Truncate())
+
+			err := idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				return errors.New("should not reach this point")
+			})
+			require.NoError(t, err)
+
+			// values can be set again
+			require.NoError(t, idx.Set(document.NewNullValue(), []byte("key1")))
+		})
+	}
+}
+
 func TestIndexAscendGreaterThan(t *testing.T) {
 	for _, unique := range []bool{true, false} {
 		text := fmt.Sprintf("Unique: %v, ", unique)
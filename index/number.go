@@ -0,0 +1,101 @@
+package index
+
+import (
+	"errors"
+	"math"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+)
+
+// numberSize is the size of an encoded number.
+const numberSize = 16
+
+// ErrOutdatedEncoding is returned when reading numbers stored by a version that converted them to float64.
+// Indexes containing such numbers must be rebuilt using REINDEX.
+var ErrOutdatedEncoding = errors.New("index stores numbers with an outdated encoding, run REINDEX to rebuild it")
+
+// encodeNumber encodes any number so that the lexicographic order of the encoded numbers
+// follows their numeric order, whatever their type, without losing the precision of integers.
+// The number is encoded as the greatest float64 lower than or equal to it, followed by
+// the difference between the number and that float64. The difference is only non zero
+// for integers that can't be represented exactly by a float64, and is always lower
+// than the distance between that float64 and the next one.
+func encodeNumber(v document.Value) ([]byte, error) {
+	var f float64
+	var delta uint64
+
+	switch v.Type {
+	case document.Float64Value:
+		f = v.V.(float64)
+		// -0 and 0 must have the same encoding
+		if f == 0 {
+			f = 0
+		}
+	case document.UintValue, document.Uint64Value:
+		x, err := v.ConvertToUint64()
+		if err != nil {
+			return nil, err
+		}
+
+		f = float64(x)
+		if f >= 1<<64 || uint64(f) > x {
+			f = math.Nextafter(f, math.Inf(-1))
+		}
+		delta = x - uint64(f)
+	default:
+		x, err := v.ConvertToInt64()
+		if err != nil {
+			return nil, err
+		}
+
+		f = float64(x)
+		if f >= 1<<63 || int64(f) > x {
+			f = math.Nextafter(f, math.Inf(-1))
+		}
+		delta = uint64(x - int64(f))
+	}
+
+	buf := make([]byte, 0, numberSize)
+	buf = append(buf, encoding.EncodeFloat64(f)...)
+	return append(buf, encoding.EncodeUint64(delta)...), nil
+}
+
+// decodeNumber decodes a number encoded with encodeNumber.
+// Numbers that can be represented exactly by a float64 are returned as float64,
+// other integers are returned as int64, or uint64 if they don't fit.
+func decodeNumber(data []byte) (document.Value, error) {
+	if len(data) != numberSize {
+		if len(data) == 8 {
+			return document.Value{}, ErrOutdatedEncoding
+		}
+
+		return document.Value{}, errors.New("cannot decode number: invalid length")
+	}
+
+	f, err := encoding.DecodeFloat64(data[:8])
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	delta, err := encoding.DecodeUint64(data[8:])
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	switch {
+	case delta == 0 && (math.Trunc(f) != f || math.Abs(f) <= 1<<53):
+		return document.NewFloat64Value(f), nil
+	case f >= math.MinInt64 && f < math.MaxInt64:
+		x := int64(f)
+		if x > 0 && delta > uint64(math.MaxInt64-x) {
+			return document.NewUint64Value(uint64(x) + delta), nil
+		}
+
+		return document.NewInt64Value(x + int64(delta)), nil
+	case f >= 0 && f < 1<<64:
+		return document.NewUint64Value(uint64(f) + delta), nil
+	}
+
+	return document.NewFloat64Value(f), nil
+}
@@ -0,0 +1,148 @@
+package index_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/asdine/genji/index"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberEncoding(t *testing.T) {
+	// numbers in increasing order
+	numbers := []document.Value{
+		document.NewFloat64Value(math.Inf(-1)),
+		document.NewFloat64Value(-1e300),
+		document.NewInt64Value(math.MinInt64),
+		document.NewInt64Value(math.MinInt64 + 1),
+		document.NewInt64Value(-1<<53 - 1),
+		document.NewFloat64Value(-1 << 53),
+		document.NewInt32Value(-1),
+		document.NewFloat64Value(-0.5),
+		document.NewIntValue(0),
+		document.NewFloat64Value(0.5),
+		document.NewUint8Value(1),
+		document.NewFloat64Value(1.5),
+		document.NewInt64Value(1 << 53),
+		document.NewInt64Value(1<<53 + 1),
+		document.NewInt64Value(1<<53 + 2),
+		document.NewInt64Value(math.MaxInt64 - 1),
+		document.NewInt64Value(math.MaxInt64),
+		document.NewUint64Value(math.MaxInt64 + 1),
+		document.NewUint64Value(math.MaxUint64 - 1),
+		document.NewUint64Value(math.MaxUint64),
+		document.NewFloat64Value(1e300),
+		document.NewFloat64Value(math.Inf(1)),
+	}
+
+	var prev []byte
+	for i, n := range numbers {
+		enc, err := index.EncodeTuple([]document.Value{n})
+		require.NoError(t, err)
+
+		if i > 0 {
+			require.Equal(t, -1, bytes.Compare(prev, enc), "%v should be lower than %v", numbers[i-1], n)
+		}
+		prev = enc
+	}
+
+	t.Run("Equal numbers of different types", func(t *testing.T) {
+		tests := [][]document.Value{
+			{document.NewIntValue(3), document.NewFloat64Value(3), document.NewUint64Value(3), document.NewInt8Value(3)},
+			{document.NewIntValue(0), document.NewFloat64Value(math.Copysign(0, -1))},
+			{document.NewInt64Value(1 << 60), document.NewFloat64Value(1 << 60), document.NewUint64Value(1 << 60)},
+		}
+
+		for _, values := range tests {
+			first, err := index.EncodeTuple(values[:1])
+			require.NoError(t, err)
+
+			for _, v := range values[1:] {
+				enc, err := index.EncodeTuple([]document.Value{v})
+				require.NoError(t, err)
+				require.Equal(t, first, enc, "%v should be equal to %v", values[0], v)
+			}
+		}
+	})
+
+	t.Run("Decode", func(t *testing.T) {
+		tests := []struct {
+			value    document.Value
+			expected document.Value
+		}{
+			{document.NewIntValue(10), document.NewFloat64Value(10)},
+			{document.NewFloat64Value(-1.5), document.NewFloat64Value(-1.5)},
+			{document.NewInt64Value(1<<53 + 1), document.NewInt64Value(1<<53 + 1)},
+			{document.NewInt64Value(math.MinInt64 + 1), document.NewInt64Value(math.MinInt64 + 1)},
+			{document.NewInt64Value(math.MaxInt64), document.NewInt64Value(math.MaxInt64)},
+			{document.NewUint64Value(math.MaxUint64), document.NewUint64Value(math.MaxUint64)},
+			{document.NewFloat64Value(1e300), document.NewFloat64Value(1e300)},
+		}
+
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%v", test.value), func(t *testing.T) {
+				enc, err := index.EncodeTuple([]document.Value{test.value})
+				require.NoError(t, err)
+
+				values, err := index.DecodeTuple(enc)
+				require.NoError(t, err)
+				require.Equal(t, []document.Value{test.expected}, values)
+			})
+		}
+	})
+}
+
+func TestIndexLargeIntegers(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		t.Run(fmt.Sprintf("Unique: %v", unique), func(t *testing.T) {
+			idx, cleanup := getIndex(t, unique)
+			defer cleanup()
+
+			values := []int64{1<<60 + 2, 1<<60 + 1, 1 << 60, 1<<60 - 1}
+			for i, v := range values {
+				require.NoError(t, idx.Set(document.NewInt64Value(v), []byte{'a' + byte(i)}))
+			}
+
+			var keys []byte
+			err := idx.AscendGreaterOrEqual(&index.Pivot{Value: document.NewInt64Value(1 << 60)}, func(val document.Value, key []byte) error {
+				keys = append(keys, key...)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, "cba", string(keys))
+
+			keys = nil
+			err = idx.DescendLessOrEqual(&index.Pivot{Value: document.NewInt64Value(1<<60 + 1)}, func(val document.Value, key []byte) error {
+				keys = append(keys, key...)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, "bcd", string(keys))
+		})
+	}
+
+	t.Run("Outdated encoding", func(t *testing.T) {
+		ng := memoryengine.NewEngine()
+		tx, err := ng.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		// numbers used to be stored as float64
+		err = tx.CreateStore(index.StorePrefix + "foo" + "\x1e" + string(byte(index.Float)))
+		require.NoError(t, err)
+		st, err := tx.Store(index.StorePrefix + "foo" + "\x1e" + string(byte(index.Float)))
+		require.NoError(t, err)
+		err = st.Put([]byte{byte(index.Float), 0x1E, 0xC0, 0, 0, 0, 0, 0, 0, 0}, []byte("a"))
+		require.NoError(t, err)
+
+		idx := index.NewUniqueIndex(tx, "foo")
+		err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+			return nil
+		})
+		require.Equal(t, index.ErrOutdatedEncoding, err)
+	})
+}
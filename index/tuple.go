@@ -0,0 +1,177 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+)
+
+// Tuples are encoded by concatenating the encoding of each value, prefixed by a marker
+// that sorts values the same way indexes sort their types. Variable length values are escaped and
+// terminated so that encoded tuples sort like their values compared one after another:
+// tuples sharing the same first values are contiguous, and are sorted by the next value.
+const (
+	// markers of the values that don't have an index type
+	arrayMarker    = byte(Bytes) + 1
+	documentMarker = byte(Bytes) + 2
+
+	escape          byte = 0x00
+	escapedEscape   byte = 0xFF
+	terminatorValue byte = 0x00
+)
+
+// EncodeTuple encodes a list of values into a byte slice whose lexicographic order
+// follows the order of the values, compared one after another.
+// Like in indexes, numbers of all types are compared by value, and strings are encoded like bytes.
+// The encoding of a tuple is a prefix of the encoding of any tuple starting with the same values.
+func EncodeTuple(values []document.Value) ([]byte, error) {
+	var buf []byte
+
+	for _, v := range values {
+		var err error
+		buf, err = appendTupleValue(buf, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
+
+func appendTupleValue(buf []byte, v document.Value) ([]byte, error) {
+	switch v.Type {
+	case document.DocumentValue, document.ArrayValue:
+		data, err := encoding.EncodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		marker := arrayMarker
+		if v.Type == document.DocumentValue {
+			marker = documentMarker
+		}
+
+		return appendEscaped(append(buf, marker), data), nil
+	}
+
+	t := NewTypeFromValueType(v.Type)
+	buf = append(buf, byte(t))
+
+	if t == Null {
+		return buf, nil
+	}
+
+	data, err := encodeFieldToIndexValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == Bytes {
+		return appendEscaped(buf, data), nil
+	}
+
+	return append(buf, data...), nil
+}
+
+// appendEscaped appends data followed by a terminator. Escaping makes sure
+// the terminator sorts before any other byte.
+func appendEscaped(buf, data []byte) []byte {
+	for _, c := range data {
+		buf = append(buf, c)
+		if c == escape {
+			buf = append(buf, escapedEscape)
+		}
+	}
+
+	return append(buf, escape, terminatorValue)
+}
+
+// DecodeTuple decodes a tuple encoded with EncodeTuple.
+// Numbers are returned as float64, unless they are integers that a float64 can't represent exactly,
+// and strings are returned as bytes.
+func DecodeTuple(data []byte) ([]document.Value, error) {
+	var values []document.Value
+
+	for len(data) > 0 {
+		v, n, err := decodeTupleValue(data)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+		data = data[n:]
+	}
+
+	return values, nil
+}
+
+// decodeTupleValue decodes the first value of the tuple and returns the number of bytes read.
+func decodeTupleValue(data []byte) (document.Value, int, error) {
+	marker := data[0]
+	data = data[1:]
+
+	switch marker {
+	case byte(Null):
+		return document.NewNullValue(), 1, nil
+	case byte(Bool):
+		if len(data) < 1 {
+			return document.Value{}, 0, errors.New("cannot decode tuple: invalid bool")
+		}
+
+		v, err := decodeIndexValueToField(Bool, data[:1])
+		return v, 2, err
+	case byte(Float):
+		if len(data) < numberSize {
+			return document.Value{}, 0, errors.New("cannot decode tuple: invalid number")
+		}
+
+		v, err := decodeNumber(data[:numberSize])
+		return v, numberSize + 1, err
+	case byte(Bytes), arrayMarker, documentMarker:
+		b, n, err := readEscaped(data)
+		if err != nil {
+			return document.Value{}, 0, err
+		}
+
+		var v document.Value
+		switch marker {
+		case arrayMarker:
+			v, err = encoding.DecodeValue(document.ArrayValue, b)
+		case documentMarker:
+			v, err = encoding.DecodeValue(document.DocumentValue, b)
+		default:
+			v = document.NewBytesValue(b)
+		}
+
+		return v, n + 1, err
+	}
+
+	return document.Value{}, 0, fmt.Errorf("cannot decode tuple: unknown marker %d", marker)
+}
+
+// readEscaped reads the escaped data until the terminator and returns the unescaped data
+// and the number of bytes read, including the terminator.
+func readEscaped(data []byte) ([]byte, int, error) {
+	var b []byte
+
+	for i := 0; i < len(data)-1; i++ {
+		if data[i] != escape {
+			b = append(b, data[i])
+			continue
+		}
+
+		switch data[i+1] {
+		case terminatorValue:
+			return b, i + 2, nil
+		case escapedEscape:
+			b = append(b, escape)
+			i++
+		default:
+			return nil, 0, errors.New("cannot decode tuple: invalid escape sequence")
+		}
+	}
+
+	return nil, 0, errors.New("cannot decode tuple: missing terminator")
+}
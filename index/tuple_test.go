@@ -0,0 +1,116 @@
+package index_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/index"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeTuple(t *testing.T) {
+	// tuples in increasing order
+	tuples := [][]document.Value{
+		{},
+		{document.NewNullValue()},
+		{document.NewNullValue(), document.NewIntValue(1)},
+		{document.NewBoolValue(false)},
+		{document.NewBoolValue(true), document.NewNullValue()},
+		{document.NewFloat64Value(-10.5), document.NewStringValue("z")},
+		{document.NewIntValue(-1), document.NewStringValue("a")},
+		{document.NewIntValue(1)},
+		{document.NewIntValue(1), document.NewNullValue()},
+		{document.NewIntValue(1), document.NewIntValue(-5)},
+		{document.NewIntValue(1), document.NewIntValue(2)},
+		{document.NewIntValue(1), document.NewStringValue("")},
+		{document.NewIntValue(1), document.NewStringValue("a")},
+		{document.NewIntValue(1), document.NewStringValue("a\x00")},
+		{document.NewIntValue(1), document.NewStringValue("a\x00b")},
+		{document.NewIntValue(1), document.NewStringValue("a\x01")},
+		{document.NewIntValue(1), document.NewStringValue("ab")},
+		{document.NewInt8Value(2), document.NewIntValue(0)},
+		{document.NewStringValue("a"), document.NewIntValue(10)},
+		{document.NewStringValue("a"), document.NewStringValue("a")},
+		{document.NewStringValue("ab"), document.NewIntValue(1)},
+		{document.NewBytesValue([]byte("b"))},
+	}
+
+	var prev []byte
+	for i, tup := range tuples {
+		enc, err := index.EncodeTuple(tup)
+		require.NoError(t, err)
+
+		if i > 0 {
+			require.Equal(t, -1, bytes.Compare(prev, enc), "%v should be lower than %v", tuples[i-1], tup)
+		}
+		prev = enc
+	}
+}
+
+func TestEncodeTuplePrefix(t *testing.T) {
+	prefix, err := index.EncodeTuple([]document.Value{document.NewStringValue("a"), document.NewIntValue(1)})
+	require.NoError(t, err)
+
+	enc, err := index.EncodeTuple([]document.Value{document.NewStringValue("a"), document.NewIntValue(1), document.NewStringValue("b")})
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(enc, prefix))
+
+	enc, err = index.EncodeTuple([]document.Value{document.NewStringValue("ab"), document.NewIntValue(1)})
+	require.NoError(t, err)
+	require.False(t, bytes.HasPrefix(enc, prefix))
+}
+
+func TestDecodeTuple(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []document.Value
+		expected []document.Value
+	}{
+		{"Empty", nil, nil},
+		{"Null", []document.Value{document.NewNullValue()}, []document.Value{document.NewNullValue()}},
+		{"Scalars",
+			[]document.Value{document.NewBoolValue(true), document.NewIntValue(10), document.NewStringValue("a\x00b"), document.NewNullValue()},
+			[]document.Value{document.NewBoolValue(true), document.NewFloat64Value(10), document.NewBytesValue([]byte("a\x00b")), document.NewNullValue()},
+		},
+		{"Array and document",
+			[]document.Value{
+				document.NewArrayValue(document.NewValueBuffer(document.NewIntValue(1), document.NewStringValue("a"))),
+				document.NewDocumentValue(document.NewFieldBuffer().Add("a", document.NewBoolValue(true))),
+				document.NewFloat64Value(1.5),
+			},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enc, err := index.EncodeTuple(test.values)
+			require.NoError(t, err)
+
+			values, err := index.DecodeTuple(enc)
+			require.NoError(t, err)
+
+			if test.expected == nil && len(test.values) > 0 {
+				// compare the values of types that are not converted
+				require.Len(t, values, len(test.values))
+				for i := range values {
+					ok, err := test.values[i].IsEqual(values[i])
+					require.NoError(t, err)
+					require.True(t, ok, "expected %v, got %v", test.values[i], values[i])
+				}
+				return
+			}
+
+			require.Equal(t, test.expected, values)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := index.DecodeTuple([]byte{byte(index.Float), 1, 2})
+		require.Error(t, err)
+
+		_, err = index.DecodeTuple([]byte{byte(index.Bytes), 'a'})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseAlterStatement parses an alter string and returns a Statement AST object.
+// This function assumes the ALTER token has already been consumed.
+func (p *Parser) parseAlterStatement() (query.Statement, error) {
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.TABLE {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"TABLE"}, pos)
+	}
+
+	// Parse table name
+	tableName, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch {
+	case tok == scanner.IDENT && strings.EqualFold(lit, "RENAME"):
+		return p.parseAlterTableRenameStatement(tableName)
+	case tok == scanner.IDENT && strings.EqualFold(lit, "ADD"):
+		return p.parseAlterTableAddFieldStatement(tableName)
+	case tok == scanner.DROP:
+		return p.parseAlterTableDropFieldStatement(tableName)
+	case tok == scanner.SET:
+		return p.parseAlterTableSetPrimaryKeyStatement(tableName)
+	}
+
+	return nil, newParseError(scanner.Tokstr(tok, lit), []string{"RENAME", "ADD", "DROP", "SET"}, pos)
+}
+
+// parseAlterTableRenameStatement parses the new name of the table.
+// This function assumes the ALTER TABLE table_name RENAME tokens have already been consumed.
+func (p *Parser) parseAlterTableRenameStatement(tableName string) (query.AlterTableRenameStmt, error) {
+	stmt := query.AlterTableRenameStmt{TableName: tableName}
+	var err error
+
+	// Parse "TO"
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.TO {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"TO"}, pos)
+	}
+
+	// Parse new table name
+	stmt.NewTableName, err = p.parseIdent()
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
+
+// parseAlterTableAddFieldStatement parses the path, the type and the constraints of the added field constraint.
+// This function assumes the ALTER TABLE table_name ADD tokens have already been consumed.
+func (p *Parser) parseAlterTableAddFieldStatement(tableName string) (query.AlterTableAddFieldStmt, error) {
+	stmt := query.AlterTableAddFieldStmt{TableName: tableName}
+	var err error
+
+	err = p.parseFieldKeyword()
+	if err != nil {
+		return stmt, err
+	}
+
+	stmt.Constraint.Path, err = p.parseFieldRef()
+	if err != nil {
+		return stmt, err
+	}
+
+	stmt.Constraint.Type, err = p.parseType()
+	if err != nil {
+		return stmt, err
+	}
+
+	isPrimaryKey, err := p.parseFieldConstraints(&stmt.Constraint)
+	if err != nil {
+		return stmt, err
+	}
+	if isPrimaryKey {
+		return stmt, &ParseError{Message: "a field can't be added as the primary key, use SET PRIMARY KEY"}
+	}
+
+	return stmt, nil
+}
+
+// parseAlterTableDropFieldStatement parses the path of the dropped field constraint.
+// This function assumes the ALTER TABLE table_name DROP tokens have already been consumed.
+func (p *Parser) parseAlterTableDropFieldStatement(tableName string) (query.AlterTableDropFieldStmt, error) {
+	stmt := query.AlterTableDropFieldStmt{TableName: tableName}
+	var err error
+
+	err = p.parseFieldKeyword()
+	if err != nil {
+		return stmt, err
+	}
+
+	stmt.Path, err = p.parseFieldRef()
+	if err != nil {
+		return stmt, err
+	}
+
+	return stmt, nil
+}
+
+// parseAlterTableSetPrimaryKeyStatement parses the paths of the new primary key.
+// This function assumes the ALTER TABLE table_name SET tokens have already been consumed.
+func (p *Parser) parseAlterTableSetPrimaryKeyStatement(tableName string) (query.AlterTableSetPrimaryKeyStmt, error) {
+	stmt := query.AlterTableSetPrimaryKeyStmt{TableName: tableName}
+
+	// Parse "PRIMARY"
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.PRIMARY {
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"PRIMARY"}, pos)
+	}
+
+	// Parse "KEY (path, ...)"
+	var cfg database.TableConfig
+	err := p.parsePrimaryKeyConstraint(&cfg)
+	if err != nil {
+		return stmt, err
+	}
+	stmt.Paths = cfg.PrimaryKeyPaths
+
+	return stmt, nil
+}
+
+// parseFieldKeyword parses the FIELD keyword, which is not reserved.
+func (p *Parser) parseFieldKeyword() error {
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.IDENT || !strings.EqualFold(lit, "FIELD") {
+		return newParseError(scanner.Tokstr(tok, lit), []string{"FIELD"}, pos)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserAlterTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Rename", "ALTER TABLE foo RENAME TO bar", query.AlterTableRenameStmt{TableName: "foo", NewTableName: "bar"}, false},
+		{"Rename / lowercase", "alter table foo rename to bar", query.AlterTableRenameStmt{TableName: "foo", NewTableName: "bar"}, false},
+		{"Rename / missing TO", "ALTER TABLE foo RENAME bar", nil, true},
+		{"Rename / missing name", "ALTER TABLE foo RENAME TO", nil, true},
+		{"Add field", "ALTER TABLE foo ADD FIELD a INTEGER", query.AlterTableAddFieldStmt{
+			TableName:  "foo",
+			Constraint: database.FieldConstraint{Path: document.NewValuePath("a"), Type: document.IntValue},
+		}, false},
+		{"Add field / nested", "ALTER TABLE foo ADD FIELD a.b TEXT", query.AlterTableAddFieldStmt{
+			TableName:  "foo",
+			Constraint: database.FieldConstraint{Path: []string{"a", "b"}, Type: document.StringValue},
+		}, false},
+		{"Add field / constraints", "ALTER TABLE foo ADD FIELD a INTEGER NOT NULL UNIQUE DEFAULT 10 REFERENCES bar(b)", query.AlterTableAddFieldStmt{
+			TableName: "foo",
+			Constraint: database.FieldConstraint{
+				Path:         document.NewValuePath("a"),
+				Type:         document.IntValue,
+				NotNull:      true,
+				Unique:       true,
+				DefaultValue: document.NewInt8Value(10),
+				References:   database.ForeignKey{Table: "bar", Path: document.NewValuePath("b")},
+			},
+		}, false},
+		{"Add field / primary key", "ALTER TABLE foo ADD FIELD a INTEGER PRIMARY KEY", nil, true},
+		{"Add field / duplicate constraint", "ALTER TABLE foo ADD FIELD a INTEGER NOT NULL NOT NULL", nil, true},
+		{"Add field / missing type", "ALTER TABLE foo ADD FIELD a", nil, true},
+		{"Add field / missing FIELD", "ALTER TABLE foo ADD a INTEGER", nil, true},
+		{"Drop field", "ALTER TABLE foo DROP FIELD a", query.AlterTableDropFieldStmt{TableName: "foo", Path: document.NewValuePath("a")}, false},
+		{"Drop field / missing path", "ALTER TABLE foo DROP FIELD", nil, true},
+		{"Set primary key", "ALTER TABLE foo SET PRIMARY KEY (a)", query.AlterTableSetPrimaryKeyStmt{
+			TableName: "foo",
+			Paths:     []document.ValuePath{document.NewValuePath("a")},
+		}, false},
+		{"Set primary key / composite", "ALTER TABLE foo SET PRIMARY KEY (a, b.c)", query.AlterTableSetPrimaryKeyStmt{
+			TableName: "foo",
+			Paths:     []document.ValuePath{document.NewValuePath("a"), []string{"b", "c"}},
+		}, false},
+		{"Set primary key / missing paths", "ALTER TABLE foo SET PRIMARY KEY", nil, true},
+		{"Set primary key / duplicate path", "ALTER TABLE foo SET PRIMARY KEY (a, a)", nil, true},
+		{"Missing TABLE", "ALTER foo RENAME TO bar", nil, true},
+		{"Unknown action", "ALTER TABLE foo SET a", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/asdine/genji/sql/scanner"
 )
@@ -80,49 +84,345 @@ func (p *Parser) parseTableConfig(cfg *database.TableConfig) error {
 		return nil
 	}
 
-	var err error
-
 	// Parse constraints.
 	for {
-		var fc database.FieldConstraint
-
-		fc.Path, err = p.parseFieldRef()
+		// Parse "[CONSTRAINT name] CHECK (expr)"
+		isCheck, err := p.parseCheckConstraint(cfg)
 		if err != nil {
+			return err
+		}
+
+		if isCheck {
+			// the CHECK constraint has been added to cfg
+		} else if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.PRIMARY {
+			// Parse "PRIMARY KEY (path, ...)"
+			err = p.parsePrimaryKeyConstraint(cfg)
+			if err != nil {
+				return err
+			}
+		} else {
 			p.Unscan()
+
+			var fc database.FieldConstraint
+
+			fc.Path, err = p.parseFieldRef()
+			if err != nil {
+				p.Unscan()
+				break
+			}
+
+			fc.Type, err = p.parseType()
+			if err != nil {
+				return err
+			}
+
+			isPrimaryKey, err := p.parseFieldConstraints(&fc)
+			if err != nil {
+				return err
+			}
+
+			if isPrimaryKey {
+				if len(cfg.PrimaryKey.Path) != 0 || len(cfg.PrimaryKeyPaths) != 0 {
+					return &ParseError{Message: "only one primary key is allowed"}
+				}
+				cfg.PrimaryKey = fc
+			} else {
+				cfg.FieldConstraints = append(cfg.FieldConstraints, fc)
+			}
+		}
+
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
+			p.Unscan()
+			break
+		}
+	}
+
+	// Parse required ) token.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+		return newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	// a primary key on a single field with a type is a regular primary key
+	if len(cfg.PrimaryKeyPaths) == 1 {
+		for i, fc := range cfg.FieldConstraints {
+			if fc.Path.String() != cfg.PrimaryKeyPaths[0].String() {
+				continue
+			}
+
+			cfg.PrimaryKey = fc
+			cfg.PrimaryKeyPaths = nil
+			cfg.FieldConstraints = append(cfg.FieldConstraints[:i], cfg.FieldConstraints[i+1:]...)
+			if len(cfg.FieldConstraints) == 0 {
+				cfg.FieldConstraints = nil
+			}
 			break
 		}
+	}
+
+	return nil
+}
+
+// parseCheckConstraint parses a "CHECK (expr)" or a "CONSTRAINT name CHECK (expr)" clause
+// and adds it to cfg. It returns false without consuming anything if the next tokens are not a CHECK constraint,
+// which allows fields to be named check or constraint.
+func (p *Parser) parseCheckConstraint(cfg *database.TableConfig) (bool, error) {
+	var c database.CheckConstraint
+	var err error
+
+	tok, _, lit := p.ScanIgnoreWhitespace()
+	switch {
+	case tok == scanner.IDENT && strings.EqualFold(lit, "CONSTRAINT"):
+		if !p.keywordFollowedBy(scanner.IDENT) {
+			return false, nil
+		}
 
-		fc.Type, err = p.parseType()
+		// Parse constraint name
+		c.Name, err = p.parseIdent()
 		if err != nil {
-			return err
+			return false, err
+		}
+
+		// Parse "CHECK"
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.IDENT || !strings.EqualFold(lit, "CHECK") {
+			return false, newParseError(scanner.Tokstr(tok, lit), []string{"CHECK"}, pos)
+		}
+	case tok == scanner.IDENT && strings.EqualFold(lit, "CHECK"):
+		if !p.keywordFollowedBy(scanner.LPAREN) {
+			return false, nil
 		}
+	default:
+		p.Unscan()
+		return false, nil
+	}
+
+	// Parse ( token.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
+		return false, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	params := p.orderedParams + p.namedParams
+	e, err := p.parseExpr()
+	if err != nil {
+		return false, err
+	}
+	if p.orderedParams+p.namedParams != params {
+		return false, &ParseError{Message: "check constraints can't contain parameters"}
+	}
+	if _, err := query.NewCheckFunc(e); err != nil {
+		return false, &ParseError{Message: err.Error()}
+	}
+
+	// Parse required ) token.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+		return false, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	c.Expr = fmt.Sprint(e)
+	cfg.Checks = append(cfg.Checks, c)
+	return true, nil
+}
+
+// keywordFollowedBy reports whether the contextual keyword that was just scanned is followed by
+// the next token, ignoring whitespace. If it isn't, the keyword is unscanned as well
+// so that it can be parsed as an identifier.
+func (p *Parser) keywordFollowedBy(next scanner.Token) bool {
+	tok, _, _ := p.Scan()
+	n := 1
+	if tok == scanner.WS {
+		tok, _, _ = p.Scan()
+		n++
+	}
+
+	if tok == next {
+		p.Unscan()
+		return true
+	}
+
+	for i := 0; i <= n; i++ {
+		p.Unscan()
+	}
+	return false
+}
 
-		// Parse "PRIMARY"
-		if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.PRIMARY {
+// parseFieldConstraints parses the constraints following the type of a field, in any order:
+// PRIMARY KEY, NOT NULL, UNIQUE, DEFAULT value and REFERENCES. It returns true if the field is the primary key.
+func (p *Parser) parseFieldConstraints(fc *database.FieldConstraint) (bool, error) {
+	var isPrimaryKey bool
+
+	for {
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		switch {
+		case tok == scanner.PRIMARY:
 			// Parse "KEY"
 			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.KEY {
-				return newParseError(scanner.Tokstr(tok, lit), []string{"KEY"}, pos)
+				return false, newParseError(scanner.Tokstr(tok, lit), []string{"KEY"}, pos)
 			}
-			if len(cfg.PrimaryKey.Path) != 0 {
-				return &ParseError{Message: "only one primary key is allowed"}
+			if isPrimaryKey {
+				return false, &ParseError{Message: "duplicate PRIMARY KEY constraint", Pos: pos}
+			}
+			isPrimaryKey = true
+		case tok == scanner.NOT:
+			// Parse "NULL"
+			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.NULL {
+				return false, newParseError(scanner.Tokstr(tok, lit), []string{"NULL"}, pos)
+			}
+			if fc.NotNull {
+				return false, &ParseError{Message: "duplicate NOT NULL constraint", Pos: pos}
+			}
+			fc.NotNull = true
+		case tok == scanner.UNIQUE:
+			if fc.Unique {
+				return false, &ParseError{Message: "duplicate UNIQUE constraint", Pos: pos}
+			}
+			fc.Unique = true
+		case tok == scanner.IDENT && strings.EqualFold(lit, "DEFAULT"):
+			if fc.HasDefaultValue() {
+				return false, &ParseError{Message: "duplicate DEFAULT constraint", Pos: pos}
 			}
-			cfg.PrimaryKey = fc
-		} else {
-			p.Unscan()
-			cfg.FieldConstraints = append(cfg.FieldConstraints, fc)
-		}
 
-		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
+			v, err := p.parseDefaultValue()
+			if err != nil {
+				return false, err
+			}
+			fc.DefaultValue = v
+		case tok == scanner.IDENT && strings.EqualFold(lit, "REFERENCES"):
+			if fc.References.Table != "" {
+				return false, &ParseError{Message: "duplicate REFERENCES constraint", Pos: pos}
+			}
+
+			err := p.parseForeignKey(&fc.References)
+			if err != nil {
+				return false, err
+			}
+		default:
 			p.Unscan()
-			break
+			return isPrimaryKey, nil
 		}
 	}
+}
+
+// parseForeignKey parses "table_name (path) [ON DELETE action] [ON UPDATE action]".
+// This function assumes the REFERENCES token has already been consumed.
+func (p *Parser) parseForeignKey(fk *database.ForeignKey) error {
+	var err error
+
+	// Parse referenced table name
+	fk.Table, err = p.parseIdent()
+	if err != nil {
+		return err
+	}
+
+	// Parse referenced path
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
+		return newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	fk.Path, err = p.parseFieldRef()
+	if err != nil {
+		return err
+	}
 
-	// Parse required ) token.
 	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
 		return newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
 	}
 
+	// Parse "ON DELETE" and "ON UPDATE", in any order
+	var onDelete, onUpdate bool
+	for {
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ON {
+			p.Unscan()
+			return nil
+		}
+
+		var action *database.ForeignKeyAction
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		switch {
+		case tok == scanner.DELETE && !onDelete:
+			onDelete, action = true, &fk.OnDelete
+		case tok == scanner.UPDATE && !onUpdate:
+			onUpdate, action = true, &fk.OnUpdate
+		default:
+			return newParseError(scanner.Tokstr(tok, lit), []string{"DELETE", "UPDATE"}, pos)
+		}
+
+		*action, err = p.parseForeignKeyAction()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseForeignKeyAction parses "RESTRICT", "CASCADE" or "SET NULL".
+func (p *Parser) parseForeignKeyAction() (database.ForeignKeyAction, error) {
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch {
+	case tok == scanner.IDENT && strings.EqualFold(lit, "RESTRICT"):
+		return database.ForeignKeyRestrict, nil
+	case tok == scanner.IDENT && strings.EqualFold(lit, "CASCADE"):
+		return database.ForeignKeyCascade, nil
+	case tok == scanner.SET:
+		// Parse "NULL"
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.NULL {
+			return 0, newParseError(scanner.Tokstr(tok, lit), []string{"NULL"}, pos)
+		}
+		return database.ForeignKeySetNull, nil
+	}
+
+	return 0, newParseError(scanner.Tokstr(tok, lit), []string{"RESTRICT", "CASCADE", "SET NULL"}, pos)
+}
+
+// parseDefaultValue parses the value following the DEFAULT keyword,
+// which must be a literal string, number or boolean.
+func (p *Parser) parseDefaultValue() (document.Value, error) {
+	_, pos, _ := p.ScanIgnoreWhitespace()
+	p.Unscan()
+
+	e, err := p.parseUnaryExpr()
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	if lv, ok := e.(query.LiteralValue); ok {
+		switch lv.Type {
+		case document.NullValue, document.DocumentValue, document.ArrayValue:
+		default:
+			return document.Value(lv), nil
+		}
+	}
+
+	return document.Value{}, &ParseError{Message: "default value must be a string, a number or a boolean", Pos: pos}
+}
+
+// parsePrimaryKeyConstraint parses a primary key declared after the fields, which can be composed of several fields.
+// This function assumes the PRIMARY token has already been consumed.
+func (p *Parser) parsePrimaryKeyConstraint(cfg *database.TableConfig) error {
+	// Parse "KEY"
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.KEY {
+		return newParseError(scanner.Tokstr(tok, lit), []string{"KEY"}, pos)
+	}
+
+	if len(cfg.PrimaryKey.Path) != 0 || len(cfg.PrimaryKeyPaths) != 0 {
+		return &ParseError{Message: "only one primary key is allowed"}
+	}
+
+	paths, err := p.parsePathList()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		return newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	for i, path := range paths {
+		for _, other := range paths[:i] {
+			if path.String() == other.String() {
+				return &ParseError{Message: "field " + path.String() + " is used more than once in the primary key"}
+			}
+		}
+	}
+
+	cfg.PrimaryKeyPaths = paths
 	return nil
 }
 
@@ -177,11 +477,11 @@ func (p *Parser) parseCreateIndexStatement(unique bool) (query.CreateIndexStmt,
 		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
 	}
 
-	if len(paths) != 1 {
-		return stmt, &ParseError{Message: "indexes on more than one field are not supported"}
+	if len(paths) == 1 {
+		stmt.Path = paths[0]
+	} else {
+		stmt.Paths = paths
 	}
 
-	stmt.Path = paths[0]
-
 	return stmt, nil
 }
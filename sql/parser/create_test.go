@@ -36,6 +36,114 @@ func TestParserCreateTable(t *testing.T) {
 					},
 				},
 			}, false},
+		{"With composite primary key", "CREATE TABLE test(foo INT, PRIMARY KEY (bar.baz, foo))",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					PrimaryKeyPaths: []document.ValuePath{document.NewValuePath("bar.baz"), document.NewValuePath("foo")},
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"foo"}, Type: document.IntValue},
+					},
+				},
+			}, false},
+		{"With primary key constraint on one typed field", "CREATE TABLE test(foo INT, PRIMARY KEY (foo))",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					PrimaryKey: database.FieldConstraint{Path: []string{"foo"}, Type: document.IntValue},
+				},
+			}, false},
+		{"With primary key constraint on one field", "CREATE TABLE test(PRIMARY KEY (foo))",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					PrimaryKeyPaths: []document.ValuePath{document.NewValuePath("foo")},
+				},
+			}, false},
+		{"With two primary keys", "CREATE TABLE test(foo INT PRIMARY KEY, PRIMARY KEY (foo, bar))", nil, true},
+		{"With duplicate primary key fields", "CREATE TABLE test(PRIMARY KEY (foo, foo))", nil, true},
+		{"With empty primary key", "CREATE TABLE test(PRIMARY KEY)", nil, true},
+		{"With field constraints", "CREATE TABLE test(email TEXT NOT NULL UNIQUE, created INT64 DEFAULT 0, name TEXT DEFAULT 'unknown' NOT NULL)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"email"}, Type: document.StringValue, NotNull: true, Unique: true},
+						{Path: []string{"created"}, Type: document.Int64Value, DefaultValue: document.NewInt8Value(0)},
+						{Path: []string{"name"}, Type: document.StringValue, NotNull: true, DefaultValue: document.NewStringValue("unknown")},
+					},
+				},
+			}, false},
+		{"With field constraints on the primary key", "CREATE TABLE test(foo INT NOT NULL PRIMARY KEY DEFAULT -1)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					PrimaryKey: database.FieldConstraint{Path: []string{"foo"}, Type: document.IntValue, NotNull: true, DefaultValue: document.NewInt8Value(-1)},
+				},
+			}, false},
+		{"With duplicate NOT NULL", "CREATE TABLE test(foo INT NOT NULL NOT NULL)", nil, true},
+		{"With duplicate UNIQUE", "CREATE TABLE test(foo INT UNIQUE UNIQUE)", nil, true},
+		{"With duplicate DEFAULT", "CREATE TABLE test(foo INT DEFAULT 1 DEFAULT 2)", nil, true},
+		{"With NOT without NULL", "CREATE TABLE test(foo INT NOT)", nil, true},
+		{"With DEFAULT without value", "CREATE TABLE test(foo INT DEFAULT)", nil, true},
+		{"With non literal DEFAULT", "CREATE TABLE test(foo INT DEFAULT bar)", nil, true},
+		{"With NULL DEFAULT", "CREATE TABLE test(foo INT DEFAULT NULL)", nil, true},
+		{"With check constraints", "CREATE TABLE test(price NUMERIC, CHECK (price >= 0), CONSTRAINT valid_range CHECK(end > start AND start > 0))",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"price"}, Type: document.Float64Value},
+					},
+					Checks: []database.CheckConstraint{
+						{Expr: "price >= 0"},
+						{Name: "valid_range", Expr: "end > start AND start > 0"},
+					},
+				},
+			}, false},
+		{"With fields named check and constraint", "CREATE TABLE test(check INT, constraint TEXT)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"check"}, Type: document.IntValue},
+						{Path: []string{"constraint"}, Type: document.StringValue},
+					},
+				},
+			}, false},
+		{"With check constraint without parentheses", "CREATE TABLE test(CONSTRAINT foo CHECK a > 0)", nil, true},
+		{"With named constraint without CHECK", "CREATE TABLE test(CONSTRAINT foo (a > 0))", nil, true},
+		{"With unclosed check constraint", "CREATE TABLE test(CHECK (a > 0)", nil, true},
+		{"With check constraint with params", "CREATE TABLE test(CHECK (a > ?))", nil, true},
+		{"With check constraint with aggregate", "CREATE TABLE test(CHECK (COUNT(*) > 1))", nil, true},
+		{"With check constraint with subquery", "CREATE TABLE test(CHECK (a IN (SELECT b FROM c)))", nil, true},
+		{"With foreign keys", "CREATE TABLE test(a INT REFERENCES foo(id), b TEXT NOT NULL REFERENCES bar (c.d) ON DELETE CASCADE, e INT REFERENCES baz(id) ON DELETE SET NULL, f INT REFERENCES foo(id) on delete restrict)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"a"}, Type: document.IntValue, References: database.ForeignKey{Table: "foo", Path: []string{"id"}}},
+						{Path: []string{"b"}, Type: document.StringValue, NotNull: true, References: database.ForeignKey{Table: "bar", Path: []string{"c", "d"}, OnDelete: database.ForeignKeyCascade}},
+						{Path: []string{"e"}, Type: document.IntValue, References: database.ForeignKey{Table: "baz", Path: []string{"id"}, OnDelete: database.ForeignKeySetNull}},
+						{Path: []string{"f"}, Type: document.IntValue, References: database.ForeignKey{Table: "foo", Path: []string{"id"}, OnDelete: database.ForeignKeyRestrict}},
+					},
+				},
+			}, false},
+		{"With foreign key actions", "CREATE TABLE test(a INT REFERENCES foo(id) ON UPDATE CASCADE ON DELETE SET NULL)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Config: database.TableConfig{
+					FieldConstraints: []database.FieldConstraint{
+						{Path: []string{"a"}, Type: document.IntValue, References: database.ForeignKey{Table: "foo", Path: []string{"id"}, OnDelete: database.ForeignKeySetNull, OnUpdate: database.ForeignKeyCascade}},
+					},
+				},
+			}, false},
+		{"With foreign key with duplicate action", "CREATE TABLE test(a INT REFERENCES foo(id) ON UPDATE CASCADE ON UPDATE RESTRICT)", nil, true},
+		{"With foreign key without path", "CREATE TABLE test(a INT REFERENCES foo)", nil, true},
+		{"With foreign key without table", "CREATE TABLE test(a INT REFERENCES (id))", nil, true},
+		{"With foreign key with unknown action", "CREATE TABLE test(a INT REFERENCES foo(id) ON DELETE IGNORE)", nil, true},
+		{"With foreign key with SET without NULL", "CREATE TABLE test(a INT REFERENCES foo(id) ON DELETE SET)", nil, true},
+		{"With duplicate foreign keys", "CREATE TABLE test(a INT REFERENCES foo(id) REFERENCES bar(id))", nil, true},
 	}
 
 	for _, test := range tests {
@@ -62,8 +170,9 @@ func TestParserCreateIndex(t *testing.T) {
 		{"Basic", "CREATE INDEX idx ON test (foo)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo")}, false},
 		{"If not exists", "CREATE INDEX IF NOT EXISTS idx ON test (foo.bar.1)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo.bar.1"), IfNotExists: true}, false},
 		{"Unique", "CREATE UNIQUE INDEX IF NOT EXISTS idx ON test (foo.3.baz)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.NewValuePath("foo.3.baz"), IfNotExists: true, Unique: true}, false},
+		{"Composite", "CREATE INDEX idx ON test (foo, bar.baz)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Paths: []document.ValuePath{document.NewValuePath("foo"), document.NewValuePath("bar.baz")}}, false},
 		{"No fields", "CREATE INDEX idx ON test", nil, true},
-		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar)", nil, true},
+		{"Trailing comma", "CREATE INDEX idx ON test (foo, )", nil, true},
 	}
 
 	for _, test := range tests {
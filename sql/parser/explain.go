@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseExplainStatement parses an explain string and returns a Statement AST object.
+// This function assumes the EXPLAIN token has already been consumed.
+func (p *Parser) parseExplainStatement() (query.ExplainStmt, error) {
+	var stmt query.ExplainStmt
+	var err error
+
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	switch tok {
+	case scanner.SELECT:
+		stmt.Statement, err = p.parseSelectStatement()
+	case scanner.UPDATE:
+		stmt.Statement, err = p.parseUpdateStatement()
+	case scanner.DELETE:
+		stmt.Statement, err = p.parseDeleteStatement()
+	default:
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"SELECT", "UPDATE", "DELETE"}, pos)
+	}
+
+	return stmt, err
+}
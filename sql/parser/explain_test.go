@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserExplain(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"Select", "EXPLAIN SELECT * FROM test WHERE a = 1",
+			query.ExplainStmt{Statement: query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"a"}), query.Int8Value(1)),
+			}}, false},
+		{"Update", "EXPLAIN UPDATE test SET a = 1",
+			query.ExplainStmt{Statement: query.UpdateStmt{
+				TableName: "test",
+				Pairs:     map[string]query.Expr{"a": query.Int8Value(1)},
+			}}, false},
+		{"Delete", "EXPLAIN DELETE FROM test", query.ExplainStmt{Statement: query.DeleteStmt{TableName: "test"}}, false},
+		{"Insert", "EXPLAIN INSERT INTO test (a) VALUES (1)", nil, true},
+		{"Nothing", "EXPLAIN", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, q.Statements, 1)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
@@ -3,7 +3,9 @@ package parser
 import (
 	"fmt"
 	"math"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
@@ -20,49 +22,90 @@ type operator interface {
 
 // parseExpr parses an expression.
 func (p *Parser) parseExpr() (query.Expr, error) {
-	var err error
-	// Dummy root node.
-	var root operator = &query.CmpOp{}
-
 	// Parse a non-binary expression type to start.
 	// This variable will always be the root of the expression tree.
-	e, err := p.parseUnaryExpr()
+	root, err := p.parseUnaryExpr()
 	if err != nil {
 		return nil, err
 	}
-	root.SetRightHandExpr(e)
 
 	// Loop over operations and unary exprs and build a tree based on precendence.
 	for {
 		// If the next token is NOT an operator then return the expression.
-		op, _, _ := p.ScanIgnoreWhitespace()
+		op, pos, lit := p.ScanIgnoreWhitespace()
+
+		var rhs query.Expr
+
+		// the scanner reads a minus sign followed by digits as a negative number,
+		// which in that position is a subtraction, e.g. a -1
+		if (op == scanner.INTEGER || op == scanner.NUMBER) && strings.HasPrefix(lit, "-") {
+			if rhs, err = parseNumber(op, pos, lit[1:]); err != nil {
+				return nil, err
+			}
+			op = scanner.SUB
+		}
+
+		// NOT is only allowed after an expression when followed by IN
+		if op == scanner.NOT {
+			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.IN {
+				return nil, newParseError(scanner.Tokstr(tok, lit), []string{"IN"}, pos)
+			}
+			op = scanner.NIN
+		}
+
+		// IS can be followed by NOT
+		if op == scanner.IS {
+			if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.NOT {
+				op = scanner.ISN
+			} else {
+				p.Unscan()
+			}
+		}
+
 		if !op.IsOperator() {
 			p.Unscan()
-			return root.RightHand(), nil
+			return unwrapParensOperand(root), nil
 		}
 
-		var rhs query.Expr
-
-		if rhs, err = p.parseUnaryExpr(); err != nil {
-			return nil, err
+		// the right-hand operand of regex operators is always a regex
+		if scanner.IsRegexOp(op) {
+			if rhs, err = p.parseRegex(); err != nil {
+				return nil, err
+			}
 		}
 
-		// Find the right spot in the tree to add the new expression by
-		// descending the RHS of the expression tree until we reach the last
-		// BinaryExpr or a BinaryExpr whose RHS has an operator with
-		// precedence >= the operator being added.
-		for node := root.(operator); ; {
-			p, ok := node.RightHand().(operator)
-			if !ok || p.Precedence() >= op.Precedence() {
-				// Add the new expression here and break.
-				node.SetRightHandExpr(opToExpr(op, node.RightHand(), rhs))
-				break
+		if rhs == nil {
+			if rhs, err = p.parseUnaryExpr(); err != nil {
+				return nil, err
 			}
-			node = p
 		}
+
+		root = addOperator(root, op, rhs)
 	}
 }
 
+// addOperator adds the operator op to the tree e, with rhs as its right-hand operand.
+// It descends the right-hand operands of the tree until it reaches an expression that isn't
+// an operator or an operator whose precedence is >= the one of op, and makes it the
+// left-hand operand of op.
+// Comparison operators are values: they are copied and returned with their new right-hand operand.
+func addOperator(e query.Expr, op scanner.Token, rhs query.Expr) query.Expr {
+	switch t := e.(type) {
+	case query.CmpOp:
+		if t.Precedence() < op.Precedence() {
+			t.SetRightHandExpr(addOperator(t.RightHand(), op, rhs))
+			return t
+		}
+	case operator:
+		if t.Precedence() < op.Precedence() {
+			t.SetRightHandExpr(addOperator(t.RightHand(), op, rhs))
+			return e
+		}
+	}
+
+	return opToExpr(op, e, rhs)
+}
+
 func opToExpr(op scanner.Token, lhs, rhs query.Expr) query.Expr {
 	switch op {
 	case scanner.EQ:
@@ -81,16 +124,124 @@ func opToExpr(op scanner.Token, lhs, rhs query.Expr) query.Expr {
 		return query.And(lhs, rhs)
 	case scanner.OR:
 		return query.Or(lhs, rhs)
+	case scanner.EQREGEX, scanner.NEQREGEX:
+		re := rhs.(query.LiteralRegex).Regexp
+		if op == scanner.EQREGEX {
+			return query.EqRegex(lhs, re)
+		}
+		return query.NeqRegex(lhs, re)
+	case scanner.IN:
+		return query.In(lhs, rhs)
+	case scanner.NIN:
+		return query.NotIn(lhs, rhs)
+	case scanner.IS:
+		return query.Is(lhs, rhs)
+	case scanner.ISN:
+		return query.IsNot(lhs, rhs)
+	case scanner.ADD:
+		return query.Add(lhs, rhs)
+	case scanner.SUB:
+		return query.Sub(lhs, rhs)
+	case scanner.MUL:
+		return query.Mul(lhs, rhs)
+	case scanner.DIV:
+		return query.Div(lhs, rhs)
+	case scanner.MOD:
+		return query.Mod(lhs, rhs)
+	case scanner.BITWISEAND:
+		return query.BitwiseAnd(lhs, rhs)
+	case scanner.BITWISEOR:
+		return query.BitwiseOr(lhs, rhs)
+	case scanner.BITWISEXOR:
+		return query.BitwiseXor(lhs, rhs)
 	}
 
 	panic(fmt.Sprintf("unknown operator %q", op))
 }
 
-// parseUnaryExpr parses an non-binary expression.
+// parentheses groups an expression while the tree of operators is built, so that its operators
+// don't take part in the precedence of the operators around it, e.g. (a + b) * c.
+// It is removed from the tree by unwrapParens.
+type parentheses struct {
+	query.Expr
+}
+
+// unwrapParens replaces the operands of the operators of the tree that are
+// grouped by parentheses by the grouped expressions.
+// It must be called once the tree is built, to preserve the precedence of the grouped expressions.
+func unwrapParens(e query.Expr) query.Expr {
+	switch t := e.(type) {
+	case query.CmpOp:
+		t.SetLeftHandExpr(unwrapParensOperand(t.LeftHand()))
+		t.SetRightHandExpr(unwrapParensOperand(t.RightHand()))
+		return t
+	case *query.InOp:
+		t.SetLeftHandExpr(unwrapParensOperand(t.LeftHand()))
+		// the right-hand operand of IN is a list, even with only one value
+		if p, ok := t.RightHand().(parentheses); ok {
+			t.SetRightHandExpr(query.LiteralExprList{unwrapParensOperand(p.Expr)})
+		}
+	case operator:
+		t.SetLeftHandExpr(unwrapParensOperand(t.LeftHand()))
+		t.SetRightHandExpr(unwrapParensOperand(t.RightHand()))
+	}
+
+	return e
+}
+
+// unwrapParensOperand returns the expression grouped by e if e is grouped by parentheses,
+// and unwraps the operands of that expression.
+func unwrapParensOperand(e query.Expr) query.Expr {
+	for {
+		p, ok := e.(parentheses)
+		if !ok {
+			break
+		}
+		e = p.Expr
+	}
+
+	return unwrapParens(e)
+}
+
+// parseUnaryExpr parses an non-binary expression, optionally followed by one or more casts,
+// e.g. a::INT64::TEXT.
 func (p *Parser) parseUnaryExpr() (query.Expr, error) {
+	e, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseCasts(e)
+}
+
+// parseCasts parses the :: operators following the expression e, if any.
+func (p *Parser) parseCasts(e query.Expr) (query.Expr, error) {
+	for {
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.DOUBLECOLON {
+			p.Unscan()
+			return e, nil
+		}
+
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+
+		// parentheses only group the expression being cast, e.g. (a + 1)::TEXT
+		e = query.CastFunc{Expr: unwrapParensOperand(e), CastAs: t}
+	}
+}
+
+// parseOperand parses a literal, a parameter, a field, a function call or a list.
+func (p *Parser) parseOperand() (query.Expr, error) {
 	tok, pos, lit := p.ScanIgnoreWhitespace()
 	switch tok {
 	case scanner.IDENT:
+		// if the identifier is immediately followed by a left parenthesis, it's a function call.
+		if tok, _, _ := p.Scan(); tok == scanner.LPAREN {
+			return p.parseFunction(lit, pos)
+		}
+		p.Unscan()
 		p.Unscan()
 		field, err := p.parseFieldRef()
 		if err != nil {
@@ -99,6 +250,15 @@ func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 		fs := query.FieldSelector(field)
 		p.stat.exprFields = append(p.stat.exprFields, fs.Name())
 		return fs, nil
+	case scanner.NOT:
+		// the operand of NOT is the unary expression that follows it.
+		// if it is followed by an operator with a higher precedence, parseExpr will
+		// make the resulting binary expression the operand of NOT, i.e. NOT a = 1 is NOT (a = 1)
+		e, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return query.Not(e), nil
 	case scanner.NAMEDPARAM:
 		if len(lit) == 1 {
 			return nil, &ParseError{Message: "missing param name"}
@@ -116,30 +276,8 @@ func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 		return query.PositionalParam(p.orderedParams), nil
 	case scanner.STRING:
 		return query.StringValue(lit), nil
-	case scanner.NUMBER:
-		v, err := strconv.ParseFloat(lit, 64)
-		if err != nil {
-			return nil, &ParseError{Message: "unable to parse number", Pos: pos}
-		}
-		return query.Float64Value(v), nil
-	case scanner.INTEGER:
-		v, err := strconv.ParseInt(lit, 10, 64)
-		if err != nil {
-			// The literal may be too large to fit into an int64. If it is, use an unsigned integer.
-			if v, err := strconv.ParseUint(lit, 10, 64); err == nil {
-				return query.Uint64Value(v), nil
-			}
-			return nil, &ParseError{Message: "unable to parse integer", Pos: pos}
-		}
-		switch {
-		case v >= math.MinInt8 && v <= math.MaxInt8:
-			return query.Int8Value(int8(v)), nil
-		case v >= math.MinInt16 && v <= math.MaxInt16:
-			return query.Int16Value(int16(v)), nil
-		case v >= math.MinInt32 && v <= math.MaxInt32:
-			return query.Int32Value(int32(v)), nil
-		}
-		return query.Int64Value(v), nil
+	case scanner.NUMBER, scanner.INTEGER:
+		return parseNumber(tok, pos, lit)
 	case scanner.TRUE, scanner.FALSE:
 		return query.BoolValue(tok == scanner.TRUE), nil
 	case scanner.NULL:
@@ -152,13 +290,163 @@ func (p *Parser) parseUnaryExpr() (query.Expr, error) {
 		p.Unscan()
 		return p.parseExprList(scanner.LSBRACKET, scanner.RSBRACKET)
 	case scanner.LPAREN:
+		// a parenthesis followed by SELECT starts a subquery
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.SELECT {
+			return p.parseSubquery()
+		}
 		p.Unscan()
-		return p.parseExprList(scanner.LPAREN, scanner.RPAREN)
+		l, err := p.parseExprListItems(scanner.RPAREN)
+		if err != nil {
+			return nil, err
+		}
+		if len(l) == 1 {
+			return parentheses{l[0]}, nil
+		}
+		return l, nil
+	case scanner.EXISTS:
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+		}
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.SELECT {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"SELECT"}, pos)
+		}
+		s, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return query.Exists(s), nil
 	default:
 		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"identifier", "string", "number", "bool"}, pos)
 	}
 }
 
+// parseSubquery parses a SELECT statement followed by a right parenthesis.
+// This function assumes the left parenthesis and the SELECT token have already been consumed.
+func (p *Parser) parseSubquery() (query.Subquery, error) {
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return query.Subquery{}, err
+	}
+
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+		return query.Subquery{}, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	return query.Subquery{Stmt: stmt}, nil
+}
+
+// parseRegex parses a regular expression in the form /pattern/ and compiles it.
+func (p *Parser) parseRegex() (query.Expr, error) {
+	tok, pos, lit := p.s.ScanRegex()
+	switch tok {
+	case scanner.REGEX:
+	case scanner.BADESCAPE:
+		return nil, &ParseError{Message: fmt.Sprintf("bad escape: %s", lit), Pos: pos}
+	case scanner.BADREGEX:
+		return nil, &ParseError{Message: "bad regex", Pos: pos}
+	default:
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"regex"}, pos)
+	}
+
+	re, err := regexp.Compile(lit)
+	if err != nil {
+		return nil, &ParseError{Message: err.Error(), Pos: pos}
+	}
+
+	return query.LiteralRegex{Regexp: re}, nil
+}
+
+// parseNumber parses the literal of a NUMBER or INTEGER token.
+func parseNumber(tok scanner.Token, pos scanner.Pos, lit string) (query.Expr, error) {
+	if tok == scanner.NUMBER {
+		v, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, &ParseError{Message: "unable to parse number", Pos: pos}
+		}
+		return query.Float64Value(v), nil
+	}
+
+	v, err := strconv.ParseInt(lit, 10, 64)
+	if err != nil {
+		// The literal may be too large to fit into an int64. If it is, use an unsigned integer.
+		if v, err := strconv.ParseUint(lit, 10, 64); err == nil {
+			return query.Uint64Value(v), nil
+		}
+		return nil, &ParseError{Message: "unable to parse integer", Pos: pos}
+	}
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return query.Int8Value(int8(v)), nil
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return query.Int16Value(int16(v)), nil
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return query.Int32Value(int32(v)), nil
+	}
+	return query.Int64Value(v), nil
+}
+
+// parseFunction parses a function call.
+// This function assumes the function name and the left parenthesis have already been consumed.
+func (p *Parser) parseFunction(name string, pos scanner.Pos) (query.Expr, error) {
+	var fn query.Expr
+
+	switch strings.ToUpper(name) {
+	case "COUNT":
+		// Parse "*"
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.MUL {
+			fn = query.CountFunc{Wildcard: true}
+			break
+		}
+		p.Unscan()
+
+		path, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
+		}
+		fn = query.CountFunc{Path: query.FieldSelector(path)}
+	case "CAST":
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.AS {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"AS"}, pos)
+		}
+
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		fn = query.CastFunc{Expr: e, CastAs: t}
+	case "SUM", "AVG", "MIN", "MAX":
+		path, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToUpper(name) {
+		case "SUM":
+			fn = query.SumFunc{Path: query.FieldSelector(path)}
+		case "AVG":
+			fn = query.AvgFunc{Path: query.FieldSelector(path)}
+		case "MIN":
+			fn = query.MinFunc{Path: query.FieldSelector(path)}
+		case "MAX":
+			fn = query.MaxFunc{Path: query.FieldSelector(path)}
+		}
+	default:
+		return nil, &ParseError{Message: fmt.Sprintf("unknown function %s", name), Pos: pos}
+	}
+
+	// Parse required ) token.
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	return fn, nil
+}
+
 // parseIdent parses an identifier.
 func (p *Parser) parseIdent() (string, error) {
 	tok, pos, lit := p.ScanIgnoreWhitespace()
@@ -368,6 +656,12 @@ func (p *Parser) parseExprList(leftToken, rightToken scanner.Token) (query.Liter
 		return nil, newParseError(scanner.Tokstr(tok, lit), []string{leftToken.String()}, pos)
 	}
 
+	return p.parseExprListItems(rightToken)
+}
+
+// parseExprListItems parses a comma separated list of expressions followed by rightToken.
+// This function assumes the opening token has already been consumed.
+func (p *Parser) parseExprListItems(rightToken scanner.Token) (query.LiteralExprList, error) {
 	var exprList query.LiteralExprList
 	var expr query.Expr
 	var err error
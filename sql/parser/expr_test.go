@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/stretchr/testify/require"
 )
@@ -88,7 +91,7 @@ func TestParserExpr(t *testing.T) {
 				query.BoolValue(true),
 				query.KVPairs{query.KVPair{K: "a", V: query.Int8Value(1)}},
 				query.FieldSelector{"a", "b", "c"},
-				query.LiteralExprList{query.Int8Value(-1)},
+				query.Int8Value(-1),
 				query.LiteralExprList{query.Int8Value(-1)},
 			}, false},
 		{"list with parentheses: missing parenthese", `(1, true, {a: 1}, a.b.c, (-1)`, nil, true},
@@ -99,7 +102,7 @@ func TestParserExpr(t *testing.T) {
 				query.BoolValue(true),
 				query.KVPairs{query.KVPair{K: "a", V: query.Int8Value(1)}},
 				query.FieldSelector{"a", "b", "c"},
-				query.LiteralExprList{query.Int8Value(-1)},
+				query.Int8Value(-1),
 				query.LiteralExprList{query.Int8Value(-1)},
 			}, false},
 		{"list with brackets: missing bracket", `[1, true, {a: 1}, a.b.c, (-1), [-1]`, nil, true},
@@ -130,6 +133,153 @@ func TestParserExpr(t *testing.T) {
 				query.Lt(query.FieldSelector([]string{"age"}), query.Float64Value(10.4)),
 			), false},
 		{"with NULL", "age > NULL", query.Gt(query.FieldSelector([]string{"age"}), query.NullValue()), false},
+
+		// arithmetic operators
+		{"+", "age + 10", query.Add(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"-", "age - 10", query.Sub(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"- without space", "age-10", query.Sub(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"- with negative number", "age - -10", query.Sub(query.FieldSelector([]string{"age"}), query.Int8Value(-10)), false},
+		{"*", "age * 10", query.Mul(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"/", "age / 10", query.Div(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"%", "age % 10", query.Mod(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"&", "age & 10", query.BitwiseAnd(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"|", "age | 10", query.BitwiseOr(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"^", "age ^ 10", query.BitwiseXor(query.FieldSelector([]string{"age"}), query.Int8Value(10)), false},
+		{"precedence", "4 > 1 + 2 * 3 - 1",
+			query.Gt(
+				query.Int8Value(4),
+				query.Sub(
+					query.Add(
+						query.Int8Value(1),
+						query.Mul(query.Int8Value(2), query.Int8Value(3)),
+					),
+					query.Int8Value(1),
+				),
+			), false},
+		{"parentheses", "a - (b + c) * 2 = 1",
+			query.Eq(
+				query.Sub(
+					query.FieldSelector([]string{"a"}),
+					query.Mul(
+						query.Add(query.FieldSelector([]string{"b"}), query.FieldSelector([]string{"c"})),
+						query.Int8Value(2),
+					),
+				),
+				query.Int8Value(1),
+			), false},
+		{"parentheses at the root", "(a = 1)", query.Eq(query.FieldSelector([]string{"a"}), query.Int8Value(1)), false},
+		{"nested parentheses at the root", "((a + 1)) * 2",
+			query.Mul(query.Add(query.FieldSelector([]string{"a"}), query.Int8Value(1)), query.Int8Value(2)), false},
+		{"brackets are not parentheses", "a = [1]",
+			query.Eq(query.FieldSelector([]string{"a"}), query.LiteralExprList{query.Int8Value(1)}), false},
+		{"comparisons and arithmetic", "a = 1 + 2 AND b > 3.0 / c",
+			query.And(
+				query.Eq(query.FieldSelector([]string{"a"}), query.Add(query.Int8Value(1), query.Int8Value(2))),
+				query.Gt(query.FieldSelector([]string{"b"}), query.Div(query.Float64Value(3), query.FieldSelector([]string{"c"}))),
+			), false},
+		{"missing operand", "age +", nil, true},
+
+		// IN operator
+		{"IN", "age IN (10, 11)", query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.Int8Value(10), query.Int8Value(11)}), false},
+		{"IN with one value", "age IN (10)", query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.Int8Value(10)}), false},
+		{"IN with brackets", "age in [10, 11]", query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.Int8Value(10), query.Int8Value(11)}), false},
+		{"IN with param", "age IN ?", query.In(query.FieldSelector([]string{"age"}), query.PositionalParam(1)), false},
+		{"NOT IN", "age NOT IN (10, 11)", query.NotIn(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.Int8Value(10), query.Int8Value(11)}), false},
+		{"IN then AND", "age IN (10) AND name = 'foo'",
+			query.And(
+				query.In(query.FieldSelector([]string{"age"}), query.LiteralExprList{query.Int8Value(10)}),
+				query.Eq(query.FieldSelector([]string{"name"}), query.StringValue("foo")),
+			), false},
+		{"NOT without IN", "age NOT 10", nil, true},
+
+		// NOT and IS operators
+		{"NOT", "NOT a", query.Not(query.FieldSelector([]string{"a"})), false},
+		{"NOT with comparison", "NOT a = 1", query.Not(query.Eq(query.FieldSelector([]string{"a"}), query.Int8Value(1))), false},
+		{"NOT then AND", "NOT a = 1 AND NOT b",
+			query.And(
+				query.Not(query.Eq(query.FieldSelector([]string{"a"}), query.Int8Value(1))),
+				query.Not(query.FieldSelector([]string{"b"})),
+			), false},
+		{"NOT NOT", "NOT NOT a > 1", query.Not(query.Not(query.Gt(query.FieldSelector([]string{"a"}), query.Int8Value(1)))), false},
+		{"NOT with parentheses", "NOT (a OR b) AND c",
+			query.And(
+				query.Not(query.Or(query.FieldSelector([]string{"a"}), query.FieldSelector([]string{"b"}))),
+				query.FieldSelector([]string{"c"}),
+			), false},
+		{"IS NULL", "a IS NULL", query.Is(query.FieldSelector([]string{"a"}), query.NullValue()), false},
+		{"IS NOT NULL", "a IS NOT NULL", query.IsNot(query.FieldSelector([]string{"a"}), query.NullValue()), false},
+		{"IS NOT NULL then AND", "a IS NOT NULL AND b IS 1 + 1",
+			query.And(
+				query.IsNot(query.FieldSelector([]string{"a"}), query.NullValue()),
+				query.Is(query.FieldSelector([]string{"b"}), query.Add(query.Int8Value(1), query.Int8Value(1))),
+			), false},
+		{"IS without operand", "a IS", nil, true},
+
+		// regex operators
+		{"=~", "name =~ /^foo.*bar$/", query.EqRegex(query.FieldSelector([]string{"name"}), regexp.MustCompile(`^foo.*bar$`)), false},
+		{"!~", "name !~ /^foo.*bar$/", query.NeqRegex(query.FieldSelector([]string{"name"}), regexp.MustCompile(`^foo.*bar$`)), false},
+		{"=~ with escaped slash", `name =~/a\/b/`, query.EqRegex(query.FieldSelector([]string{"name"}), regexp.MustCompile(`a/b`)), false},
+		{"=~ then AND", "name =~ /foo/ AND age > 10",
+			query.And(
+				query.EqRegex(query.FieldSelector([]string{"name"}), regexp.MustCompile(`foo`)),
+				query.Gt(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
+			), false},
+		{"=~ with string", "name =~ 'foo'", nil, true},
+		{"=~ unterminated regex", "name =~ /foo", nil, true},
+		{"=~ invalid regex", "name =~ /fo(o/", nil, true},
+
+		// casts
+		{"::", "age::INT64", query.CastFunc{Expr: query.FieldSelector([]string{"age"}), CastAs: document.Int64Value}, false},
+		{":: with spaces", "age :: TEXT", query.CastFunc{Expr: query.FieldSelector([]string{"age"}), CastAs: document.StringValue}, false},
+		{":: chained", "'10'::INT8::TEXT",
+			query.CastFunc{
+				Expr:   query.CastFunc{Expr: query.StringValue("10"), CastAs: document.Int8Value},
+				CastAs: document.StringValue,
+			}, false},
+		{":: then operator", "a::INT64 + 1 > b",
+			query.Gt(
+				query.Add(query.CastFunc{Expr: query.FieldSelector([]string{"a"}), CastAs: document.Int64Value}, query.Int8Value(1)),
+				query.FieldSelector([]string{"b"}),
+			), false},
+		{":: with parentheses", "(a + 1)::TEXT",
+			query.CastFunc{
+				Expr:   query.Add(query.FieldSelector([]string{"a"}), query.Int8Value(1)),
+				CastAs: document.StringValue,
+			}, false},
+		{"CAST", "CAST(a AS TEXT)", query.CastFunc{Expr: query.FieldSelector([]string{"a"}), CastAs: document.StringValue}, false},
+		{"CAST lowercase", "cast(a.b as integer) = 10",
+			query.Eq(
+				query.CastFunc{Expr: query.FieldSelector([]string{"a", "b"}), CastAs: document.IntValue},
+				query.Int8Value(10),
+			), false},
+		{"CAST with expression", "CAST(a * 2 AS FLOAT64)",
+			query.CastFunc{
+				Expr:   query.Mul(query.FieldSelector([]string{"a"}), query.Int8Value(2)),
+				CastAs: document.Float64Value,
+			}, false},
+		{":: without type", "a::", nil, true},
+		{":: with unknown type", "a::foo", nil, true},
+		{"CAST without AS", "CAST(a TEXT)", nil, true},
+		{"CAST without type", "CAST(a AS)", nil, true},
+		{"CAST without closing parenthesis", "CAST(a AS TEXT", nil, true},
+		{"IN subquery", "a IN (SELECT b FROM c)",
+			query.In(
+				query.FieldSelector([]string{"a"}),
+				query.Subquery{Stmt: query.SelectStmt{Selectors: []query.ResultField{query.FieldSelector([]string{"b"})}, TableName: "c"}},
+			), false},
+		{"EXISTS", "NOT EXISTS (SELECT * FROM c WHERE c.a = b)",
+			query.Not(query.Exists(query.Subquery{Stmt: query.SelectStmt{
+				Selectors: []query.ResultField{query.Wildcard{}},
+				TableName: "c",
+				WhereExpr: query.Eq(query.FieldSelector([]string{"c", "a"}), query.FieldSelector([]string{"b"})),
+			}})), false},
+		{"Scalar subquery", "(SELECT MAX(b) FROM c) + 1",
+			query.Add(
+				query.Subquery{Stmt: query.SelectStmt{Selectors: []query.ResultField{query.MaxFunc{Path: query.FieldSelector([]string{"b"})}}, TableName: "c"}},
+				query.Int8Value(1),
+			), false},
+		{"Subquery without closing parenthesis", "a IN (SELECT b FROM c", nil, true},
+		{"EXISTS without subquery", "EXISTS (1)", nil, true},
 	}
 
 	for _, test := range tests {
@@ -145,6 +295,61 @@ func TestParserExpr(t *testing.T) {
 	}
 }
 
+func TestParserExprString(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+	}{
+		{"a.b", "a.b"},
+		{"'foo'", `"foo"`},
+		{"10", "10"},
+		{"10.0", "10.0"},
+		{"-1.5", "-1.5"},
+		{"true", "true"},
+		{"NULL", "NULL"},
+		{"(1, 'a')", `[1, "a"]`},
+		{"{a: 1, b: c}", "{a: 1, b: c}"},
+		{"$foo + $bar", "$foo + $bar"},
+		{"? - ?", "? - ?"},
+		{"a+b*c", "a + b * c"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"a = 1 AND (b = 2 OR c IS NOT NULL)", "a = 1 AND (b = 2 OR c IS NOT NULL)"},
+		{"NOT (a OR b)", "NOT (a OR b)"},
+		{"NOT a = 1", "NOT a = 1"},
+		{"a NOT IN (1, 2)", "a NOT IN [1, 2]"},
+		{"a =~ /^a\\/b$/", "a =~ /^a\\/b$/"},
+		{"CAST(a + 1 AS TEXT)", "CAST(a + 1 AS STRING)"},
+		{"COUNT(*) * 2", "COUNT(*) * 2"},
+		{"a IN (SELECT b AS c FROM d WHERE e = 1 ORDER BY b DESC LIMIT 1)", "a IN (SELECT b AS c FROM d WHERE e = 1 ORDER BY b DESC LIMIT 1)"},
+		{"NOT EXISTS (SELECT DISTINCT *, a + 1 FROM d x LEFT JOIN e ON x.a = e.a GROUP BY a HAVING COUNT(*) > 1)", "NOT EXISTS (SELECT DISTINCT *, a + 1 FROM d AS x LEFT JOIN e ON x.a = e.a GROUP BY a HAVING COUNT(*) > 1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			ex, err := NewParser(strings.NewReader(test.s)).parseExpr()
+			require.NoError(t, err)
+			s := ex.(fmt.Stringer).String()
+			require.Equal(t, test.expected, s)
+
+			// the string representation must be parsed into the same expression
+			ex2, err := NewParser(strings.NewReader(s)).parseExpr()
+			require.NoError(t, err)
+			require.EqualValues(t, ex, ex2)
+		})
+	}
+}
+
+func TestParserRegexError(t *testing.T) {
+	_, err := NewParser(strings.NewReader("a = 1 AND\n name =~ /fo(o/")).parseExpr()
+	require.Error(t, err)
+	perr, ok := err.(*ParseError)
+	require.True(t, ok)
+	require.Equal(t, 1, perr.Pos.Line)
+	require.Equal(t, 9, perr.Pos.Char)
+}
+
 func TestParserParams(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -26,6 +26,22 @@ func NewParser(r io.Reader) *Parser {
 // ParseQuery parses a query string and returns its AST representation.
 func ParseQuery(s string) (query.Query, error) { return NewParser(strings.NewReader(s)).ParseQuery() }
 
+// ParseExpr parses an expression.
+func ParseExpr(s string) (query.Expr, error) {
+	p := NewParser(strings.NewReader(s))
+
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.EOF {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"EOF"}, pos)
+	}
+
+	return e, nil
+}
+
 // ParseQuery parses a Genji SQL string and returns a Query.
 func (p *Parser) ParseQuery() (query.Query, error) {
 	var statements []query.Statement
@@ -67,10 +83,16 @@ func (p *Parser) ParseStatement() (query.Statement, error) {
 		return p.parseCreateStatement()
 	case scanner.DROP:
 		return p.parseDropStatement()
+	case scanner.REINDEX:
+		return p.parseReIndexStatement()
+	case scanner.EXPLAIN:
+		return p.parseExplainStatement()
+	case scanner.ALTER:
+		return p.parseAlterStatement()
 	}
 
 	return nil, newParseError(scanner.Tokstr(tok, lit), []string{
-		"SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP",
+		"SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP", "REINDEX", "EXPLAIN", "ALTER",
 	}, pos)
 }
 
@@ -28,3 +28,28 @@ func TestParserMultiStatement(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Expr
+		errored  bool
+	}{
+		{"Comparison", "a >= 1", query.Gte(query.FieldSelector([]string{"a"}), query.Int8Value(1)), false},
+		{"Trailing tokens", "a >= 1 b", nil, true},
+		{"Empty", "", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := ParseExpr(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.EqualValues(t, test.expected, e)
+		})
+	}
+}
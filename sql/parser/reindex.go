@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"github.com/asdine/genji/sql/query"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// parseReIndexStatement parses a reindex statement and returns a Statement AST object.
+// This function assumes the REINDEX token has already been consumed.
+func (p *Parser) parseReIndexStatement() (query.ReIndexStmt, error) {
+	var stmt query.ReIndexStmt
+	var err error
+
+	tok, _, _ := p.ScanIgnoreWhitespace()
+	switch tok {
+	case scanner.TABLE:
+		// Parse table name
+		stmt.TableName, err = p.parseIdent()
+	case scanner.IDENT:
+		// Parse index name
+		p.Unscan()
+		stmt.IndexName, err = p.parseIdent()
+	default:
+		p.Unscan()
+	}
+
+	return stmt, err
+}
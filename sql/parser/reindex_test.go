@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/asdine/genji/sql/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserReIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected query.Statement
+		errored  bool
+	}{
+		{"All", "REINDEX", query.ReIndexStmt{}, false},
+		{"Index", "REINDEX idx", query.ReIndexStmt{IndexName: "idx"}, false},
+		{"Table", "REINDEX TABLE test", query.ReIndexStmt{TableName: "test"}, false},
+		{"Followed by a statement", "REINDEX; REINDEX idx", query.ReIndexStmt{}, false},
+		{"Table without name", "REINDEX TABLE", nil, true},
+		{"Several indexes", "REINDEX a b", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseQuery(test.s)
+			if test.errored {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, q.Statements)
+			require.EqualValues(t, test.expected, q.Statements[0])
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/asdine/genji/sql/query"
 	"github.com/asdine/genji/sql/scanner"
 )
@@ -11,6 +14,13 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 	var stmt query.SelectStmt
 	var err error
 
+	// Parse optional DISTINCT
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.DISTINCT {
+		stmt.Distinct = true
+	} else {
+		p.Unscan()
+	}
+
 	// Parse field list or query.Wildcard
 	stmt.Selectors, err = p.parseResultFields()
 	if err != nil {
@@ -18,7 +28,13 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 	}
 
 	// Parse "FROM".
-	stmt.TableName, err = p.parseFrom()
+	stmt.TableName, stmt.TableAlias, err = p.parseFrom()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse joins: "[INNER | LEFT [OUTER]] JOIN table [[AS] alias] ON EXPR"
+	stmt.Joins, err = p.parseJoins()
 	if err != nil {
 		return stmt, err
 	}
@@ -29,8 +45,20 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 		return stmt, err
 	}
 
-	// Parse order by: "ORDER BY fieldRef [ASC|DESC]?"
-	stmt.OrderBy, stmt.OrderByDirection, err = p.parseOrderBy()
+	// Parse group by: "GROUP BY fieldRef [, fieldRef]*"
+	stmt.GroupBy, err = p.parseGroupBy()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse having: "HAVING EXPR"
+	stmt.HavingExpr, err = p.parseHaving()
+	if err != nil {
+		return stmt, err
+	}
+
+	// Parse order by: "ORDER BY (fieldRef | aggregate) [ASC|DESC]? [NULLS FIRST|LAST]? [, ...]*"
+	stmt.OrderBy, err = p.parseOrderBy()
 	if err != nil {
 		return stmt, err
 	}
@@ -53,7 +81,7 @@ func (p *Parser) parseSelectStatement() (query.SelectStmt, error) {
 // parseResultFields parses the list of result fields.
 func (p *Parser) parseResultFields() ([]query.ResultField, error) {
 	// Parse first (required) result field.
-	rf, err := p.parseResultField()
+	rf, _, err := p.parseResultField()
 	if err != nil {
 		return nil, err
 	}
@@ -66,77 +94,283 @@ func (p *Parser) parseResultFields() ([]query.ResultField, error) {
 			return rfields, nil
 		}
 
-		if rf, err = p.parseResultField(); err != nil {
+		rf, pos, err := p.parseResultField()
+		if err != nil {
 			return nil, err
 		}
 
+		// an alias can't be used to name more than one field of the result
+		for _, prev := range rfields {
+			if prev.Name() == rf.Name() && (isAlias(prev) || isAlias(rf)) {
+				return nil, &ParseError{Message: fmt.Sprintf("duplicate alias %s", rf.Name()), Pos: pos}
+			}
+		}
+
 		rfields = append(rfields, rf)
 	}
 }
 
-// parseResultField parses the list of result fields.
-func (p *Parser) parseResultField() (query.ResultField, error) {
+// parseResultField parses a result field: a wildcard, the key() function or any expression,
+// optionally followed by an alias. It also returns the position of the name of the field:
+// the position of its alias, if any, or of the beginning of the field.
+func (p *Parser) parseResultField() (query.ResultField, scanner.Pos, error) {
 	// Check if the * token exists.
-	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.MUL {
-		return query.Wildcard{}, nil
+	tok, pos, _ := p.ScanIgnoreWhitespace()
+	if tok == scanner.MUL {
+		return query.Wildcard{}, pos, nil
 	}
 	p.Unscan()
 
 	// Check if it's the key() function
-	tok, pos, lit := p.ScanIgnoreWhitespace()
-	if tok == scanner.KEY {
-		if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.LPAREN {
-			if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
-				return nil, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
-			}
-
-			return query.KeyFunc{}, nil
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.KEY {
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
+			return nil, pos, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
 		}
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.RPAREN {
+			return nil, pos, newParseError(scanner.Tokstr(tok, lit), []string{")"}, pos)
+		}
+
+		return query.KeyFunc{}, pos, nil
 	}
 	p.Unscan()
 
-	field, err := p.parseFieldRef()
+	e, err := p.parseExpr()
 	if err != nil {
-		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"field path"}, pos)
+		return nil, pos, err
 	}
 
-	return query.FieldSelector(field), nil
+	// Parse optional alias.
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.AS {
+		_, pos, _ = p.ScanIgnoreWhitespace()
+		p.Unscan()
+
+		alias, err := p.parseIdent()
+		if err != nil {
+			return nil, pos, err
+		}
+
+		return query.ResultFieldExpr{Expr: e, ExprName: alias}, pos, nil
+	}
+	p.Unscan()
+
+	// fields and functions are already result fields
+	if rf, ok := e.(query.ResultField); ok {
+		return rf, pos, nil
+	}
+
+	return query.ResultFieldExpr{Expr: e, ExprName: fmt.Sprint(e)}, pos, nil
+}
+
+// isAlias reports whether the name of rf was chosen with the AS keyword.
+func isAlias(rf query.ResultField) bool {
+	t, ok := rf.(query.ResultFieldExpr)
+	return ok && t.ExprName != fmt.Sprint(t.Expr)
 }
 
-func (p *Parser) parseFrom() (string, error) {
+func (p *Parser) parseFrom() (string, string, error) {
 	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.FROM {
-		return "", newParseError(scanner.Tokstr(tok, lit), []string{"FROM"}, pos)
+		return "", "", newParseError(scanner.Tokstr(tok, lit), []string{"FROM"}, pos)
+	}
+
+	// Parse table name and alias
+	return p.parseTableRef()
+}
+
+// parseTableRef parses a table name, followed by an optional alias
+// which may be preceded by the AS keyword.
+func (p *Parser) parseTableRef() (string, string, error) {
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", "", err
+	}
+
+	tok, _, _ := p.ScanIgnoreWhitespace()
+	if tok != scanner.AS {
+		p.Unscan()
+		if tok != scanner.IDENT {
+			return name, "", nil
+		}
+	}
+
+	alias, err := p.parseIdent()
+	if err != nil {
+		return "", "", err
+	}
+
+	return name, alias, nil
+}
+
+// parseJoins parses the list of JOIN clauses following the FROM clause.
+func (p *Parser) parseJoins() ([]query.JoinClause, error) {
+	var joins []query.JoinClause
+
+	for {
+		var j query.JoinClause
+
+		tok, _, _ := p.ScanIgnoreWhitespace()
+		switch tok {
+		case scanner.JOIN:
+		case scanner.INNER, scanner.LEFT:
+			j.Left = tok == scanner.LEFT
+
+			tok, pos, lit := p.ScanIgnoreWhitespace()
+			if j.Left && tok == scanner.OUTER {
+				tok, pos, lit = p.ScanIgnoreWhitespace()
+			}
+			if tok != scanner.JOIN {
+				return nil, newParseError(scanner.Tokstr(tok, lit), []string{"JOIN"}, pos)
+			}
+		default:
+			p.Unscan()
+			return joins, nil
+		}
+
+		var err error
+		j.TableName, j.Alias, err = p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+
+		// parse ON token
+		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.ON {
+			return nil, newParseError(scanner.Tokstr(tok, lit), []string{"ON"}, pos)
+		}
+
+		j.On, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		joins = append(joins, j)
+	}
+}
+
+func (p *Parser) parseGroupBy() ([]query.FieldSelector, error) {
+	// parse GROUP token
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.GROUP {
+		p.Unscan()
+		return nil, nil
+	}
+
+	// parse BY token
+	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.BY {
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
 	}
 
-	// Parse table name
-	return p.parseIdent()
+	var fields []query.FieldSelector
+	for {
+		// parse field reference
+		ref, err := p.parseFieldRef()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, query.FieldSelector(ref))
+
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
+			p.Unscan()
+			return fields, nil
+		}
+	}
+}
+
+func (p *Parser) parseHaving() (query.Expr, error) {
+	// parse HAVING token
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.HAVING {
+		p.Unscan()
+		return nil, nil
+	}
+
+	return p.parseExpr()
 }
 
-func (p *Parser) parseOrderBy() (query.FieldSelector, scanner.Token, error) {
+// parseOrderBy parses the ORDER BY clause, a comma separated list of sort keys.
+func (p *Parser) parseOrderBy() ([]query.OrderByField, error) {
 	// parse ORDER token
 	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.ORDER {
 		p.Unscan()
-		return nil, 0, nil
+		return nil, nil
 	}
 
 	// parse BY token
 	if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.BY {
-		return nil, 0, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
+		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"BY"}, pos)
+	}
+
+	var fields []query.OrderByField
+	for {
+		f, err := p.parseOrderByField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+
+		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
+			p.Unscan()
+			return fields, nil
+		}
+	}
+}
+
+// parseOrderByField parses a sort key: a field reference or an aggregate function, followed by an optional
+// ASC or DESC and an optional NULLS FIRST or NULLS LAST.
+func (p *Parser) parseOrderByField() (query.OrderByField, error) {
+	var f query.OrderByField
+
+	// parse aggregate function
+	tok, pos, lit := p.ScanIgnoreWhitespace()
+	if tok == scanner.IDENT {
+		if tok, _, _ := p.Scan(); tok == scanner.LPAREN {
+			fn, err := p.parseFunction(lit, pos)
+			if err != nil {
+				return f, err
+			}
+
+			agg, ok := fn.(query.AggregatorBuilder)
+			if !ok {
+				return f, &ParseError{Message: fmt.Sprintf("cannot sort by %s: only fields and aggregate functions can be used in ORDER BY", fn), Pos: pos}
+			}
+			f.Aggregate = agg
+		} else {
+			p.Unscan()
+		}
 	}
 
 	// parse field reference
-	ref, err := p.parseFieldRef()
-	if err != nil {
-		return nil, 0, err
+	if f.Aggregate == nil {
+		p.Unscan()
+		ref, err := p.parseFieldRef()
+		if err != nil {
+			return f, err
+		}
+		f.Path = query.FieldSelector(ref)
 	}
 
 	// parse optional ASC or DESC
 	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.ASC || tok == scanner.DESC {
-		return query.FieldSelector(ref), tok, nil
+		f.Direction = tok
+	} else {
+		p.Unscan()
+	}
+
+	// parse optional NULLS FIRST or NULLS LAST.
+	// NULLS, FIRST and LAST are not reserved keywords, they are only recognized here
+	// so that they can still be used as field names.
+	if tok, _, lit := p.ScanIgnoreWhitespace(); tok != scanner.IDENT || !strings.EqualFold(lit, "NULLS") {
+		p.Unscan()
+		return f, nil
+	}
+
+	tok, pos, lit = p.ScanIgnoreWhitespace()
+	switch {
+	case tok == scanner.IDENT && strings.EqualFold(lit, "FIRST"):
+		f.Nulls = query.NullsFirst
+	case tok == scanner.IDENT && strings.EqualFold(lit, "LAST"):
+		f.Nulls = query.NullsLast
+	default:
+		return f, newParseError(scanner.Tokstr(tok, lit), []string{"FIRST", "LAST"}, pos)
 	}
-	p.Unscan()
 
-	return query.FieldSelector(ref), 0, nil
+	return f, nil
 }
 
 func (p *Parser) parseLimit() (query.Expr, error) {
@@ -3,6 +3,7 @@ package parser
 import (
 	"testing"
 
+	"github.com/asdine/genji/document"
 	"github.com/asdine/genji/sql/query"
 	"github.com/asdine/genji/sql/scanner"
 	"github.com/stretchr/testify/require"
@@ -41,24 +42,56 @@ func TestParserSelect(t *testing.T) {
 				TableName: "test",
 				Selectors: []query.ResultField{query.Wildcard{}},
 				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
-				OrderBy:   []string{"a", "b", "c"},
+				OrderBy:   []query.OrderByField{{Path: query.FieldSelector([]string{"a", "b", "c"})}},
 			}, false},
 		{"WithOrderBy ASC", "SELECT * FROM test WHERE age = 10 ORDER BY a.b.c ASC",
 			query.SelectStmt{
-				TableName:        "test",
-				Selectors:        []query.ResultField{query.Wildcard{}},
-				WhereExpr:        query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
-				OrderBy:          []string{"a", "b", "c"},
-				OrderByDirection: scanner.ASC,
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
+				OrderBy:   []query.OrderByField{{Path: query.FieldSelector([]string{"a", "b", "c"}), Direction: scanner.ASC}},
 			}, false},
 		{"WithOrderBy DESC", "SELECT * FROM test WHERE age = 10 ORDER BY a.b.c DESC",
 			query.SelectStmt{
-				TableName:        "test",
-				Selectors:        []query.ResultField{query.Wildcard{}},
-				WhereExpr:        query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
-				OrderBy:          []string{"a", "b", "c"},
-				OrderByDirection: scanner.DESC,
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
+				OrderBy:   []query.OrderByField{{Path: query.FieldSelector([]string{"a", "b", "c"}), Direction: scanner.DESC}},
+			}, false},
+		{"WithMultipleOrderBy", "SELECT * FROM test ORDER BY last_name ASC, age DESC NULLS LAST, b nulls first, c",
+			query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				OrderBy: []query.OrderByField{
+					{Path: query.FieldSelector([]string{"last_name"}), Direction: scanner.ASC},
+					{Path: query.FieldSelector([]string{"age"}), Direction: scanner.DESC, Nulls: query.NullsLast},
+					{Path: query.FieldSelector([]string{"b"}), Nulls: query.NullsFirst},
+					{Path: query.FieldSelector([]string{"c"})},
+				},
+			}, false},
+		{"WithOrderBy and field named nulls", "SELECT * FROM test ORDER BY nulls, last LIMIT 1",
+			query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{query.Wildcard{}},
+				OrderBy: []query.OrderByField{
+					{Path: query.FieldSelector([]string{"nulls"})},
+					{Path: query.FieldSelector([]string{"last"})},
+				},
+				LimitExpr: query.Int8Value(1),
 			}, false},
+		{"WithOrderBy aggregate", "SELECT a, COUNT(*) FROM test GROUP BY a ORDER BY COUNT(*) DESC, MAX(b.c)",
+			query.SelectStmt{
+				TableName: "test",
+				Selectors: []query.ResultField{query.FieldSelector([]string{"a"}), query.CountFunc{Wildcard: true}},
+				GroupBy:   []query.FieldSelector{query.FieldSelector([]string{"a"})},
+				OrderBy: []query.OrderByField{
+					{Aggregate: query.CountFunc{Wildcard: true}, Direction: scanner.DESC},
+					{Aggregate: query.MaxFunc{Path: query.FieldSelector([]string{"b", "c"})}},
+				},
+			}, false},
+		{"WithOrderBy function", "SELECT * FROM test ORDER BY CAST(a AS TEXT)", nil, true},
+		{"WithOrderBy NULLS without position", "SELECT * FROM test ORDER BY a NULLS", nil, true},
+		{"WithOrderBy trailing comma", "SELECT * FROM test ORDER BY a,", nil, true},
 		{"WithLimit", "SELECT * FROM test WHERE age = 10 LIMIT 20",
 			query.SelectStmt{
 				Selectors: []query.ResultField{query.Wildcard{}},
@@ -82,6 +115,114 @@ func TestParserSelect(t *testing.T) {
 				LimitExpr:  query.Int8Value(10),
 			}, false},
 		{"WithOffsetThenLimit", "SELECT * FROM test WHERE age = 10 OFFSET 20 LIMIT 10", nil, true},
+		{"WithAggregates", "SELECT COUNT(*), count(a), SUM(a.b), AVG(a), MIN(a), MAX(a) FROM test",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.CountFunc{Wildcard: true},
+					query.CountFunc{Path: query.FieldSelector([]string{"a"})},
+					query.SumFunc{Path: query.FieldSelector([]string{"a", "b"})},
+					query.AvgFunc{Path: query.FieldSelector([]string{"a"})},
+					query.MinFunc{Path: query.FieldSelector([]string{"a"})},
+					query.MaxFunc{Path: query.FieldSelector([]string{"a"})},
+				},
+				TableName: "test",
+			}, false},
+		{"WithUnknownFunction", "SELECT foo(a) FROM test", nil, true},
+		{"WithGroupBy", "SELECT a.b, COUNT(*) FROM test WHERE age = 10 GROUP BY a.b, c",
+			query.SelectStmt{
+				Selectors: []query.ResultField{query.FieldSelector([]string{"a", "b"}), query.CountFunc{Wildcard: true}},
+				TableName: "test",
+				WhereExpr: query.Eq(query.FieldSelector([]string{"age"}), query.Int8Value(10)),
+				GroupBy:   []query.FieldSelector{query.FieldSelector([]string{"a", "b"}), query.FieldSelector([]string{"c"})},
+			}, false},
+		{"WithGroupByHavingThenOrderBy", "SELECT a, SUM(b) FROM test GROUP BY a HAVING SUM(b) > 10 ORDER BY a",
+			query.SelectStmt{
+				Selectors:  []query.ResultField{query.FieldSelector([]string{"a"}), query.SumFunc{Path: query.FieldSelector([]string{"b"})}},
+				TableName:  "test",
+				GroupBy:    []query.FieldSelector{query.FieldSelector([]string{"a"})},
+				HavingExpr: query.Gt(query.SumFunc{Path: query.FieldSelector([]string{"b"})}, query.Int8Value(10)),
+				OrderBy:    []query.OrderByField{{Path: query.FieldSelector([]string{"a"})}},
+			}, false},
+		{"WithGroupByMissingBy", "SELECT a FROM test GROUP a", nil, true},
+		{"WithDistinct", "SELECT DISTINCT a.b, c FROM test",
+			query.SelectStmt{
+				Distinct:  true,
+				Selectors: []query.ResultField{query.FieldSelector([]string{"a", "b"}), query.FieldSelector([]string{"c"})},
+				TableName: "test",
+			}, false},
+		{"WithDistinct and wildcard", "SELECT DISTINCT * FROM test",
+			query.SelectStmt{
+				Distinct:  true,
+				Selectors: []query.ResultField{query.Wildcard{}},
+				TableName: "test",
+			}, false},
+		{"WithDistinct without selectors", "SELECT DISTINCT FROM test", nil, true},
+		{"WithAliases", "SELECT a.b AS city, price * 2 AS double, {x: a, y: b} AS pair, COUNT(*) AS `count` FROM test",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.ResultFieldExpr{Expr: query.FieldSelector([]string{"a", "b"}), ExprName: "city"},
+					query.ResultFieldExpr{Expr: query.Mul(query.FieldSelector([]string{"price"}), query.Int8Value(2)), ExprName: "double"},
+					query.ResultFieldExpr{Expr: query.KVPairs{
+						query.KVPair{K: "x", V: query.FieldSelector([]string{"a"})},
+						query.KVPair{K: "y", V: query.FieldSelector([]string{"b"})},
+					}, ExprName: "pair"},
+					query.ResultFieldExpr{Expr: query.CountFunc{Wildcard: true}, ExprName: "count"},
+				},
+				TableName: "test",
+			}, false},
+		{"WithExpressions", "SELECT a + 1, b = 'foo', key() FROM test",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.ResultFieldExpr{Expr: query.Add(query.FieldSelector([]string{"a"}), query.Int8Value(1)), ExprName: "a + 1"},
+					query.ResultFieldExpr{Expr: query.Eq(query.FieldSelector([]string{"b"}), query.StringValue("foo")), ExprName: `b = "foo"`},
+					query.KeyFunc{},
+				},
+				TableName: "test",
+			}, false},
+		{"WithParentheses", "SELECT (a + 1) AS x FROM test WHERE (a = 1)",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.ResultFieldExpr{Expr: query.Add(query.FieldSelector([]string{"a"}), query.Int8Value(1)), ExprName: "x"},
+				},
+				TableName: "test",
+				WhereExpr: query.Eq(query.FieldSelector([]string{"a"}), query.Int8Value(1)),
+			}, false},
+		{"WithTableAlias", "SELECT t.a FROM test t",
+			query.SelectStmt{
+				Selectors:  []query.ResultField{query.FieldSelector([]string{"t", "a"})},
+				TableName:  "test",
+				TableAlias: "t",
+			}, false},
+		{"WithJoins", "SELECT * FROM a AS x JOIN b ON x.id = b.id LEFT JOIN c y ON y.id = b.c_id INNER JOIN d ON true LEFT OUTER JOIN e ON false WHERE x.k = 1",
+			query.SelectStmt{
+				Selectors:  []query.ResultField{query.Wildcard{}},
+				TableName:  "a",
+				TableAlias: "x",
+				Joins: []query.JoinClause{
+					{TableName: "b", On: query.Eq(query.FieldSelector([]string{"x", "id"}), query.FieldSelector([]string{"b", "id"}))},
+					{TableName: "c", Alias: "y", Left: true, On: query.Eq(query.FieldSelector([]string{"y", "id"}), query.FieldSelector([]string{"b", "c_id"}))},
+					{TableName: "d", On: query.BoolValue(true)},
+					{TableName: "e", Left: true, On: query.BoolValue(false)},
+				},
+				WhereExpr: query.Eq(query.FieldSelector([]string{"x", "k"}), query.Int8Value(1)),
+			}, false},
+		{"WithJoin without ON", "SELECT * FROM a JOIN b WHERE a.id = b.id", nil, true},
+		{"WithInner without JOIN", "SELECT * FROM a INNER b ON a.id = b.id", nil, true},
+		{"WithOuter without LEFT", "SELECT * FROM a OUTER JOIN b ON a.id = b.id", nil, true},
+		{"WithAliasMissing", "SELECT a AS FROM test", nil, true},
+		{"WithAliasString", "SELECT a AS 'b' FROM test", nil, true},
+		{"WithDuplicateAlias", "SELECT a AS x, b AS x FROM test", nil, true},
+		{"WithAliasOfOtherField", "SELECT a, b AS a FROM test", nil, true},
+		{"WithCasts", "SELECT a::TEXT, CAST(b.c AS INT64), COUNT(*)::TEXT FROM test WHERE d::INT8 = 1",
+			query.SelectStmt{
+				Selectors: []query.ResultField{
+					query.CastFunc{Expr: query.FieldSelector([]string{"a"}), CastAs: document.StringValue},
+					query.CastFunc{Expr: query.FieldSelector([]string{"b", "c"}), CastAs: document.Int64Value},
+					query.CastFunc{Expr: query.CountFunc{Wildcard: true}, CastAs: document.StringValue},
+				},
+				TableName: "test",
+				WhereExpr: query.Eq(query.CastFunc{Expr: query.FieldSelector([]string{"d"}), CastAs: document.Int8Value}, query.Int8Value(1)),
+			}, false},
 	}
 
 	for _, test := range tests {
@@ -96,4 +237,19 @@ func TestParserSelect(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("Duplicate alias position", func(t *testing.T) {
+		tests := []struct {
+			s   string
+			err string
+		}{
+			{"SELECT a AS x, b AS x FROM test", "duplicate alias x at line 1, char 21"},
+			{"SELECT a AS b, b FROM test", "duplicate alias b at line 1, char 16"},
+		}
+
+		for _, test := range tests {
+			_, err := ParseQuery(test.s)
+			require.EqualError(t, err, test.err)
+		}
+	})
 }
@@ -0,0 +1,673 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+)
+
+// An AggregatorBuilder is an expression that creates one Aggregator per group of documents.
+// Once the aggregation is done, the result of each aggregator is stored in the group document
+// under the name of the builder, which is where the Eval method of the builder looks it up.
+type AggregatorBuilder interface {
+	Expr
+	ResultField
+
+	Aggregator() Aggregator
+}
+
+// An Aggregator computes a single value from all the documents of a group.
+type Aggregator interface {
+	// Aggregate is called once for every document of the group.
+	Aggregate(stack EvalStack) error
+	// Result returns the value computed from all the aggregated documents.
+	Result() (document.Value, error)
+}
+
+// evalAggregate looks for the result of the aggregator named name in the current document.
+func evalAggregate(name string, stack EvalStack) (document.Value, error) {
+	if stack.Document == nil {
+		return nilLitteral, document.ErrFieldNotFound
+	}
+
+	v, err := stack.Document.GetByField(name)
+	if err != nil {
+		return nilLitteral, document.ErrFieldNotFound
+	}
+
+	return v, nil
+}
+
+// iterateAggregate calls fn with the result of the aggregator named name.
+func iterateAggregate(name string, stack EvalStack, fn func(field string, value document.Value) error) error {
+	v, err := evalAggregate(name, stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+
+	return fn(name, v)
+}
+
+// CountFunc is the COUNT aggregate function. If Wildcard is true, it counts every document
+// of the group, otherwise it only counts the documents where Path exists and is not NULL.
+type CountFunc struct {
+	Path     FieldSelector
+	Wildcard bool
+}
+
+// Name returns "COUNT(*)" or "COUNT(path)".
+func (c CountFunc) Name() string {
+	if c.Wildcard {
+		return "COUNT(*)"
+	}
+
+	return "COUNT(" + c.Path.Name() + ")"
+}
+
+// String returns the name of the function. It implements the fmt.Stringer interface.
+func (c CountFunc) String() string {
+	return c.Name()
+}
+
+// Eval returns the result of the aggregation stored in the current document.
+func (c CountFunc) Eval(stack EvalStack) (document.Value, error) {
+	return evalAggregate(c.Name(), stack)
+}
+
+// Iterate calls fn with the result of the aggregation.
+func (c CountFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	return iterateAggregate(c.Name(), stack, fn)
+}
+
+// Aggregator returns a new counter.
+func (c CountFunc) Aggregator() Aggregator {
+	return &countAggregator{fn: c}
+}
+
+type countAggregator struct {
+	fn    CountFunc
+	count int64
+}
+
+func (c *countAggregator) Aggregate(stack EvalStack) error {
+	if c.fn.Wildcard {
+		c.count++
+		return nil
+	}
+
+	v, err := c.fn.Path.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err == nil && v.Type != document.NullValue {
+		c.count++
+	}
+
+	return nil
+}
+
+func (c *countAggregator) Result() (document.Value, error) {
+	return document.NewInt64Value(c.count), nil
+}
+
+// SumFunc is the SUM aggregate function. It adds all the numbers found at Path.
+// Values that are not numbers are ignored.
+// The result is an Int64 if all the values are integers and if the sum doesn't overflow,
+// a Float64 otherwise. If the group doesn't contain any number, the result is NULL.
+type SumFunc struct {
+	Path FieldSelector
+}
+
+// Name returns "SUM(path)".
+func (s SumFunc) Name() string {
+	return "SUM(" + s.Path.Name() + ")"
+}
+
+// String returns the name of the function. It implements the fmt.Stringer interface.
+func (s SumFunc) String() string {
+	return s.Name()
+}
+
+// Eval returns the result of the aggregation stored in the current document.
+func (s SumFunc) Eval(stack EvalStack) (document.Value, error) {
+	return evalAggregate(s.Name(), stack)
+}
+
+// Iterate calls fn with the result of the aggregation.
+func (s SumFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	return iterateAggregate(s.Name(), stack, fn)
+}
+
+// Aggregator returns a new adder.
+func (s SumFunc) Aggregator() Aggregator {
+	return &sumAggregator{path: s.Path}
+}
+
+type sumAggregator struct {
+	path    FieldSelector
+	count   int64
+	isFloat bool
+	i       int64
+	f       float64
+}
+
+func (s *sumAggregator) Aggregate(stack EvalStack) error {
+	v, err := s.path.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || !v.Type.IsNumber() {
+		return nil
+	}
+
+	s.count++
+
+	if !s.isFloat && v.Type.IsInteger() && !(v.Type == document.Uint64Value && v.V.(uint64) > math.MaxInt64) {
+		x, err := v.ConvertToInt64()
+		if err != nil {
+			return err
+		}
+
+		r := s.i + x
+		// on overflow, switch to floating point arithmetic
+		if (r > s.i) == (x > 0) {
+			s.i = r
+			return nil
+		}
+	}
+
+	if !s.isFloat {
+		s.isFloat = true
+		s.f = float64(s.i)
+	}
+
+	x, err := toFloat64(v)
+	if err != nil {
+		return err
+	}
+	s.f += x
+
+	return nil
+}
+
+func (s *sumAggregator) Result() (document.Value, error) {
+	if s.count == 0 {
+		return nilLitteral, nil
+	}
+
+	if s.isFloat {
+		return document.NewFloat64Value(s.f), nil
+	}
+
+	return document.NewInt64Value(s.i), nil
+}
+
+// AvgFunc is the AVG aggregate function. It returns the average of all the numbers found at Path,
+// as a Float64. Values that are not numbers are ignored.
+// If the group doesn't contain any number, the result is NULL.
+type AvgFunc struct {
+	Path FieldSelector
+}
+
+// Name returns "AVG(path)".
+func (a AvgFunc) Name() string {
+	return "AVG(" + a.Path.Name() + ")"
+}
+
+// String returns the name of the function. It implements the fmt.Stringer interface.
+func (a AvgFunc) String() string {
+	return a.Name()
+}
+
+// Eval returns the result of the aggregation stored in the current document.
+func (a AvgFunc) Eval(stack EvalStack) (document.Value, error) {
+	return evalAggregate(a.Name(), stack)
+}
+
+// Iterate calls fn with the result of the aggregation.
+func (a AvgFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	return iterateAggregate(a.Name(), stack, fn)
+}
+
+// Aggregator returns a new averager.
+func (a AvgFunc) Aggregator() Aggregator {
+	return &avgAggregator{path: a.Path}
+}
+
+type avgAggregator struct {
+	path  FieldSelector
+	count int64
+	sum   float64
+}
+
+func (a *avgAggregator) Aggregate(stack EvalStack) error {
+	v, err := a.path.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || !v.Type.IsNumber() {
+		return nil
+	}
+
+	x, err := toFloat64(v)
+	if err != nil {
+		return err
+	}
+
+	a.sum += x
+	a.count++
+
+	return nil
+}
+
+func (a *avgAggregator) Result() (document.Value, error) {
+	if a.count == 0 {
+		return nilLitteral, nil
+	}
+
+	return document.NewFloat64Value(a.sum / float64(a.count)), nil
+}
+
+// MinFunc is the MIN aggregate function. It returns the smallest value found at Path,
+// using the comparison rules of the document package. NULL values are ignored.
+type MinFunc struct {
+	Path FieldSelector
+}
+
+// Name returns "MIN(path)".
+func (m MinFunc) Name() string {
+	return "MIN(" + m.Path.Name() + ")"
+}
+
+// String returns the name of the function. It implements the fmt.Stringer interface.
+func (m MinFunc) String() string {
+	return m.Name()
+}
+
+// Eval returns the result of the aggregation stored in the current document.
+func (m MinFunc) Eval(stack EvalStack) (document.Value, error) {
+	return evalAggregate(m.Name(), stack)
+}
+
+// Iterate calls fn with the result of the aggregation.
+func (m MinFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	return iterateAggregate(m.Name(), stack, fn)
+}
+
+// Aggregator returns a new aggregator that keeps the smallest value.
+func (m MinFunc) Aggregator() Aggregator {
+	return &minMaxAggregator{path: m.Path, keep: document.Value.IsLesserThan}
+}
+
+// MaxFunc is the MAX aggregate function. It returns the largest value found at Path,
+// using the comparison rules of the document package. NULL values are ignored.
+type MaxFunc struct {
+	Path FieldSelector
+}
+
+// Name returns "MAX(path)".
+func (m MaxFunc) Name() string {
+	return "MAX(" + m.Path.Name() + ")"
+}
+
+// String returns the name of the function. It implements the fmt.Stringer interface.
+func (m MaxFunc) String() string {
+	return m.Name()
+}
+
+// Eval returns the result of the aggregation stored in the current document.
+func (m MaxFunc) Eval(stack EvalStack) (document.Value, error) {
+	return evalAggregate(m.Name(), stack)
+}
+
+// Iterate calls fn with the result of the aggregation.
+func (m MaxFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	return iterateAggregate(m.Name(), stack, fn)
+}
+
+// Aggregator returns a new aggregator that keeps the largest value.
+func (m MaxFunc) Aggregator() Aggregator {
+	return &minMaxAggregator{path: m.Path, keep: document.Value.IsGreaterThan}
+}
+
+type minMaxAggregator struct {
+	path FieldSelector
+	// keep reports whether the candidate must replace the current value.
+	keep  func(candidate, current document.Value) (bool, error)
+	value *document.Value
+}
+
+func (m *minMaxAggregator) Aggregate(stack EvalStack) error {
+	v, err := m.path.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err != nil || v.Type == document.NullValue {
+		return nil
+	}
+
+	if m.value != nil {
+		ok, err := m.keep(v, *m.value)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	// the value may point to memory owned by the engine,
+	// it must be copied before the next document is read.
+	v, err = copyValue(v)
+	if err != nil {
+		return err
+	}
+	m.value = &v
+
+	return nil
+}
+
+func (m *minMaxAggregator) Result() (document.Value, error) {
+	if m.value == nil {
+		return nilLitteral, nil
+	}
+
+	return *m.value, nil
+}
+
+func toFloat64(v document.Value) (float64, error) {
+	if v.Type == document.Uint64Value {
+		return float64(v.V.(uint64)), nil
+	}
+
+	return v.ConvertToFloat64()
+}
+
+func copyValue(v document.Value) (document.Value, error) {
+	data, err := encoding.EncodeValue(v)
+	if err != nil {
+		return document.Value{}, err
+	}
+
+	return encoding.DecodeValue(v.Type, append([]byte(nil), data...))
+}
+
+// operands is implemented by operators, to give access to their operands.
+type operands interface {
+	LeftHand() Expr
+	RightHand() Expr
+}
+
+// collectAggregators returns all the aggregator builders found in the expression tree of e
+// and appends them to aggs, unless an aggregator with the same name is already present.
+func collectAggregators(aggs []AggregatorBuilder, e Expr) []AggregatorBuilder {
+	switch t := e.(type) {
+	case AggregatorBuilder:
+		for _, agg := range aggs {
+			if agg.Name() == t.Name() {
+				return aggs
+			}
+		}
+		return append(aggs, t)
+	case operands:
+		aggs = collectAggregators(aggs, t.LeftHand())
+		return collectAggregators(aggs, t.RightHand())
+	case LiteralExprList:
+		for _, e := range t {
+			aggs = collectAggregators(aggs, e)
+		}
+	case KVPairs:
+		for _, kv := range t {
+			aggs = collectAggregators(aggs, kv.V)
+		}
+	case CastFunc:
+		aggs = collectAggregators(aggs, t.Expr)
+	}
+
+	return aggs
+}
+
+// groupIterator reads all the documents of an iterator, groups them by the values
+// found at the groupBy paths and runs the aggregators on each group.
+// Then, for each group and in the order in which the groups were first encountered,
+// it returns a document containing the groupBy paths and the result of every aggregator,
+// stored under the name of the aggregator.
+// If groupBy is empty, all the documents belong to the same group, which is always returned,
+// even if the iterator is empty.
+type groupIterator struct {
+	it          document.Iterator
+	stack       EvalStack
+	groupBy     []FieldSelector
+	aggregators []AggregatorBuilder
+}
+
+type group struct {
+	// encoded document containing the values of the groupBy paths
+	keys        encoding.EncodedDocument
+	aggregators []Aggregator
+}
+
+func (g groupIterator) newGroup(values []document.Value) (*group, error) {
+	var fb document.FieldBuffer
+	for i, fs := range g.groupBy {
+		setValueAtPath(&fb, fs, values[i])
+	}
+
+	// encoding the document copies the values, which may point to memory owned by the engine.
+	keys, err := encoding.EncodeDocument(&fb)
+	if err != nil {
+		return nil, err
+	}
+
+	grp := group{
+		keys:        keys,
+		aggregators: make([]Aggregator, len(g.aggregators)),
+	}
+	for i, agg := range g.aggregators {
+		grp.aggregators[i] = agg.Aggregator()
+	}
+
+	return &grp, nil
+}
+
+func (g groupIterator) Iterate(fn func(d document.Document) error) error {
+	var groups []*group
+	lookup := make(map[string]*group)
+	values := make([]document.Value, len(g.groupBy))
+	var buf bytes.Buffer
+
+	stack := g.stack
+	err := g.it.Iterate(func(d document.Document) error {
+		stack.Document = d
+
+		buf.Reset()
+		for i, fs := range g.groupBy {
+			v, err := fs.Eval(stack)
+			if err != nil && err != document.ErrFieldNotFound {
+				return err
+			}
+			if err == document.ErrFieldNotFound {
+				v = nilLitteral
+			}
+
+			err = writeValueKey(&buf, v)
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+
+		grp, ok := lookup[buf.String()]
+		if !ok {
+			var err error
+			grp, err = g.newGroup(values)
+			if err != nil {
+				return err
+			}
+
+			lookup[buf.String()] = grp
+			groups = append(groups, grp)
+		}
+
+		for _, agg := range grp.aggregators {
+			err := agg.Aggregate(stack)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 && len(g.groupBy) == 0 {
+		grp, err := g.newGroup(nil)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, grp)
+	}
+
+	for _, grp := range groups {
+		var fb document.FieldBuffer
+		err = fb.ScanDocument(grp.keys)
+		if err != nil {
+			return err
+		}
+
+		for i, agg := range grp.aggregators {
+			v, err := agg.Result()
+			if err != nil {
+				return err
+			}
+
+			fb.Add(g.aggregators[i].Name(), v)
+		}
+
+		err = fn(&fb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeValueKey writes a binary representation of v to buf, used to identify groups and distinct documents.
+// Values that are considered equal by the document package comparison rules must share the same representation:
+// integers and integral floats are written as Int64, strings and bytes are written as Bytes,
+// documents are written with their fields sorted by name and the values of documents and arrays
+// follow the same rules.
+// Booleans are only equal to booleans.
+func writeValueKey(buf *bytes.Buffer, v document.Value) error {
+	switch {
+	case v.Type.IsInteger() && !(v.Type == document.Uint64Value && v.V.(uint64) > math.MaxInt64):
+		x, err := v.ConvertToInt64()
+		if err != nil {
+			return err
+		}
+		v = document.NewInt64Value(x)
+	case v.Type.IsFloat():
+		f := v.V.(float64)
+		if math.Trunc(f) == f && f >= math.MinInt64 && f < math.MaxInt64 {
+			v = document.NewInt64Value(int64(f))
+		}
+	case v.Type == document.StringValue:
+		v.Type = document.BytesValue
+	case v.Type == document.DocumentValue:
+		return writeDocumentKey(buf, v.V.(document.Document))
+	case v.Type == document.ArrayValue:
+		return writeArrayKey(buf, v.V.(document.Array))
+	}
+
+	data, err := encoding.EncodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte(byte(v.Type))
+	writeKeyLength(buf, len(data))
+	buf.Write(data)
+
+	return nil
+}
+
+func writeDocumentKey(buf *bytes.Buffer, d document.Document) error {
+	var fields []string
+	values := make(map[string]document.Value)
+	err := d.Iterate(func(f string, v document.Value) error {
+		if _, ok := values[f]; !ok {
+			fields = append(fields, f)
+		}
+		values[f] = v
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(fields)
+
+	buf.WriteByte(byte(document.DocumentValue))
+	writeKeyLength(buf, len(fields))
+	for _, f := range fields {
+		writeKeyLength(buf, len(f))
+		buf.WriteString(f)
+
+		err = writeValueKey(buf, values[f])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArrayKey(buf *bytes.Buffer, a document.Array) error {
+	var n int
+	err := a.Iterate(func(i int, v document.Value) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte(byte(document.ArrayValue))
+	writeKeyLength(buf, n)
+
+	return a.Iterate(func(i int, v document.Value) error {
+		return writeValueKey(buf, v)
+	})
+}
+
+func writeKeyLength(buf *bytes.Buffer, n int) {
+	var lbuf [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(lbuf[:], uint64(n))
+	buf.Write(lbuf[:l])
+}
+
+// setValueAtPath sets v in fb at the given path, creating intermediate documents if necessary.
+func setValueAtPath(fb *document.FieldBuffer, path FieldSelector, v document.Value) {
+	if len(path) == 1 {
+		fb.Set(path[0], v)
+		return
+	}
+
+	var sub *document.FieldBuffer
+	if cur, err := fb.GetByField(path[0]); err == nil && cur.Type == document.DocumentValue {
+		sub, _ = cur.V.(*document.FieldBuffer)
+	}
+	if sub == nil {
+		sub = document.NewFieldBuffer()
+		fb.Set(path[0], document.NewDocumentValue(sub))
+	}
+
+	setValueAtPath(sub, path[1:], v)
+}
+
+var errAggregateOutsideGroup = errors.New("aggregate functions are only allowed in selectors and in the HAVING and ORDER BY clauses")
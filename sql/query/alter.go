@@ -0,0 +1,109 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+)
+
+// AlterTableRenameStmt is a DSL that allows creating a full ALTER TABLE RENAME TO statement.
+type AlterTableRenameStmt struct {
+	TableName    string
+	NewTableName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AlterTableRenameStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the ALTER TABLE RENAME TO statement in the given transaction.
+// It implements the Statement interface.
+func (stmt AlterTableRenameStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.TableName == "" {
+		return res, errors.New("missing table name")
+	}
+
+	if stmt.NewTableName == "" {
+		return res, errors.New("missing new table name")
+	}
+
+	err := tx.RenameTable(stmt.TableName, stmt.NewTableName)
+	return res, err
+}
+
+// AlterTableAddFieldStmt is a DSL that allows creating a full ALTER TABLE ADD FIELD statement.
+type AlterTableAddFieldStmt struct {
+	TableName  string
+	Constraint database.FieldConstraint
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AlterTableAddFieldStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the ALTER TABLE ADD FIELD statement in the given transaction.
+// It implements the Statement interface.
+func (stmt AlterTableAddFieldStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.TableName == "" {
+		return res, errors.New("missing table name")
+	}
+
+	err := tx.AddFieldConstraint(stmt.TableName, stmt.Constraint)
+	return res, err
+}
+
+// AlterTableDropFieldStmt is a DSL that allows creating a full ALTER TABLE DROP FIELD statement.
+type AlterTableDropFieldStmt struct {
+	TableName string
+	Path      document.ValuePath
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AlterTableDropFieldStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the ALTER TABLE DROP FIELD statement in the given transaction.
+// It implements the Statement interface.
+func (stmt AlterTableDropFieldStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.TableName == "" {
+		return res, errors.New("missing table name")
+	}
+
+	err := tx.DropFieldConstraint(stmt.TableName, stmt.Path)
+	return res, err
+}
+
+// AlterTableSetPrimaryKeyStmt is a DSL that allows creating a full ALTER TABLE SET PRIMARY KEY statement.
+type AlterTableSetPrimaryKeyStmt struct {
+	TableName string
+	Paths     []document.ValuePath
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AlterTableSetPrimaryKeyStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the ALTER TABLE SET PRIMARY KEY statement in the given transaction.
+// It implements the Statement interface.
+func (stmt AlterTableSetPrimaryKeyStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	if stmt.TableName == "" {
+		return res, errors.New("missing table name")
+	}
+
+	err := tx.SetPrimaryKey(stmt.TableName, stmt.Paths)
+	return res, err
+}
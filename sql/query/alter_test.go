@@ -0,0 +1,280 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlterTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		table    string
+		expected string
+	}{
+		{"Rename", "ALTER TABLE test RENAME TO foo", false, "foo", `[{"a":1,"b":"x"},{"a":2,"b":"y"}]`},
+		{"Rename / already exists", "ALTER TABLE test RENAME TO other", true, "", ""},
+		{"Rename / not found", "ALTER TABLE unknown RENAME TO foo", true, "", ""},
+		{"Add field", "ALTER TABLE test ADD FIELD a NUMERIC", false, "test", `[{"a":1.0,"b":"x"},{"a":2.0,"b":"y"}]`},
+		{"Add field / missing field", "ALTER TABLE test ADD FIELD c INTEGER", false, "test", `[{"a":1,"b":"x"},{"a":2,"b":"y"}]`},
+		{"Add field / conversion error", "ALTER TABLE test ADD FIELD b INTEGER", true, "", ""},
+		{"Add field / existing constraint", "ALTER TABLE test ADD FIELD id INTEGER", true, "", ""},
+		{"Add field / default", "ALTER TABLE test ADD FIELD c INTEGER NOT NULL DEFAULT 5", false, "test", `[{"a":1,"b":"x","c":5},{"a":2,"b":"y","c":5}]`},
+		{"Add field / not null", "ALTER TABLE test ADD FIELD c INTEGER NOT NULL", true, "", ""},
+		{"Add field / unique", "ALTER TABLE test ADD FIELD b TEXT UNIQUE", false, "test", `[{"a":1,"b":"x"},{"a":2,"b":"y"}]`},
+		{"Add field / references", "ALTER TABLE test ADD FIELD a INTEGER REFERENCES parent(id)", true, "", ""},
+		{"Set primary key / table", "ALTER TABLE test SET PRIMARY KEY (b)", false, "test", `[{"a":1,"b":"x"},{"a":2,"b":"y"}]`},
+		{"Set primary key / missing field", "ALTER TABLE test SET PRIMARY KEY (c)", true, "", ""},
+		{"Drop field / no constraint", "ALTER TABLE test DROP FIELD a", true, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test (id INTEGER);
+				CREATE TABLE other;
+				CREATE TABLE parent (id INTEGER PRIMARY KEY);
+				INSERT INTO parent (id) VALUES (1);
+				INSERT INTO test (a, b) VALUES (1, 'x'), (2, 'y');
+			`)
+			require.NoError(t, err)
+
+			err = db.Exec(test.query)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			st, err := db.Query("SELECT * FROM " + test.table)
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run("Rename with indexes", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test (a);
+			INSERT INTO test (a) VALUES (1), (2), (3);
+			ALTER TABLE test RENAME TO foo;
+		`)
+		require.NoError(t, err)
+
+		// the index is used to select the documents of the renamed table
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM foo WHERE a = 2")
+		require.NoError(t, err)
+		v, err := document.ValuePath{"access", "index"}.GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("idx_test_a"), v)
+
+		d, err = db.QueryDocument("SELECT a FROM foo WHERE a = 2")
+		require.NoError(t, err)
+		var a int
+		err = document.Scan(d, &a)
+		require.NoError(t, err)
+		require.Equal(t, 2, a)
+
+		err = db.Exec("INSERT INTO test (a) VALUES (1)")
+		require.Error(t, err)
+	})
+
+	t.Run("Add unique field", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			INSERT INTO test (a) VALUES (1), (1.0), (2);
+		`)
+		require.NoError(t, err)
+
+		// the values are compared once converted
+		err = db.Exec("ALTER TABLE test ADD FIELD a INTEGER UNIQUE")
+		require.Error(t, err)
+
+		// the table is left unchanged
+		err = db.Exec("INSERT INTO test (a) VALUES (2)")
+		require.NoError(t, err)
+
+		err = db.Exec(`
+			DELETE FROM test WHERE a = 1;
+			ALTER TABLE test ADD FIELD a INTEGER UNIQUE;
+		`)
+		require.Error(t, err)
+
+		err = db.Exec(`
+			DELETE FROM test WHERE a = 2;
+			INSERT INTO test (a) VALUES (1.0), (2);
+			ALTER TABLE test ADD FIELD a INTEGER UNIQUE;
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test (a) VALUES (2.0)")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM test WHERE a = 1")
+		require.NoError(t, err)
+		v, err := document.ValuePath{"access", "type"}.GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("index iterator"), v)
+
+		d, err = db.QueryDocument("SELECT a FROM test WHERE a = 1")
+		require.NoError(t, err)
+		v, err = d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewIntValue(1), v)
+	})
+
+	t.Run("Add field referencing another table", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE parent (id INTEGER PRIMARY KEY);
+			CREATE TABLE test;
+			INSERT INTO parent (id) VALUES (1), (2);
+			INSERT INTO test (p) VALUES (1), (2), (2.0);
+			ALTER TABLE test ADD FIELD p INTEGER REFERENCES parent(id) ON DELETE CASCADE;
+			DELETE FROM parent WHERE id = 2;
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM test")
+		require.NoError(t, err)
+		v, err := d.GetByField("n")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt64Value(1), v)
+
+		err = db.Exec("INSERT INTO test (p) VALUES (3)")
+		require.Error(t, err)
+	})
+
+	t.Run("Set primary key", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (a INTEGER, b TEXT PRIMARY KEY);
+			CREATE INDEX idx_test_c ON test (c);
+			INSERT INTO test (a, b, c) VALUES (3, 'x', 10), (1, 'y', 20), (2, 'z', 30);
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("ALTER TABLE test SET PRIMARY KEY (a)")
+		require.NoError(t, err)
+
+		// documents are stored in the order of the new primary key
+		st, err := db.Query("SELECT key(), c FROM test")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+		require.JSONEq(t, `[{"a":1,"c":20},{"a":2,"c":30},{"a":3,"c":10}]`, buf.String())
+
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM test WHERE a = 2")
+		require.NoError(t, err)
+		v, err := document.ValuePath{"access", "type"}.GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("pk iterator"), v)
+
+		// indexes refer to the new keys
+		d, err = db.QueryDocument("SELECT a FROM test WHERE c = 10")
+		require.NoError(t, err)
+		v, err = d.GetByField("a")
+		require.NoError(t, err)
+		require.Equal(t, document.NewIntValue(3), v)
+
+		err = db.Exec("INSERT INTO test (a, b) VALUES (1, 'w')")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		// the former primary key keeps its type
+		err = db.Exec("INSERT INTO test (a, b) VALUES (4, [1])")
+		require.Error(t, err)
+
+		err = db.Exec(`
+			INSERT INTO test (a, b) VALUES (4, 'x');
+			ALTER TABLE test SET PRIMARY KEY (b);
+		`)
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		// the table is left unchanged
+		d, err = db.QueryDocument("SELECT b FROM test WHERE a = 4")
+		require.NoError(t, err)
+		v, err = d.GetByField("b")
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("x"), v)
+	})
+
+	t.Run("Set primary key of referenced table", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE parent (id INTEGER PRIMARY KEY, code TEXT UNIQUE, name TEXT);
+			CREATE TABLE child (p INTEGER REFERENCES parent(id));
+			INSERT INTO parent (id, code, name) VALUES (1, 'a', 'x'), (2, 'b', 'y');
+		`)
+		require.NoError(t, err)
+
+		// the former primary key wouldn't be unique anymore
+		err = db.Exec("ALTER TABLE parent SET PRIMARY KEY (name)")
+		require.Error(t, err)
+
+		err = db.Exec(`
+			CREATE UNIQUE INDEX idx_parent_id ON parent (id);
+			ALTER TABLE parent SET PRIMARY KEY (code);
+			INSERT INTO child (p) VALUES (2);
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO child (p) VALUES (3)")
+		require.Error(t, err)
+	})
+
+	t.Run("Add then drop field", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			ALTER TABLE test ADD FIELD a INTEGER;
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test (a) VALUES ('foo')")
+		require.Error(t, err)
+
+		err = db.Exec(`
+			ALTER TABLE test DROP FIELD a;
+			INSERT INTO test (a) VALUES ('foo');
+		`)
+		require.NoError(t, err)
+	})
+}
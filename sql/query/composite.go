@@ -0,0 +1,371 @@
+package query
+
+import (
+	"bytes"
+	"database/sql/driver"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/index"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// compositePlan describes how a composite index or a composite primary key is used:
+// its leading fields are equal to eq, and the next field is optionally within rng.
+type compositePlan struct {
+	index database.Index
+	// primaryKey is true if the plan uses the composite primary key instead of an index.
+	primaryKey bool
+	eq         []Expr
+	rng        *valueRange
+	// sorted is true if the documents are returned in the order of the first ORDER BY key.
+	sorted bool
+}
+
+// score returns a value that is higher for plans that select fewer documents.
+func (p *compositePlan) score() int {
+	score := len(p.eq) * 4
+	if p.rng != nil {
+		score += 2
+	}
+	if p.sorted {
+		score++
+	}
+
+	return score
+}
+
+// indexTerm is a comparison between a field and an expression that can be evaluated
+// before reading the table, normalized so that the field is on the left.
+type indexTerm struct {
+	field FieldSelector
+	op    scanner.Token
+	e     Expr
+}
+
+// indexTerms returns the comparisons of e, or of the operands of its AND operators,
+// that can be looked up in an index.
+func indexTerms(e Expr) []indexTerm {
+	switch t := e.(type) {
+	case *AndOp:
+		return append(indexTerms(t.LeftHand()), indexTerms(t.RightHand())...)
+	case CmpOp:
+		ok, fs, op, e := cmpOpCanUseIndex(&t)
+		if !ok || !evaluatesToScalarOrParam(e) {
+			return nil
+		}
+
+		return []indexTerm{{field: fs, op: op, e: e}}
+	}
+
+	return nil
+}
+
+// analyseCompositeIndexes looks for the composite index that selects the fewest documents,
+// using the equalities of the WHERE clause on its leading fields, followed by a comparison
+// or the first ORDER BY key on the next field.
+// It returns nil if the index field selected by analyseExpr is a better choice.
+func (qo *queryOptimizer) analyseCompositeIndexes(field *queryPlanField) *compositePlan {
+	// nothing is faster than fetching a single document
+	if field != nil && field.op == scanner.EQ && field.uniqueIndex {
+		return nil
+	}
+
+	terms := indexTerms(qo.whereExpr)
+
+	// the primary key is preferred to indexes selecting as many documents,
+	// as it doesn't require fetching the documents separately
+	var best *compositePlan
+	if len(qo.cfg.PrimaryKeyPaths) != 0 {
+		best = qo.newCompositePlan(qo.cfg.PrimaryKeyPaths, terms)
+		best.primaryKey = true
+
+		// the primary key selects a single document
+		if len(best.eq) == len(qo.cfg.PrimaryKeyPaths) {
+			return best
+		}
+	}
+
+	for _, idx := range qo.indexes {
+		if len(idx.Paths) == 0 {
+			continue
+		}
+
+		p := qo.newCompositePlan(idx.Paths, terms)
+		p.index = idx
+		switch {
+		case best == nil || p.score() > best.score():
+		case p.score() == best.score() && !best.primaryKey && p.index.IndexName < best.index.IndexName:
+		default:
+			continue
+		}
+		best = p
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	restricted := len(best.eq)
+	if best.rng != nil {
+		restricted++
+	}
+
+	switch {
+	case restricted > 1:
+	case restricted == 1 && (field == nil || best.sorted):
+	case restricted == 0 && best.sorted && field == nil && qo.orderByIndexField() == nil:
+	default:
+		return nil
+	}
+
+	return best
+}
+
+// newCompositePlan selects the terms that can be used to look up a composite index
+// or primary key on the given paths.
+func (qo *queryOptimizer) newCompositePlan(paths []document.ValuePath, terms []indexTerm) *compositePlan {
+	var p compositePlan
+
+	findTerm := func(path document.ValuePath, ops ...scanner.Token) *indexTerm {
+		for i := range terms {
+			if terms[i].field.Name() != path.String() {
+				continue
+			}
+
+			for _, op := range ops {
+				if terms[i].op == op {
+					return &terms[i]
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for _, path := range paths {
+		t := findTerm(path, scanner.EQ)
+		if t == nil {
+			break
+		}
+
+		p.eq = append(p.eq, t.e)
+	}
+
+	if len(p.eq) == len(paths) {
+		return &p
+	}
+
+	next := paths[len(p.eq)]
+	for _, ops := range [][]scanner.Token{{scanner.GT, scanner.GTE}, {scanner.LT, scanner.LTE}} {
+		t := findTerm(next, ops...)
+		if t == nil {
+			continue
+		}
+
+		rng := newValueRange(t.op, t.e)
+		if p.rng != nil {
+			rng = p.rng.intersect(rng)
+		}
+		p.rng = rng
+	}
+
+	if len(qo.orderBy) != 0 {
+		// indexes return NULL values first in ascending order and last in descending order
+		key := newSortKeys(qo.orderBy[:1])[0]
+		p.sorted = qo.orderBy[0].Path.Name() == next.String() && key.nullsFirst != key.desc
+	}
+
+	return &p
+}
+
+// compositeIndexIterator iterates over the documents whose leading fields of the composite index
+// are equal to eq, and whose next field is within rng, if set.
+// Documents are returned in the order of the index, or in the reverse order if orderByDirection is DESC.
+type compositeIndexIterator struct {
+	tx               *database.Transaction
+	tb               *database.Table
+	args             []driver.NamedValue
+	index            index.Index
+	eq               []Expr
+	rng              *valueRange
+	orderByDirection scanner.Token
+}
+
+func (it compositeIndexIterator) Iterate(fn func(d document.Document) error) error {
+	tr, err := evalTupleRange(it.tx, it.args, it.eq, it.rng)
+	if err != nil {
+		return err
+	}
+
+	desc := it.orderByDirection == scanner.DESC
+
+	visit := func(val document.Value, key []byte) error {
+		ok, err := tr.match(val.V.([]byte), desc)
+		if !ok || err != nil {
+			return err
+		}
+
+		d, err := it.tb.GetDocument(key)
+		if err != nil {
+			return err
+		}
+
+		return fn(d)
+	}
+
+	pivot := &index.Pivot{Value: document.NewBytesValue(tr.pivot(desc))}
+	if desc {
+		err = it.index.DescendLessOrEqual(pivot, visit)
+	} else {
+		err = it.index.AscendGreaterOrEqual(pivot, visit)
+	}
+
+	if err != nil && err != errStop {
+		return err
+	}
+
+	return nil
+}
+
+// tupleRange selects the encoded tuples that start with prefix,
+// and whose next value is within the bounds.
+type tupleRange struct {
+	prefix       []byte
+	min, max     []byte
+	minOp, maxOp scanner.Token
+}
+
+// evalTupleRange evaluates the values of the leading fields and the bounds of the next field,
+// and encodes them.
+func evalTupleRange(tx *database.Transaction, args []driver.NamedValue, eq []Expr, rng *valueRange) (tupleRange, error) {
+	var tr tupleRange
+
+	stack := EvalStack{
+		Tx:     tx,
+		Params: args,
+	}
+
+	values := make([]document.Value, len(eq))
+	for i, e := range eq {
+		var err error
+		values[i], err = e.Eval(stack)
+		if err != nil {
+			return tr, err
+		}
+	}
+
+	var err error
+	tr.prefix, err = index.EncodeTuple(values)
+	if err != nil || rng == nil {
+		return tr, err
+	}
+
+	min, max, err := rng.eval(stack)
+	if err != nil {
+		return tr, err
+	}
+
+	if min != nil {
+		tr.min, err = index.EncodeTuple([]document.Value{*min})
+		if err != nil {
+			return tr, err
+		}
+		tr.minOp = rng.minOp()
+	}
+
+	if max != nil {
+		tr.max, err = index.EncodeTuple([]document.Value{*max})
+		if err != nil {
+			return tr, err
+		}
+		tr.maxOp = rng.maxOp()
+	}
+
+	return tr, nil
+}
+
+// match reports whether the encoded tuple data is selected by the range.
+// It returns errStop if no subsequent tuple in the direction of the iteration can be selected.
+func (tr tupleRange) match(data []byte, desc bool) (bool, error) {
+	if !bytes.HasPrefix(data, tr.prefix) {
+		return false, errStop
+	}
+
+	rest := data[len(tr.prefix):]
+	match := true
+	for _, b := range []struct {
+		bound []byte
+		op    scanner.Token
+	}{{tr.min, tr.minOp}, {tr.max, tr.maxOp}} {
+		if b.bound == nil {
+			continue
+		}
+
+		ok, stop := matchBound(rest, b.bound, b.op, desc)
+		if stop {
+			return false, errStop
+		}
+		match = match && ok
+	}
+
+	return match, nil
+}
+
+// pivot returns the encoded tuple the iteration starts from.
+func (tr tupleRange) pivot(desc bool) []byte {
+	pivot := append([]byte{}, tr.prefix...)
+
+	switch {
+	case desc && tr.max != nil:
+		return append(pivot, tr.max...)
+	case desc && tr.min != nil:
+		// after all the values of the type of the bound
+		return append(pivot, tr.min[0]+1)
+	case desc:
+		// after all the tuples starting with the prefix
+		return append(pivot, 0xFF)
+	case tr.min != nil:
+		return append(pivot, tr.min...)
+	case tr.max != nil:
+		// before all the values of the type of the bound
+		return append(pivot, tr.max[0])
+	}
+
+	return pivot
+}
+
+// matchBound compares the encoded value at the beginning of rest with the bound.
+// It returns true if the value satisfies the comparison, and stop is true
+// if no subsequent value in the direction of the iteration can satisfy it.
+// Values of a different type never satisfy the comparison.
+func matchBound(rest, bound []byte, op scanner.Token, desc bool) (ok bool, stop bool) {
+	if len(rest) == 0 {
+		return false, false
+	}
+
+	if rest[0] != bound[0] {
+		// values are grouped by type
+		after := rest[0] > bound[0]
+		return false, after != desc
+	}
+
+	// encoded values are self delimited, they are equal if one is the prefix of the other
+	cmp := 0
+	if !bytes.HasPrefix(rest, bound) {
+		cmp = bytes.Compare(rest, bound)
+	}
+
+	switch op {
+	case scanner.GT:
+		return cmp > 0, desc && cmp <= 0
+	case scanner.GTE:
+		return cmp >= 0, desc && cmp < 0
+	case scanner.LT:
+		return cmp < 0, !desc && cmp >= 0
+	case scanner.LTE:
+		return cmp <= 0, !desc && cmp > 0
+	}
+
+	return false, true
+}
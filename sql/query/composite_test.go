@@ -0,0 +1,233 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		params   []interface{}
+	}{
+		{"Eq on all fields", "SELECT id FROM test WHERE tenant = 1 AND created = 3", `[{"id":3}]`, nil},
+		{"Eq on leading field", "SELECT id FROM test WHERE tenant = 2", `[{"id":5},{"id":6}]`, nil},
+		{"Eq and GT", "SELECT id FROM test WHERE tenant = 1 AND created > 2", `[{"id":3},{"id":4}]`, nil},
+		{"Eq and GTE", "SELECT id FROM test WHERE created >= 2 AND tenant = 1", `[{"id":2},{"id":3},{"id":4}]`, nil},
+		{"Eq and LT", "SELECT id FROM test WHERE tenant = 1 AND created < 3", `[{"id":1},{"id":2}]`, nil},
+		{"Eq and LTE", "SELECT id FROM test WHERE tenant = 1 AND created <= 3", `[{"id":1},{"id":2},{"id":3}]`, nil},
+		{"Reversed comparison", "SELECT id FROM test WHERE 2 < created AND 1 = tenant", `[{"id":3},{"id":4}]`, nil},
+		{"Two bounds", "SELECT id FROM test WHERE tenant = 1 AND created > 1 AND created < 4", `[{"id":2},{"id":3}]`, nil},
+		{"Two bounds and order by desc", "SELECT id FROM test WHERE created <= 3 AND tenant = 1 AND created >= 2 ORDER BY created DESC", `[{"id":3},{"id":2}]`, nil},
+		{"Params", "SELECT id FROM test WHERE tenant = ? AND created > ?", `[{"id":6}]`, []interface{}{2, 1}},
+		{"Range of another type", "SELECT id FROM test WHERE tenant = 1 AND created > 'a'", `[{"id":7}]`, nil},
+		{"Eq of another type", "SELECT id FROM test WHERE tenant = '1'", `[]`, nil},
+		{"Order by next field", "SELECT id FROM test WHERE tenant = 1 ORDER BY created", `[{"id":1},{"id":2},{"id":3},{"id":4},{"id":7}]`, nil},
+		{"Order by next field desc", "SELECT id FROM test WHERE tenant = 1 ORDER BY created DESC", `[{"id":7},{"id":4},{"id":3},{"id":2},{"id":1}]`, nil},
+		{"Range and order by desc", "SELECT id FROM test WHERE tenant = 1 AND created > 1 ORDER BY created DESC", `[{"id":4},{"id":3},{"id":2}]`, nil},
+		{"LT and order by desc", "SELECT id FROM test WHERE tenant = 1 AND created < 4 ORDER BY created DESC", `[{"id":3},{"id":2},{"id":1}]`, nil},
+		{"Order by several keys", "SELECT id FROM test WHERE tenant = 1 ORDER BY created DESC, id LIMIT 2", `[{"id":7},{"id":4}]`, nil},
+		{"Order by leading field", "SELECT id FROM test ORDER BY tenant DESC, id LIMIT 3", `[{"id":5},{"id":6},{"id":1}]`, nil},
+		{"Missing leading field", "SELECT id FROM test WHERE created = 1", `[{"id":1},{"id":5}]`, nil},
+	}
+
+	for _, test := range tests {
+		testFn := func(withIndexes bool) func(t *testing.T) {
+			return func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec("CREATE TABLE test")
+				require.NoError(t, err)
+				if withIndexes {
+					err = db.Exec("CREATE INDEX idx_test_tenant_created ON test (tenant, created)")
+					require.NoError(t, err)
+				}
+
+				err = db.Exec(`
+					INSERT INTO test VALUES {id: 1, tenant: 1, created: 1}, {id: 2, tenant: 1, created: 2};
+					INSERT INTO test VALUES {id: 3, tenant: 1, created: 3}, {id: 4, tenant: 1, created: 4};
+					INSERT INTO test VALUES {id: 5, tenant: 2, created: 1}, {id: 6, tenant: 2, created: 2};
+					INSERT INTO test VALUES {id: 7, tenant: 1, created: 'b'}, {id: 8, created: 1.5};
+				`)
+				require.NoError(t, err)
+
+				st, err := db.Query(test.query, test.params...)
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			}
+		}
+		t.Run("No Index/"+test.name, testFn(false))
+		t.Run("With Index/"+test.name, testFn(true))
+	}
+
+	t.Run("Uses the index", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test (a);
+			CREATE INDEX idx_test_a_b ON test (a, b);
+			INSERT INTO test VALUES {id: 1, a: 1, b: 1}, {id: 2, a: 1, b: 2}, {id: 3, a: 1, b: 3}, {id: 4, a: 1, b: 4};
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			index    string
+			expected string
+		}{
+			{"SELECT id FROM test WHERE a = 1 AND b = 3", "idx_test_a_b", `[{"id":3}]`},
+			{"SELECT id FROM test WHERE a = 1 AND b > 1", "idx_test_a_b", `[{"id":2},{"id":3},{"id":4}]`},
+			{"SELECT id FROM test WHERE a = 1 ORDER BY b DESC", "idx_test_a_b", `[{"id":4},{"id":3},{"id":2},{"id":1}]`},
+			// the single field index is used without conditions on b
+			{"SELECT id FROM test WHERE a = 1", "idx_test_a", `[{"id":1},{"id":2},{"id":3},{"id":4}]`},
+		}
+
+		for _, test := range tests {
+			d, err := db.QueryDocument("EXPLAIN " + test.query)
+			require.NoError(t, err)
+			v, err := document.ValuePath{"access", "index"}.GetValue(d)
+			require.NoError(t, err)
+			require.Equal(t, document.NewStringValue(test.index), v, test.query)
+
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String(), test.query)
+		}
+	})
+
+	t.Run("Updates and deletes", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a_b ON test (a, b);
+			INSERT INTO test VALUES {id: 1, a: 1, b: 1}, {id: 2, a: 1, b: 2}, {id: 3, a: 1};
+			UPDATE test SET b = 10 WHERE id = 1;
+			DELETE FROM test WHERE id = 2;
+		`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT id FROM test WHERE a = 1 ORDER BY b")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":3},{"id":1}]`, buf.String())
+	})
+
+	t.Run("Unique", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE UNIQUE INDEX idx_test_a_b ON test (a, b);
+			INSERT INTO test VALUES {a: 1, b: 1}, {a: 1, b: 2}, {a: 2, b: 1};
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test VALUES {a: 1, b: 1.0}")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = db.Exec(`
+			CREATE TABLE other;
+			INSERT INTO other VALUES {a: 'x', b: 1}, {a: 'x', b: 1};
+		`)
+		require.NoError(t, err)
+		err = db.Exec("CREATE UNIQUE INDEX idx_other_a_b ON other (a, b)")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `duplicate value ["x",1]`)
+	})
+}
+
+func TestCompositePrimaryKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		params   []interface{}
+	}{
+		{"No condition", "SELECT id FROM test", `[{"id":1},{"id":2},{"id":3},{"id":4},{"id":7},{"id":5},{"id":6}]`, nil},
+		{"Eq on all fields", "SELECT id FROM test WHERE tenant = 1 AND created = 3", `[{"id":3}]`, nil},
+		{"Eq on leading field", "SELECT id FROM test WHERE tenant = 2", `[{"id":5},{"id":6}]`, nil},
+		{"Eq and GT", "SELECT id FROM test WHERE tenant = 1 AND created > 2", `[{"id":3},{"id":4}]`, nil},
+		{"Eq and LTE", "SELECT id FROM test WHERE 3 >= created AND tenant = 1", `[{"id":1},{"id":2},{"id":3}]`, nil},
+		{"Params", "SELECT id FROM test WHERE tenant = ? AND created < ?", `[{"id":5}]`, []interface{}{2, 2}},
+		{"Order by leading field desc", "SELECT id FROM test ORDER BY tenant DESC LIMIT 2", `[{"id":6},{"id":5}]`, nil},
+		{"Range and order by desc", "SELECT id FROM test WHERE tenant = 1 AND created >= 2 ORDER BY created DESC", `[{"id":4},{"id":3},{"id":2}]`, nil},
+		{"Two bounds", "SELECT id FROM test WHERE tenant = 1 AND created > 1 AND created <= 3", `[{"id":2},{"id":3}]`, nil},
+		{"Key", "SELECT key() FROM test WHERE tenant = 2 AND created = 1", `[{"tenant":2,"created":1}]`, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test(PRIMARY KEY (tenant, created));
+				INSERT INTO test VALUES {id: 6, tenant: 2, created: 2}, {id: 5, tenant: 2, created: 1};
+				INSERT INTO test VALUES {id: 3, tenant: 1, created: 3}, {id: 4, tenant: 1, created: 4};
+				INSERT INTO test VALUES {id: 1, tenant: 1, created: 1}, {id: 2, tenant: 1, created: 2};
+				INSERT INTO test VALUES {id: 7, tenant: 1, created: 'b'};
+			`)
+			require.NoError(t, err)
+
+			st, err := db.Query(test.query, test.params...)
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run("Constraints", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test(PRIMARY KEY (a, b));
+			INSERT INTO test VALUES {a: 1, b: 1}, {a: 1, b: 2};
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test VALUES {a: 1, b: 1}")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = db.Exec("INSERT INTO test VALUES {a: 2}")
+		require.EqualError(t, err, `missing primary key at path "b"`)
+	})
+}
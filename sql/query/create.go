@@ -3,6 +3,7 @@ package query
 import (
 	"database/sql/driver"
 	"errors"
+	"fmt"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
@@ -37,12 +38,48 @@ func (stmt CreateTableStmt) Run(tx *database.Transaction, args []driver.NamedVal
 	return res, err
 }
 
+// NewCheckFunc returns a function evaluating e as the expression of a CHECK constraint
+// against a document. The document satisfies the constraint unless e evaluates to a value
+// that is neither NULL nor truthy. A field that doesn't exist evaluates to NULL.
+// It returns an error if e contains an aggregate function or a subquery,
+// which can't be evaluated against a single document.
+func NewCheckFunc(e Expr) (database.CheckFunc, error) {
+	if len(collectAggregators(nil, e)) > 0 {
+		return nil, errors.New("aggregate functions are not allowed in check constraints")
+	}
+
+	var hasSubquery bool
+	transformExpr(e, func(e Expr) (Expr, bool) {
+		if _, ok := e.(Subquery); ok {
+			hasSubquery = true
+		}
+		return e, false
+	})
+	if hasSubquery {
+		return nil, errors.New("subqueries are not allowed in check constraints")
+	}
+
+	return func(tx *database.Transaction, d document.Document) (bool, error) {
+		v, err := e.Eval(EvalStack{Tx: tx, Document: d})
+		if err == document.ErrFieldNotFound {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return v.Type == document.NullValue || v.IsTruthy(), nil
+	}, nil
+}
+
 // CreateIndexStmt is a DSL that allows creating a full CREATE INDEX statement.
 // It is typically created using the CreateIndex function.
 type CreateIndexStmt struct {
-	IndexName   string
-	TableName   string
-	Path        document.ValuePath
+	IndexName string
+	TableName string
+	Path      document.ValuePath
+	// Paths of the fields of a composite index. Path must be empty if Paths is set.
+	Paths       []document.ValuePath
 	IfNotExists bool
 	Unique      bool
 }
@@ -53,6 +90,7 @@ func (stmt CreateIndexStmt) IsReadOnly() bool {
 }
 
 // Run runs the Create index statement in the given transaction.
+// The documents already stored in the table are indexed in the same transaction.
 // It implements the Statement interface.
 func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
 	var res Result
@@ -65,19 +103,27 @@ func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []driver.NamedVal
 		return res, errors.New("missing index name")
 	}
 
-	if len(stmt.Path) == 0 {
+	if len(stmt.Path) == 0 && len(stmt.Paths) == 0 {
 		return res, errors.New("missing path")
 	}
 
+	for i, p := range stmt.Paths {
+		for _, other := range stmt.Paths[:i] {
+			if p.String() == other.String() {
+				return res, fmt.Errorf("field %q indexed more than once", p)
+			}
+		}
+	}
+
 	err := tx.CreateIndex(database.IndexConfig{
 		Unique:    stmt.Unique,
 		IndexName: stmt.IndexName,
 		TableName: stmt.TableName,
 		Path:      stmt.Path,
+		Paths:     stmt.Paths,
 	})
 	if stmt.IfNotExists && err == database.ErrIndexAlreadyExists {
-		err = nil
+		return res, nil
 	}
-
 	return res, err
 }
@@ -1,6 +1,7 @@
 package query_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/asdine/genji"
@@ -22,6 +23,10 @@ func TestCreateTable(t *testing.T) {
 		{"If not exists, twice", "CREATE TABLE IF NOT EXISTS test;CREATE TABLE IF NOT EXISTS test", false},
 		{"With primary key", "CREATE TABLE test(foo STRING PRIMARY KEY)", false},
 		{"With field constraints key", "CREATE TABLE test(foo.a.1.2 STRING, bar.4.0.bat int8)", false},
+		{"With NOT NULL, UNIQUE and DEFAULT", "CREATE TABLE test(email TEXT NOT NULL UNIQUE, created INT64 DEFAULT 0)", false},
+		{"With invalid DEFAULT", "CREATE TABLE test(created INT64 DEFAULT 'foo')", true},
+		{"With CHECK constraints", "CREATE TABLE test(CHECK (price >= 0), CONSTRAINT valid_range CHECK (end > start))", false},
+		{"With duplicate CHECK names", "CREATE TABLE test(CONSTRAINT c CHECK (a > 0), CONSTRAINT c CHECK (b > 0))", true},
 	}
 
 	for _, test := range tests {
@@ -72,6 +77,477 @@ func TestCreateTable(t *testing.T) {
 		})
 		require.NoError(t, err)
 	})
+
+	t.Run("NOT NULL, UNIQUE and DEFAULT constraints", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test(email TEXT NOT NULL UNIQUE, created INT64 DEFAULT 0)")
+		require.NoError(t, err)
+
+		err = db.ViewTable("test", func(tx *genji.Tx, tb *database.Table) error {
+			cfg, err := tb.Config()
+			if err != nil {
+				return err
+			}
+
+			// the default value is converted to the type of the field
+			require.Equal(t, []database.FieldConstraint{
+				{Path: []string{"email"}, Type: document.StringValue, NotNull: true, Unique: true},
+				{Path: []string{"created"}, Type: document.Int64Value, DefaultValue: document.NewInt64Value(0)},
+			}, cfg.FieldConstraints)
+
+			// a unique index is created for the UNIQUE constraint
+			indexes, err := tb.Indexes()
+			if err != nil {
+				return err
+			}
+			require.Len(t, indexes, 1)
+			require.True(t, indexes["email"].Unique)
+			return nil
+		})
+		require.NoError(t, err)
+
+		tests := []struct {
+			name  string
+			query string
+			fails bool
+		}{
+			{"Missing NOT NULL field", "INSERT INTO test (created) VALUES (1)", true},
+			{"NULL NOT NULL field", "INSERT INTO test (email) VALUES (NULL)", true},
+			{"Duplicate UNIQUE field", "INSERT INTO test (email) VALUES ('a@b.c')", true},
+			{"Other UNIQUE field", "INSERT INTO test (email) VALUES ('b@c.d')", false},
+			{"Update NOT NULL field to NULL", "UPDATE test SET email = NULL", true},
+			{"Update NOT NULL field", "UPDATE test SET email = 'b@c.d'", false},
+		}
+
+		err = db.Exec("INSERT INTO test (email) VALUES ('a@b.c')")
+		require.NoError(t, err)
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				err = tx.Exec(test.query)
+				if test.fails {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+			})
+		}
+
+		// missing fields are set to their default value
+		d, err := db.QueryDocument("SELECT created FROM test")
+		require.NoError(t, err)
+		v, err := d.GetByField("created")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt64Value(0), v)
+	})
+
+	t.Run("UNIQUE constraint", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test(id INT PRIMARY KEY, email TEXT UNIQUE);
+			INSERT INTO test (id) VALUES (1);
+			INSERT INTO test (id) VALUES (2);
+			INSERT INTO test (id, email) VALUES (3, NULL);
+			INSERT INTO test (id, email) VALUES (4, NULL);
+			INSERT INTO test (id, email) VALUES (5, 'a@b.c');
+		`)
+		require.NoError(t, err, "missing and NULL values are not unique")
+
+		err = db.Exec("INSERT INTO test (id, email) VALUES (6, 'a@b.c')")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = db.Exec("UPDATE test SET email = 'a@b.c' WHERE id = 3")
+		require.Equal(t, database.ErrDuplicateDocument, err)
+
+		err = db.Exec("UPDATE test SET email = NULL WHERE id = 5")
+		require.NoError(t, err)
+
+		var n int
+		d, err := db.QueryDocument("SELECT COUNT(*) FROM test WHERE email IS NULL")
+		require.NoError(t, err)
+		err = document.Scan(d, &n)
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+	})
+}
+
+func TestCreateTableCheck(t *testing.T) {
+	db, err := genji.New(memoryengine.NewEngine())
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE test(
+			price NUMERIC,
+			CHECK (price >= 0),
+			CONSTRAINT valid_range CHECK (end > start),
+			CHECK (name != 'none'),
+			CHECK (enabled)
+		);
+		INSERT INTO test (price, start, end) VALUES (10, 1, 2);
+	`)
+	require.NoError(t, err)
+
+	err = db.ViewTable("test", func(_ *genji.Tx, tb *database.Table) error {
+		cfg, err := tb.Config()
+		if err != nil {
+			return err
+		}
+
+		// unnamed constraints are named after the table and their position
+		require.Equal(t, []database.CheckConstraint{
+			{Name: "test_check_1", Expr: "price >= 0"},
+			{Name: "valid_range", Expr: "end > start"},
+			{Name: "test_check_3", Expr: `name != "none"`},
+			{Name: "test_check_4", Expr: "enabled"},
+		}, cfg.Checks)
+		return nil
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		query      string
+		constraint string
+	}{
+		{"Valid insert", "INSERT INTO test (price, start, end, name) VALUES (1, 1, 2, 'foo')", ""},
+		{"Negative price", "INSERT INTO test (price, start, end) VALUES (-1, 1, 2)", "test_check_1"},
+		{"Invalid range", "INSERT INTO test (price, start, end) VALUES (1, 2, 1)", "valid_range"},
+		{"Missing field", "INSERT INTO test (price, start) VALUES (1, 2)", ""},
+		{"Invalid name", "INSERT INTO test (price, start, end, name) VALUES (1, 1, 2, 'none')", "test_check_3"},
+		{"Disabled", "INSERT INTO test (price, start, end, enabled) VALUES (1, 1, 2, false)", "test_check_4"},
+		{"Valid update", "UPDATE test SET price = 0", ""},
+		{"Invalid update", "UPDATE test SET start = 5", "valid_range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = tx.Exec(test.query)
+			if test.constraint == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Equal(t, &database.CheckError{Constraint: test.constraint}, err)
+		})
+	}
+}
+
+func TestCreateTableReferences(t *testing.T) {
+	t.Run("Referenced fields", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query string
+			fails bool
+		}{
+			{"Primary key", "CREATE TABLE pets(owner INT REFERENCES users(id))", false},
+			{"Unique index", "CREATE TABLE pets(owner TEXT REFERENCES users(email))", false},
+			{"Unique constraint", "CREATE TABLE pets(owner TEXT REFERENCES users(name))", false},
+			{"Self reference", "CREATE TABLE pets(id INT PRIMARY KEY, mother INT REFERENCES pets(id))", false},
+			{"Non unique index", "CREATE TABLE pets(owner INT REFERENCES users(age))", true},
+			{"Non indexed field", "CREATE TABLE pets(owner INT REFERENCES users(city))", true},
+			{"Unknown table", "CREATE TABLE pets(owner INT REFERENCES unknown(id))", true},
+			{"Self reference to non unique field", "CREATE TABLE pets(mother INT REFERENCES pets(name))", true},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users(id INT PRIMARY KEY, name TEXT UNIQUE);
+					CREATE UNIQUE INDEX idx_users_email ON users(email);
+					CREATE INDEX idx_users_age ON users(age);
+				`)
+				require.NoError(t, err)
+
+				err = db.Exec(test.query)
+				if test.fails {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+			})
+		}
+	})
+
+	newDB := func(t *testing.T) *genji.DB {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+
+		err = db.Exec(`
+			CREATE TABLE users(id INT PRIMARY KEY, email TEXT UNIQUE);
+			CREATE TABLE pets(
+				name TEXT,
+				owner INT REFERENCES users(id) ON DELETE CASCADE,
+				vet TEXT REFERENCES users(email) ON DELETE SET NULL
+			);
+			CREATE TABLE toys(name TEXT PRIMARY KEY, pet TEXT);
+			CREATE TABLE payments(user INT REFERENCES users(id));
+			INSERT INTO users (id, email) VALUES (1, 'a@b.c'), (2, 'b@c.d'), (3, 'c@d.e');
+			INSERT INTO pets (name, owner, vet) VALUES ('rex', 1, 'b@c.d'), ('kitty', 1, 'c@d.e'), ('nemo', 2, 'c@d.e');
+			INSERT INTO payments (user) VALUES (3);
+		`)
+		require.NoError(t, err)
+
+		return db
+	}
+
+	t.Run("Insert and update", func(t *testing.T) {
+		db := newDB(t)
+		defer db.Close()
+
+		tests := []struct {
+			name  string
+			query string
+			fails bool
+		}{
+			{"Existing references", "INSERT INTO pets (name, owner, vet) VALUES ('felix', 2, 'a@b.c')", false},
+			{"Converted reference", "INSERT INTO pets (name, owner) VALUES ('felix', 2.0)", false},
+			{"Missing reference", "INSERT INTO pets (name) VALUES ('felix')", false},
+			{"NULL reference", "INSERT INTO pets (name, owner) VALUES ('felix', NULL)", false},
+			{"Unknown primary key", "INSERT INTO pets (name, owner) VALUES ('felix', 10)", true},
+			{"Unknown unique field", "INSERT INTO pets (name, vet) VALUES ('felix', 'x@y.z')", true},
+			{"Valid update", "UPDATE pets SET owner = 3 WHERE name = 'rex'", false},
+			{"Invalid update", "UPDATE pets SET owner = 10 WHERE name = 'rex'", true},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				err = tx.Exec(test.query)
+				if test.fails {
+					require.IsType(t, &database.ForeignKeyError{}, err)
+					return
+				}
+				require.NoError(t, err)
+			})
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		db := newDB(t)
+		defer db.Close()
+
+		tests := []struct {
+			name     string
+			query    string
+			fails    bool
+			expected string
+		}{
+			// the pets of user 1 are deleted, user 2 is not the vet of any remaining pet
+			{"Cascade", "DELETE FROM users WHERE id = 1", false, `[{"name":"nemo","owner":2,"vet":"c@d.e"}]`},
+			// user 2 is the vet of rex, and the owner of nemo
+			{"Set null and cascade", "DELETE FROM users WHERE id = 2", false, `[{"name":"rex","owner":1,"vet":null},{"name":"kitty","owner":1,"vet":"c@d.e"}]`},
+			// user 3 is referenced by payments, which restricts deletions
+			{"Restrict", "DELETE FROM users WHERE id = 3", true, ""},
+			{"Referencing documents", "DELETE FROM pets WHERE owner = 1", false, `[{"name":"nemo","owner":2,"vet":"c@d.e"}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				err = tx.Exec(test.query)
+				if test.fails {
+					require.Equal(t, &database.ForeignKeyError{Table: "payments", Path: document.NewValuePath("user"), References: "users"}, err)
+					return
+				}
+				require.NoError(t, err)
+
+				st, err := tx.Query("SELECT * FROM pets")
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("Drop and rename referenced tables", func(t *testing.T) {
+		db := newDB(t)
+		defer db.Close()
+
+		err := db.Exec("DROP TABLE users")
+		require.Error(t, err)
+
+		err = db.Exec("ALTER TABLE users RENAME TO people")
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO pets (name, owner) VALUES ('felix', 2)")
+		require.NoError(t, err)
+		err = db.Exec("INSERT INTO pets (name, owner) VALUES ('felix', 10)")
+		require.Error(t, err)
+
+		err = db.Exec("DROP TABLE pets; DROP TABLE payments; DROP TABLE people")
+		require.NoError(t, err)
+	})
+
+	t.Run("Referencing fields are indexed", func(t *testing.T) {
+		db := newDB(t)
+		defer db.Close()
+
+		err := db.ViewTable("pets", func(_ *genji.Tx, tb *database.Table) error {
+			indexes, err := tb.Indexes()
+			if err != nil {
+				return err
+			}
+
+			require.Len(t, indexes, 2)
+			require.False(t, indexes["owner"].Unique)
+			require.False(t, indexes["vet"].Unique)
+			return nil
+		})
+		require.NoError(t, err)
+
+		err = db.Exec("ALTER TABLE pets DROP FIELD owner")
+		require.NoError(t, err)
+
+		err = db.ViewTable("pets", func(_ *genji.Tx, tb *database.Table) error {
+			indexes, err := tb.Indexes()
+			if err != nil {
+				return err
+			}
+
+			require.Len(t, indexes, 1)
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("Update referenced fields", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			query    string
+			fails    bool
+			expected string
+		}{
+			{"Cascade", "UPDATE users SET email = 'z@z.z' WHERE id = 1", false, `[{"title":"foo","author":"z@z.z","editor":"b","reviewer":"y"}]`},
+			{"Set null", "UPDATE users SET login = 'c' WHERE id = 2", false, `[{"title":"foo","author":"a@b.c","editor":null,"reviewer":"y"}]`},
+			{"Restrict", "UPDATE users SET nick = 'z' WHERE id = 2", true, ``},
+			{"Same value", "UPDATE users SET nick = 'y' WHERE id = 2", false, `[{"title":"foo","author":"a@b.c","editor":"b","reviewer":"y"}]`},
+			{"Unreferenced value", "UPDATE users SET nick = 'z' WHERE id = 1", false, `[{"title":"foo","author":"a@b.c","editor":"b","reviewer":"y"}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users(id INT PRIMARY KEY, email TEXT UNIQUE, login TEXT UNIQUE, nick TEXT UNIQUE);
+					CREATE TABLE posts(
+						title TEXT,
+						author TEXT REFERENCES users(email) ON UPDATE CASCADE,
+						editor TEXT REFERENCES users(login) ON DELETE CASCADE ON UPDATE SET NULL,
+						reviewer TEXT REFERENCES users(nick) ON UPDATE RESTRICT
+					);
+					INSERT INTO users (id, email, login, nick) VALUES (1, 'a@b.c', 'a', 'x'), (2, 'b@c.d', 'b', 'y');
+					INSERT INTO posts (title, author, editor, reviewer) VALUES ('foo', 'a@b.c', 'b', 'y');
+				`)
+				require.NoError(t, err)
+
+				err = db.Exec(test.query)
+				if test.fails {
+					require.Equal(t, &database.ForeignKeyError{Table: "posts", Path: document.NewValuePath("reviewer"), References: "users"}, err)
+					return
+				}
+				require.NoError(t, err)
+
+				st, err := db.Query("SELECT * FROM posts")
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("Update referenced primary keys", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			query    string
+			fails    bool
+			expected string
+		}{
+			{"Cascade", "UPDATE users SET id = 10 WHERE id = 1", false, `[{"title":"foo","author":10,"editor":2},{"title":"bar","author":10,"editor":null}]`},
+			{"Cascade on table scan", "UPDATE users SET id = id + 10", false, `[{"title":"foo","author":11,"editor":null},{"title":"bar","author":11,"editor":null}]`},
+			{"Set null", "UPDATE users SET id = 20 WHERE id = 2", false, `[{"title":"foo","author":1,"editor":null},{"title":"bar","author":1,"editor":1}]`},
+			{"Duplicate", "UPDATE users SET id = 2 WHERE id = 1", true, ``},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users(id INT PRIMARY KEY);
+					CREATE TABLE posts(
+						title TEXT,
+						author INT REFERENCES users(id) ON UPDATE CASCADE,
+						editor INT REFERENCES users(id) ON UPDATE SET NULL
+					);
+					INSERT INTO users (id) VALUES (1), (2);
+					INSERT INTO posts (title, author, editor) VALUES ('foo', 1, 2), ('bar', 1, 1);
+				`)
+				require.NoError(t, err)
+
+				err = db.Exec(test.query)
+				if test.fails {
+					require.Equal(t, database.ErrDuplicateDocument, err)
+					return
+				}
+				require.NoError(t, err)
+
+				st, err := db.Query("SELECT * FROM posts")
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+
+				// the documents are moved to their new key
+				d, err := db.QueryDocument("SELECT COUNT(*) FROM users WHERE id > 2")
+				require.NoError(t, err)
+				var count int
+				err = document.Scan(d, &count)
+				require.NoError(t, err)
+				require.NotZero(t, count)
+			})
+		}
+	})
 }
 
 func TestCreateIndex(t *testing.T) {
@@ -84,7 +560,8 @@ func TestCreateIndex(t *testing.T) {
 		{"If not exists", "CREATE INDEX IF NOT EXISTS idx ON test (foo.bar)", false},
 		{"Unique", "CREATE UNIQUE INDEX IF NOT EXISTS idx ON test (foo.1)", false},
 		{"No fields", "CREATE INDEX idx ON test", true},
-		{"More than 1 field", "CREATE INDEX idx ON test (foo, bar)", true},
+		{"Composite", "CREATE INDEX idx ON test (foo, bar.baz)", false},
+		{"Composite with duplicate fields", "CREATE INDEX idx ON test (foo, bar, foo)", true},
 	}
 
 	for _, test := range tests {
@@ -104,4 +581,62 @@ func TestCreateIndex(t *testing.T) {
 			require.NoError(t, err)
 		})
 	}
+	t.Run("With existing documents", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			INSERT INTO test VALUES {a: 1}, {a: 2}, {b: 3};
+			CREATE INDEX idx_a ON test (a);
+		`)
+		require.NoError(t, err)
+
+		err = db.View(func(tx *genji.Tx) error {
+			idx, err := tx.GetIndex("idx_a")
+			require.NoError(t, err)
+
+			var values []document.Value
+			err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+				values = append(values, val)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, values, 3)
+			return nil
+		})
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT b FROM test WHERE a IS NULL")
+		require.NoError(t, err)
+		v, err := d.GetByField("b")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt8Value(3), v)
+	})
+
+	t.Run("Unique with duplicate values", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			INSERT INTO test VALUES {a: 1}, {a: 'foo'}, {a: 'foo'};
+		`)
+		require.NoError(t, err)
+
+		err = db.Exec("CREATE UNIQUE INDEX idx_a ON test (a)")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"idx_a"`)
+		require.Contains(t, err.Error(), `"foo"`)
+
+		// the index must not have been created
+		err = db.View(func(tx *genji.Tx) error {
+			_, err := tx.GetIndex("idx_a")
+			require.Equal(t, database.ErrIndexNotFound, err)
+			return nil
+		})
+		require.NoError(t, err)
+	})
 }
@@ -22,35 +22,61 @@ func (stmt DeleteStmt) IsReadOnly() bool {
 	return false
 }
 
+// explain returns a document describing how the statement reads the table,
+// without running it. It implements the explainer interface.
+func (stmt DeleteStmt) explain(tx *database.Transaction, args []driver.NamedValue) (document.Document, error) {
+	qo, err := stmt.prepare(tx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return qo.explain()
+}
+
+// prepare returns the query optimizer used to select the documents to delete.
+func (stmt DeleteStmt) prepare(tx *database.Transaction, args []driver.NamedValue) (queryOptimizer, error) {
+	if stmt.TableName == "" {
+		return queryOptimizer{}, errors.New("missing table name")
+	}
+
+	qo, err := newQueryOptimizer(tx, stmt.TableName)
+	if err != nil {
+		return qo, err
+	}
+
+	qo.whereExpr, _ = transformExpr(stmt.WhereExpr, bindSubqueries([]string{stmt.TableName}, false))
+	qo.args = args
+	return qo, nil
+}
+
 // Run deletes matching documents by batches of deleteBufferSize documents.
+// The documents are selected using the primary key or an index if the WHERE clause allows it.
 // Some engines can't iterate while deleting keys (https://github.com/etcd-io/bbolt/issues/146)
 // and some can't create more than one iterator per read-write transaction (https://github.com/dgraph-io/badger/issues/1093).
 // To deal with these limitations, Run will iterate on a limited number of documents, copy the keys
 // to a buffer and delete them after the iteration is complete, and it will do that until there is no document
-// left to delete.
+// left to delete. Since deleted documents are removed from the table and its indexes, every iteration
+// starts from the beginning.
 // Increasing deleteBufferSize will occasionate less key searches (O(log n) for most engines) but will take more memory.
 func (stmt DeleteStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
 	var res Result
-	if stmt.TableName == "" {
-		return res, errors.New("missing table name")
-	}
-
-	stack := EvalStack{Tx: tx, Params: args}
 
-	t, err := tx.GetTable(stmt.TableName)
+	qo, err := stmt.prepare(tx, args)
 	if err != nil {
 		return res, err
 	}
 
-	st := document.NewStream(t)
-	st = st.Filter(whereClause(stmt.WhereExpr, stack)).Limit(deleteBufferSize)
-
 	keys := make([][]byte, deleteBufferSize)
 
 	for {
 		var i int
 
-		err = st.Iterate(func(d document.Document) error {
+		st, err := qo.optimizeQuery()
+		if err != nil {
+			return res, err
+		}
+
+		err = st.Limit(deleteBufferSize).Iterate(func(d document.Document) error {
 			k, ok := d.(document.Keyer)
 			if !ok {
 				return errors.New("attempt to delete document without key")
@@ -64,10 +90,8 @@ func (stmt DeleteStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 			return res, err
 		}
 
-		keys = keys[:i]
-
-		for _, key := range keys {
-			err = t.Delete(key)
+		for _, key := range keys[:i] {
+			err = qo.t.Delete(key)
 			if err != nil {
 				return res, err
 			}
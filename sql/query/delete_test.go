@@ -20,6 +20,7 @@ func TestDeleteStmt(t *testing.T) {
 	}{
 		{"No cond", `DELETE FROM test`, false, "", nil},
 		{"With cond", "DELETE FROM test WHERE b = 'bar1'", false, `{"d": "foo3", "b": "bar2", "e": "bar3"}`, nil},
+		{"With cond in parentheses", "DELETE FROM test WHERE (b = 'bar1')", false, `{"d": "foo3", "b": "bar2", "e": "bar3"}`, nil},
 		{"Table not found", "DELETE FROM foo WHERE b = 'bar1'", true, "", nil},
 	}
 
@@ -59,4 +60,85 @@ func TestDeleteStmt(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("with indexes", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY);
+			CREATE INDEX idx_test_a ON test (a);
+			INSERT INTO test VALUES {id: 1, a: 0}, {id: 2, a: 1}, {id: 3, a: 2}, {id: 4, a: 3};
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			access   string
+			expected string
+		}{
+			{"DELETE FROM test WHERE a = 1", "index iterator", `[{"id":1,"a":0},{"id":3,"a":2},{"id":4,"a":3}]`},
+			{"DELETE FROM test WHERE a >= 2", "index iterator", `[{"id":1,"a":0},{"id":2,"a":1}]`},
+			{"DELETE FROM test WHERE id = 2", "pk iterator", `[{"id":1,"a":0},{"id":3,"a":2},{"id":4,"a":3}]`},
+			{"DELETE FROM test WHERE id > 1 AND id < 4", "pk iterator", `[{"id":1,"a":0},{"id":4,"a":3}]`},
+			{"DELETE FROM test WHERE a = 3 OR id = 2", "union", `[{"id":1,"a":0},{"id":3,"a":2}]`},
+			{"DELETE FROM test WHERE a > 0 AND id != 3", "index iterator", `[{"id":1,"a":0},{"id":3,"a":2}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				// changes are rolled back after each test
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				d, err := tx.QueryDocument("EXPLAIN " + test.query)
+				require.NoError(t, err)
+				v, err := document.ValuePath{"access", "type"}.GetValue(d)
+				require.NoError(t, err)
+				require.Equal(t, document.NewStringValue(test.access), v)
+
+				err = tx.Exec(test.query)
+				require.NoError(t, err)
+
+				st, err := tx.Query("SELECT * FROM test")
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("more documents than the buffer", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test; CREATE INDEX idx_test_a ON test (a)")
+		require.NoError(t, err)
+		for i := 0; i < 250; i++ {
+			err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i%2, i)
+			require.NoError(t, err)
+		}
+
+		err = db.Exec("DELETE FROM test WHERE a = 0")
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*) FROM test WHERE a = 0")
+		require.NoError(t, err)
+		v, err := d.GetByField("COUNT(*)")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt64Value(0), v)
+
+		d, err = db.QueryDocument("SELECT COUNT(*) FROM test")
+		require.NoError(t, err)
+		v, err = d.GetByField("COUNT(*)")
+		require.NoError(t, err)
+		require.Equal(t, document.NewInt64Value(125), v)
+	})
 }
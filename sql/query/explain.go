@@ -0,0 +1,263 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// ExplainStmt is a DSL that allows creating a full EXPLAIN statement.
+// It describes how Statement reads the documents of its table, without running it.
+type ExplainStmt struct {
+	Statement Statement
+}
+
+// An explainer is a statement that can describe how it reads the documents of its table.
+type explainer interface {
+	explain(tx *database.Transaction, args []driver.NamedValue) (document.Document, error)
+}
+
+// IsReadOnly always returns true, the explained statement is not run. It implements the Statement interface.
+func (stmt ExplainStmt) IsReadOnly() bool {
+	return true
+}
+
+// Run returns a single document describing the plan of the explained statement.
+// It implements the Statement interface.
+func (stmt ExplainStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	e, ok := stmt.Statement.(explainer)
+	if !ok {
+		return res, errors.New("only SELECT, UPDATE and DELETE statements can be explained")
+	}
+
+	d, err := e.explain(tx, args)
+	if err != nil {
+		return res, err
+	}
+
+	return Result{Stream: document.NewStream(document.NewIterator(d))}, nil
+}
+
+// explain returns a document describing the plan of the query:
+// the table, how its documents are read, the filter applied to them,
+// the joined tables and how the documents are sorted.
+func (qo *queryOptimizer) explain() (*document.FieldBuffer, error) {
+	qp := qo.buildQueryPlan()
+
+	desc := len(qo.orderBy) != 0 && qo.orderBy[0].Direction == scanner.DESC
+
+	var access *document.FieldBuffer
+	switch {
+	case qp.scanTable:
+		access = document.NewFieldBuffer().Add("type", document.NewStringValue("table scan"))
+	case qp.composite != nil:
+		access = qo.explainComposite(qp.composite)
+	default:
+		access = qo.explainField(qp.field)
+	}
+
+	// ranges and full scans are read in reverse order to return the documents sorted
+	if qp.sorted && desc {
+		access.Add("reverse", document.NewBoolValue(true))
+	}
+
+	fb := document.NewFieldBuffer().
+		Add("table", document.NewStringValue(qo.tableName)).
+		Add("access", document.NewDocumentValue(access)).
+		Add("filter", explainExpr(qo.whereExpr))
+
+	if len(qo.joins) != 0 {
+		joins, err := qo.explainJoins()
+		if err != nil {
+			return nil, err
+		}
+
+		fb.Add("joins", document.NewArrayValue(joins))
+	}
+
+	if len(qo.orderBy) != 0 {
+		keys := make([]string, len(qo.orderBy))
+		for i, o := range qo.orderBy {
+			keys[i] = o.Path.String()
+			if o.Direction == scanner.DESC {
+				keys[i] += " DESC"
+			}
+		}
+
+		sort := document.NewFieldBuffer().Add("keys", document.NewStringValue(strings.Join(keys, ", ")))
+		limit := qo.tx.DB().SortMemoryLimit
+		switch {
+		case qp.sorted:
+			sort.Add("method", document.NewStringValue("read order"))
+		case limit <= 0:
+			sort.Add("method", document.NewStringValue("memory"))
+		default:
+			// documents exceeding the limit are sorted using temporary files
+			sort.Add("method", document.NewStringValue("memory or temporary files"))
+			sort.Add("memory_limit", document.NewIntValue(limit))
+		}
+		fb.Add("sort", document.NewDocumentValue(sort))
+	}
+
+	return fb, nil
+}
+
+// explainField describes the iterator used to read the documents selected by f.
+func (qo *queryOptimizer) explainField(f *queryPlanField) *document.FieldBuffer {
+	fb := document.NewFieldBuffer()
+
+	var typ string
+	var iterators []*queryPlanField
+	switch {
+	case f.union != nil:
+		typ, iterators = "union", f.union
+	case f.intersection != nil:
+		typ, iterators = "intersection", f.intersection
+	}
+
+	if typ != "" {
+		var vb document.ValueBuffer
+		for _, sub := range iterators {
+			vb = vb.Append(document.NewDocumentValue(qo.explainField(sub)))
+		}
+
+		return fb.Add("type", document.NewStringValue(typ)).
+			Add("iterators", document.NewArrayValue(vb))
+	}
+
+	if f.isPrimaryKey {
+		fb.Add("type", document.NewStringValue("pk iterator"))
+	} else {
+		fb.Add("type", document.NewStringValue("index iterator")).
+			Add("index", document.NewStringValue(qo.indexes[f.indexedField.Name()].IndexName))
+	}
+
+	var bounds Expr
+	switch {
+	case f.rng != nil:
+		bounds = f.rng.expr(f.indexedField)
+	case f.op == scanner.IN:
+		bounds = In(f.indexedField, f.e)
+	case f.e != nil:
+		bounds = Eq(f.indexedField, f.e)
+	}
+
+	if bounds != nil {
+		fb.Add("bounds", explainExpr(bounds))
+	}
+
+	return fb
+}
+
+// explainComposite describes the iterator used to read the documents selected by a composite plan.
+func (qo *queryOptimizer) explainComposite(cp *compositePlan) *document.FieldBuffer {
+	fb := document.NewFieldBuffer()
+
+	paths := qo.cfg.PrimaryKeyPaths
+	if cp.primaryKey {
+		fb.Add("type", document.NewStringValue("pk iterator"))
+	} else {
+		paths = cp.index.Paths
+		fb.Add("type", document.NewStringValue("index iterator")).
+			Add("index", document.NewStringValue(cp.index.IndexName))
+	}
+
+	var bounds Expr
+	for i, e := range cp.eq {
+		bounds = andExpr(bounds, Eq(FieldSelector(paths[i]), e))
+	}
+	if cp.rng != nil {
+		bounds = andExpr(bounds, cp.rng.expr(FieldSelector(paths[len(cp.eq)])))
+	}
+
+	if bounds != nil {
+		fb.Add("bounds", explainExpr(bounds))
+	}
+
+	return fb
+}
+
+// explainJoins describes how the documents of every joined table are looked up.
+func (qo *queryOptimizer) explainJoins() (document.ValueBuffer, error) {
+	var vb document.ValueBuffer
+
+	joined := []string{qo.tableName}
+	if qo.tableAlias != "" {
+		joined[0] = qo.tableAlias
+	}
+
+	for _, j := range qo.joins {
+		it, err := qo.newJoinIterator(j, joined)
+		if err != nil {
+			return nil, err
+		}
+		joined = append(joined, it.name)
+
+		fb := document.NewFieldBuffer().Add("table", document.NewStringValue(j.TableName))
+		switch {
+		case it.key == nil:
+			fb.Add("type", document.NewStringValue("table scan"))
+		case it.isPrimaryKey:
+			fb.Add("type", document.NewStringValue("pk iterator"))
+		case it.index != nil:
+			fb.Add("type", document.NewStringValue("index iterator"))
+			if idx, ok := it.index.(database.Index); ok {
+				fb.Add("index", document.NewStringValue(idx.IndexName))
+			}
+		default:
+			fb.Add("type", document.NewStringValue("hash"))
+		}
+
+		if it.key != nil {
+			fb.Add("bounds", explainExpr(Eq(it.key, it.keyExpr)))
+		}
+
+		vb = vb.Append(document.NewDocumentValue(fb))
+	}
+
+	return vb, nil
+}
+
+// expr returns the comparisons of fs with the bounds of the range.
+func (r *valueRange) expr(fs FieldSelector) Expr {
+	var e Expr
+
+	if r.min != nil {
+		e = andExpr(e, cmpExpr(r.minOp(), fs, r.min))
+	}
+
+	if r.max != nil {
+		e = andExpr(e, cmpExpr(r.maxOp(), fs, r.max))
+	}
+
+	return e
+}
+
+// cmpExpr returns the comparison of a with b using op.
+func cmpExpr(op scanner.Token, a, b Expr) Expr {
+	return CmpOp{simpleOperator{a, b, op}}
+}
+
+// andExpr returns a AND b, or b if a is nil.
+func andExpr(a, b Expr) Expr {
+	if a == nil {
+		return b
+	}
+
+	return And(a, b)
+}
+
+// explainExpr returns the SQL representation of e, or NULL if e is nil.
+func explainExpr(e Expr) document.Value {
+	if e == nil {
+		return document.NewNullValue()
+	}
+
+	return document.NewStringValue(exprString(e))
+}
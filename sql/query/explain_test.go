@@ -0,0 +1,123 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainStmt(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+	}{
+		{"Table scan", "EXPLAIN SELECT * FROM test WHERE weight > 1", false,
+			`[{"table":"test","access":{"type":"table scan"},"filter":"weight > 1"}]`},
+		{"No filter", "EXPLAIN SELECT * FROM test", false,
+			`[{"table":"test","access":{"type":"table scan"},"filter":null}]`},
+		{"Pk", "EXPLAIN SELECT * FROM test WHERE k = 1 AND weight = 2", false,
+			`[{"table":"test","access":{"type":"pk iterator","bounds":"k = 1"},"filter":"k = 1 AND weight = 2"}]`},
+		{"Index", "EXPLAIN SELECT * FROM test WHERE color = 'red'", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_color","bounds":"color = \"red\""},"filter":"color = \"red\""}]`},
+		{"Parentheses", "EXPLAIN SELECT * FROM test WHERE (k = 1)", false,
+			`[{"table":"test","access":{"type":"pk iterator","bounds":"k = 1"},"filter":"k = 1"}]`},
+		{"Index with IN", "EXPLAIN SELECT * FROM test WHERE color IN ['red', 'blue']", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_color","bounds":"color IN [\"red\", \"blue\"]"},"filter":"color IN [\"red\", \"blue\"]"}]`},
+		{"Range", "EXPLAIN SELECT * FROM test WHERE 10 < size AND size <= ?", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_size","bounds":"size > 10 AND size <= ?"},"filter":"10 < size AND size <= ?"}]`},
+		{"Union", "EXPLAIN SELECT * FROM test WHERE k = 1 OR color = 'red'", false,
+			`[{"table":"test","access":{"type":"union","iterators":[{"type":"pk iterator","bounds":"k = 1"},{"type":"index iterator","index":"idx_color","bounds":"color = \"red\""}]},"filter":"k = 1 OR color = \"red\""}]`},
+		{"Intersection", "EXPLAIN SELECT * FROM test WHERE size = 10 AND color = 'red'", false,
+			`[{"table":"test","access":{"type":"intersection","iterators":[{"type":"index iterator","index":"idx_size","bounds":"size = 10"},{"type":"index iterator","index":"idx_color","bounds":"color = \"red\""}]},"filter":"size = 10 AND color = \"red\""}]`},
+		{"Composite index", "EXPLAIN SELECT * FROM test WHERE shape = 'square' AND height > 10", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_shape_height","bounds":"shape = \"square\" AND height > 10"},"filter":"shape = \"square\" AND height > 10"}]`},
+		{"Sort with index", "EXPLAIN SELECT * FROM test ORDER BY color DESC LIMIT 10 OFFSET 2", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_color","reverse":true},"filter":null,"sort":{"keys":"color DESC","method":"read order"},"limit":10,"offset":2}]`},
+		{"Sort after read", "EXPLAIN SELECT * FROM test WHERE color = 'red' ORDER BY weight", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_color","bounds":"color = \"red\""},"filter":"color = \"red\"","sort":{"keys":"weight","method":"memory or temporary files","memory_limit":67108864}}]`},
+		{"Join", "EXPLAIN SELECT * FROM test AS a JOIN test AS b ON b.k = a.size", false,
+			`[{"table":"test","access":{"type":"table scan"},"filter":null,"joins":[{"table":"test","type":"pk iterator","bounds":"k = a.size"}]}]`},
+		{"Update", "EXPLAIN UPDATE test SET a = 1 WHERE k = 1", false,
+			`[{"table":"test","access":{"type":"pk iterator","bounds":"k = 1"},"filter":"k = 1"}]`},
+		{"Delete", "EXPLAIN DELETE FROM test WHERE size > 10", false,
+			`[{"table":"test","access":{"type":"index iterator","index":"idx_size","bounds":"size > 10"},"filter":"size > 10"}]`},
+		{"Delete without filter", "EXPLAIN DELETE FROM test", false,
+			`[{"table":"test","access":{"type":"table scan"},"filter":null}]`},
+		{"Unknown table", "EXPLAIN SELECT * FROM foo", true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test (k INTEGER PRIMARY KEY);
+				CREATE INDEX idx_color ON test (color);
+				CREATE INDEX idx_size ON test (size);
+				CREATE INDEX idx_shape_height ON test (shape, height);
+				INSERT INTO test (k, color, size) VALUES (1, 'red', 10);
+			`)
+			require.NoError(t, err)
+
+			st, err := db.Query(test.query, 20)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer st.Close()
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run("Sort without memory limit", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+		db.DB.SortMemoryLimit = 0
+
+		err = db.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("EXPLAIN SELECT * FROM test ORDER BY a")
+		require.NoError(t, err)
+		v, err := document.ValuePath{"sort", "method"}.GetValue(d)
+		require.NoError(t, err)
+		require.Equal(t, document.NewStringValue("memory"), v)
+	})
+
+	t.Run("Doesn't modify the table", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			INSERT INTO test (a) VALUES (1);
+			EXPLAIN UPDATE test SET a = 2;
+			EXPLAIN DELETE FROM test;
+		`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT a FROM test")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"a":1}]`, buf.String())
+	})
+}
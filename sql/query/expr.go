@@ -3,6 +3,9 @@ package query
 import (
 	"database/sql/driver"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
@@ -20,6 +23,13 @@ type Expr interface {
 	Eval(EvalStack) (document.Value, error)
 }
 
+// exprString returns the representation of e in SQL, used to name the fields that contain its result.
+// The expressions of this package implement fmt.Stringer to return it, other expressions
+// are formatted with the default format.
+func exprString(e Expr) string {
+	return fmt.Sprint(e)
+}
+
 // EvalStack contains information about the context in which
 // the expression is evaluated.
 // Any of the members can be nil except the transaction.
@@ -118,6 +128,26 @@ func (l LiteralValue) Eval(EvalStack) (document.Value, error) {
 	return document.Value(l), nil
 }
 
+// String returns the value as it would be written in SQL. It implements the fmt.Stringer interface.
+func (l LiteralValue) String() string {
+	v := document.Value(l)
+
+	switch v.Type {
+	case document.StringValue, document.BytesValue:
+		return strconv.Quote(string(v.V.([]byte)))
+	case document.Float64Value:
+		s := strconv.FormatFloat(v.V.(float64), 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	case document.BoolValue:
+		return strconv.FormatBool(v.V.(bool))
+	}
+
+	return v.String()
+}
+
 // LiteralExprList is a list of expressions.
 type LiteralExprList []Expr
 
@@ -135,6 +165,16 @@ func (l LiteralExprList) Eval(stack EvalStack) (document.Value, error) {
 	return document.NewArrayValue(values), nil
 }
 
+// String returns the list of expressions between brackets. It implements the fmt.Stringer interface.
+func (l LiteralExprList) String() string {
+	exprs := make([]string, len(l))
+	for i, e := range l {
+		exprs[i] = exprString(e)
+	}
+
+	return "[" + strings.Join(exprs, ", ") + "]"
+}
+
 // NamedParam is an expression which represents the name of a parameter.
 type NamedParam string
 
@@ -149,6 +189,11 @@ func (p NamedParam) Eval(stack EvalStack) (document.Value, error) {
 	return document.NewValue(v)
 }
 
+// String returns the name of the parameter, prefixed with $. It implements the fmt.Stringer interface.
+func (p NamedParam) String() string {
+	return "$" + string(p)
+}
+
 func (p NamedParam) extract(params []driver.NamedValue) (interface{}, error) {
 	for _, nv := range params {
 		if nv.Name == string(p) {
@@ -173,6 +218,11 @@ func (p PositionalParam) Eval(stack EvalStack) (document.Value, error) {
 	return document.NewValue(v)
 }
 
+// String returns the ? character. It implements the fmt.Stringer interface.
+func (p PositionalParam) String() string {
+	return "?"
+}
+
 func (p PositionalParam) extract(params []driver.NamedValue) (interface{}, error) {
 	idx := int(p - 1)
 	if idx >= len(params) {
@@ -207,6 +257,25 @@ func (op *simpleOperator) SetRightHandExpr(b Expr) {
 	op.b = b
 }
 
+// String returns the operands separated by the operator, adding parentheses
+// around operands that have a lower precedence.
+func (op simpleOperator) String() string {
+	return fmt.Sprintf("%s %s %s", operandString(op.a, op.Precedence(), false), op.Token, operandString(op.b, op.Precedence(), true))
+}
+
+// operandString returns the string representation of e, wrapped in parentheses if it is an operator
+// that has a lower precedence than the operator it is an operand of.
+// Since operators are evaluated from left to right, the right-hand operand is also wrapped
+// if it has the same precedence.
+func operandString(e Expr, precedence int, rightHand bool) string {
+	op, ok := e.(interface{ Precedence() int })
+	if ok && (op.Precedence() < precedence || (rightHand && op.Precedence() == precedence)) {
+		return "(" + exprString(e) + ")"
+	}
+
+	return exprString(e)
+}
+
 // A CmpOp is a comparison operator.
 type CmpOp struct {
 	simpleOperator
@@ -244,30 +313,17 @@ func Lte(a, b Expr) CmpOp {
 
 // Eval compares a and b together using the operator specified when constructing the CmpOp
 // and returns the result of the comparison.
+// If one of the operands is unknown (NULL or a field that doesn't exist), it returns NULL.
+// b is not evaluated if a is unknown.
 func (op CmpOp) Eval(ctx EvalStack) (document.Value, error) {
-	v1, err := op.a.Eval(ctx)
-	if err != nil {
-		if err == document.ErrFieldNotFound {
-			if op.Token == scanner.NEQ {
-				return trueLitteral, nil
-			}
-			return falseLitteral, nil
-		}
-
-		return falseLitteral, err
+	v1, err := evalLogicOperand(op.a, ctx)
+	if err != nil || v1.Type == document.NullValue {
+		return nilLitteral, err
 	}
 
-	v2, err := op.b.Eval(ctx)
-	if err != nil {
-		if err == document.ErrFieldNotFound {
-			if op.Token == scanner.NEQ {
-				return trueLitteral, nil
-			}
-
-			return falseLitteral, nil
-		}
-
-		return falseLitteral, err
+	v2, err := evalLogicOperand(op.b, ctx)
+	if err != nil || v2.Type == document.NullValue {
+		return nilLitteral, err
 	}
 
 	ok, err := op.compare(v1, v2)
@@ -297,6 +353,148 @@ func (op CmpOp) compare(l, r document.Value) (bool, error) {
 	}
 }
 
+// A LiteralRegex is a compiled regular expression.
+type LiteralRegex struct {
+	*regexp.Regexp
+}
+
+// Eval returns the source of the regular expression as a string. It implements the Expr interface.
+func (r LiteralRegex) Eval(EvalStack) (document.Value, error) {
+	return document.NewStringValue(r.Regexp.String()), nil
+}
+
+// String returns the regular expression between slashes. It implements the fmt.Stringer interface.
+func (r LiteralRegex) String() string {
+	return "/" + strings.ReplaceAll(r.Regexp.String(), "/", `\/`) + "/"
+}
+
+// A RegexOp is a regular expression matching operator.
+type RegexOp struct {
+	simpleOperator
+}
+
+// EqRegex creates an expression that returns true if a matches the regular expression re.
+func EqRegex(a Expr, re *regexp.Regexp) *RegexOp {
+	return &RegexOp{simpleOperator{a, LiteralRegex{re}, scanner.EQREGEX}}
+}
+
+// NeqRegex creates an expression that returns true if a doesn't match the regular expression re.
+func NeqRegex(a Expr, re *regexp.Regexp) *RegexOp {
+	return &RegexOp{simpleOperator{a, LiteralRegex{re}, scanner.NEQREGEX}}
+}
+
+// Eval matches a against the regular expression, which must be the right-hand operand.
+// Only string and bytes values can match, any other value never matches.
+// If a is unknown (NULL or a field that doesn't exist), it returns NULL.
+func (op *RegexOp) Eval(ctx EvalStack) (document.Value, error) {
+	re, ok := op.b.(LiteralRegex)
+	if !ok {
+		return falseLitteral, fmt.Errorf("operator %s expects a regular expression", op.Token)
+	}
+
+	v, err := evalLogicOperand(op.a, ctx)
+	if err != nil || v.Type == document.NullValue {
+		return nilLitteral, err
+	}
+
+	var match bool
+	if v.Type == document.StringValue || v.Type == document.BytesValue {
+		match = re.Match(v.V.([]byte))
+	}
+
+	if match == (op.Token == scanner.EQREGEX) {
+		return trueLitteral, nil
+	}
+
+	return falseLitteral, nil
+}
+
+// InOp is the IN and NOT IN operator.
+type InOp struct {
+	simpleOperator
+}
+
+// In creates an expression that returns true if a is equal to one of the values of the list b.
+func In(a, b Expr) *InOp {
+	return &InOp{simpleOperator{a, b, scanner.IN}}
+}
+
+// NotIn creates an expression that returns true if a is equal to none of the values of the list b.
+func NotIn(a, b Expr) *InOp {
+	return &InOp{simpleOperator{a, b, scanner.NIN}}
+}
+
+// Eval evaluates a and b and looks for a in the list returned by b.
+// It follows the three-valued logic, like a series of comparisons with the = operator:
+// if a is unknown (NULL or a field that doesn't exist), or if a is not found
+// and the list contains NULL, it returns NULL.
+// It returns an error if b doesn't evaluate to a list.
+func (op *InOp) Eval(ctx EvalStack) (document.Value, error) {
+	a, err := evalLogicOperand(op.a, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	b, err := evalInOperand(op.b, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	if b.Type != document.ArrayValue {
+		return falseLitteral, fmt.Errorf("operator %s expects a list, got %s", op.Token, b.Type)
+	}
+
+	if a.Type == document.NullValue {
+		return nilLitteral, nil
+	}
+
+	found, hasNull, err := arrayContains(b, a)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	if !found && hasNull {
+		return nilLitteral, nil
+	}
+
+	if found == (op.Token == scanner.IN) {
+		return trueLitteral, nil
+	}
+
+	return falseLitteral, nil
+}
+
+// arrayContains returns true if one of the values of the array is equal to v.
+// It also reports whether the values of the array that were compared to v contain NULL.
+func arrayContains(array, v document.Value) (found bool, hasNull bool, err error) {
+	a, err := array.ConvertToArray()
+	if err != nil {
+		return false, false, err
+	}
+
+	err = a.Iterate(func(i int, item document.Value) error {
+		if item.Type == document.NullValue {
+			hasNull = true
+			return nil
+		}
+
+		ok, err := item.IsEqual(v)
+		if err != nil {
+			return err
+		}
+		if ok {
+			found = true
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return false, false, err
+	}
+
+	return found, hasNull, nil
+}
+
 // AndOp is the And operator.
 type AndOp struct {
 	simpleOperator
@@ -309,17 +507,24 @@ func And(a, b Expr) *AndOp {
 
 // Eval implements the Expr interface. It evaluates a and b and returns true if both evalutate
 // to true.
+// It follows the three-valued logic: if one of the operands is false, it returns false,
+// otherwise, if one of the operands is unknown (NULL or a field that doesn't exist), it returns NULL.
+// b is not evaluated if a is false.
 func (op *AndOp) Eval(ctx EvalStack) (document.Value, error) {
-	s, err := op.a.Eval(ctx)
-	if err != nil || !s.IsTruthy() {
+	a, err := evalLogicOperand(op.a, ctx)
+	if err != nil || isFalse(a) {
 		return falseLitteral, err
 	}
 
-	s, err = op.b.Eval(ctx)
-	if err != nil || !s.IsTruthy() {
+	b, err := evalLogicOperand(op.b, ctx)
+	if err != nil || isFalse(b) {
 		return falseLitteral, err
 	}
 
+	if a.Type == document.NullValue || b.Type == document.NullValue {
+		return nilLitteral, nil
+	}
+
 	return trueLitteral, nil
 }
 
@@ -335,26 +540,264 @@ func Or(a, b Expr) Expr {
 
 // Eval implements the Expr interface. It evaluates a and b and returns true if a or b evalutate
 // to true.
+// It follows the three-valued logic: if one of the operands is true, it returns true,
+// otherwise, if one of the operands is unknown (NULL or a field that doesn't exist), it returns NULL.
+// b is not evaluated if a is true.
 func (op *OrOp) Eval(ctx EvalStack) (document.Value, error) {
-	s, err := op.a.Eval(ctx)
+	a, err := evalLogicOperand(op.a, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+	if isTrue(a) {
+		return trueLitteral, nil
+	}
+
+	b, err := evalLogicOperand(op.b, ctx)
 	if err != nil {
 		return falseLitteral, err
 	}
-	if s.IsTruthy() {
+	if isTrue(b) {
 		return trueLitteral, nil
 	}
 
-	s, err = op.b.Eval(ctx)
+	if a.Type == document.NullValue || b.Type == document.NullValue {
+		return nilLitteral, nil
+	}
+
+	return falseLitteral, nil
+}
+
+// NotOp is the NOT unary operator.
+type NotOp struct {
+	simpleOperator
+}
+
+// Not creates an expression that returns true if e is falsy and false if e is truthy.
+func Not(e Expr) *NotOp {
+	return &NotOp{simpleOperator{b: e, Token: scanner.NOT}}
+}
+
+// Eval implements the Expr interface. It evaluates the operand and negates it.
+// If the operand is unknown (NULL or a field that doesn't exist), it returns NULL.
+func (op *NotOp) Eval(ctx EvalStack) (document.Value, error) {
+	v, err := evalLogicOperand(op.b, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	if v.Type == document.NullValue {
+		return nilLitteral, nil
+	}
+
+	if v.IsTruthy() {
+		return falseLitteral, nil
+	}
+
+	return trueLitteral, nil
+}
+
+// String returns the operand prefixed with NOT. It implements the fmt.Stringer interface.
+func (op *NotOp) String() string {
+	return "NOT " + operandString(op.b, op.Precedence(), false)
+}
+
+// evalLogicOperand evaluates the operand of a logical or comparison operator.
+// Fields that don't exist evaluate to NULL.
+func evalLogicOperand(e Expr, ctx EvalStack) (document.Value, error) {
+	v, err := e.Eval(ctx)
+	if err == document.ErrFieldNotFound {
+		return nilLitteral, nil
+	}
+
+	return v, err
+}
+
+// isTrue returns true if v is neither NULL nor falsy.
+func isTrue(v document.Value) bool {
+	return v.Type != document.NullValue && v.IsTruthy()
+}
+
+// isFalse returns true if v is neither NULL nor truthy.
+func isFalse(v document.Value) bool {
+	return v.Type != document.NullValue && !v.IsTruthy()
+}
+
+// IsOp is the IS and IS NOT operator.
+type IsOp struct {
+	simpleOperator
+}
+
+// Is creates an expression that returns true if a is equal to b.
+// Contrary to the = operator, it considers that a field that doesn't exist is NULL.
+func Is(a, b Expr) *IsOp {
+	return &IsOp{simpleOperator{a, b, scanner.IS}}
+}
+
+// IsNot creates an expression that returns true if a is not equal to b.
+// Contrary to the != operator, it considers that a field that doesn't exist is NULL.
+func IsNot(a, b Expr) *IsOp {
+	return &IsOp{simpleOperator{a, b, scanner.ISN}}
+}
+
+// Eval implements the Expr interface. It never returns NULL: a NULL value or a field that doesn't exist
+// is only equal to NULL.
+func (op *IsOp) Eval(ctx EvalStack) (document.Value, error) {
+	a, err := evalLogicOperand(op.a, ctx)
 	if err != nil {
 		return falseLitteral, err
 	}
-	if s.IsTruthy() {
+
+	b, err := evalLogicOperand(op.b, ctx)
+	if err != nil {
+		return falseLitteral, err
+	}
+
+	var ok bool
+	if a.Type == document.NullValue || b.Type == document.NullValue {
+		ok = a.Type == b.Type
+	} else {
+		ok, err = a.IsEqual(b)
+		if err != nil {
+			return falseLitteral, err
+		}
+	}
+
+	if ok == (op.Token == scanner.IS) {
 		return trueLitteral, nil
 	}
 
 	return falseLitteral, nil
 }
 
+// An ArithmeticOp is an arithmetic or bitwise operator.
+type ArithmeticOp struct {
+	simpleOperator
+}
+
+// Add creates an expression that evaluates to the result of a + b.
+func Add(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.ADD}}
+}
+
+// Sub creates an expression that evaluates to the result of a - b.
+func Sub(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.SUB}}
+}
+
+// Mul creates an expression that evaluates to the result of a * b.
+func Mul(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.MUL}}
+}
+
+// Div creates an expression that evaluates to the result of a / b.
+func Div(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.DIV}}
+}
+
+// Mod creates an expression that evaluates to the result of a % b.
+func Mod(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.MOD}}
+}
+
+// BitwiseAnd creates an expression that evaluates to the result of a & b.
+func BitwiseAnd(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.BITWISEAND}}
+}
+
+// BitwiseOr creates an expression that evaluates to the result of a | b.
+func BitwiseOr(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.BITWISEOR}}
+}
+
+// BitwiseXor creates an expression that evaluates to the result of a ^ b.
+func BitwiseXor(a, b Expr) *ArithmeticOp {
+	return &ArithmeticOp{simpleOperator{a, b, scanner.BITWISEXOR}}
+}
+
+// Eval evaluates a and b and calculates the result using the operator specified when constructing the ArithmeticOp.
+// If one of the operands is a field that doesn't exist, it returns document.ErrFieldNotFound.
+func (op *ArithmeticOp) Eval(ctx EvalStack) (document.Value, error) {
+	va, err := op.a.Eval(ctx)
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	vb, err := op.b.Eval(ctx)
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	var v document.Value
+
+	switch op.Token {
+	case scanner.ADD:
+		v, err = va.Add(vb)
+	case scanner.SUB:
+		v, err = va.Sub(vb)
+	case scanner.MUL:
+		v, err = va.Mul(vb)
+	case scanner.DIV:
+		v, err = va.Div(vb)
+	case scanner.MOD:
+		v, err = va.Mod(vb)
+	case scanner.BITWISEAND:
+		v, err = va.BitwiseAnd(vb)
+	case scanner.BITWISEOR:
+		v, err = va.BitwiseOr(vb)
+	case scanner.BITWISEXOR:
+		v, err = va.BitwiseXor(vb)
+	default:
+		panic(fmt.Sprintf("unknown token %v", op.Token))
+	}
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	return v, nil
+}
+
+// CastFunc is the CAST function and the :: operator. It converts the result
+// of an expression to a given type.
+type CastFunc struct {
+	Expr   Expr
+	CastAs document.ValueType
+}
+
+// Eval evaluates the expression and converts the result to the CastAs type.
+// If the expression is a field that doesn't exist, it returns document.ErrFieldNotFound.
+// It returns an error if the value can't be converted.
+func (c CastFunc) Eval(ctx EvalStack) (document.Value, error) {
+	v, err := c.Expr.Eval(ctx)
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	return v.CastAs(c.CastAs)
+}
+
+// Name returns the definition of the function, e.g. CAST(a AS INT64).
+// It implements the ResultField interface.
+func (c CastFunc) Name() string {
+	return c.String()
+}
+
+// String returns the definition of the function. It implements the fmt.Stringer interface.
+func (c CastFunc) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", c.Expr, strings.ToUpper(c.CastAs.String()))
+}
+
+// Iterate evaluates the function and calls fn with the result.
+// If the expression is a field that doesn't exist, the result is NULL.
+// It implements the ResultField interface.
+func (c CastFunc) Iterate(stack EvalStack, fn func(field string, value document.Value) error) error {
+	v, err := c.Eval(stack)
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+
+	return fn(c.Name(), v)
+}
+
 // KVPair associates an identifier with an expression.
 type KVPair struct {
 	K string
@@ -379,3 +822,13 @@ func (kvp KVPairs) Eval(ctx EvalStack) (document.Value, error) {
 
 	return document.NewDocumentValue(&fb), nil
 }
+
+// String returns the pairs between curly brackets. It implements the fmt.Stringer interface.
+func (kvp KVPairs) String() string {
+	pairs := make([]string, len(kvp))
+	for i, kv := range kvp {
+		pairs[i] = kv.K + ": " + exprString(kv.V)
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -35,6 +35,8 @@ func TestInsertStmt(t *testing.T) {
 		{"Documents / List ", "INSERT INTO test VALUES {a: (1, 2, 3)}", false, `{"key()":1,"a":[1,2,3]}`, nil},
 		{"Documents / strings", `INSERT INTO test VALUES {'a': 'a', b: 2.3}`, false, `{"key()":1,"a":"a","b":2.3}`, nil},
 		{"Documents / double quotes", `INSERT INTO test VALUES {"a": "b"}`, false, `{"key()":1,"a":"b"}`, nil},
+		{"Values / Casts", `INSERT INTO test (a, b) VALUES ('10'::INT64, CAST(1 AS TEXT))`, false, `{"key()":1,"a":10,"b":"1"}`, nil},
+		{"Values / Invalid cast", `INSERT INTO test (a) VALUES ('foo'::INT64)`, true, ``, nil},
 	}
 
 	for _, test := range tests {
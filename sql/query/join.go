@@ -0,0 +1,433 @@
+package query
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/asdine/genji/database"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/index"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// JoinClause joins the documents of a table to the documents selected by the FROM clause
+// and the previous joins.
+type JoinClause struct {
+	TableName string
+	Alias     string
+	// Left is true for LEFT JOIN: documents that don't match any document of the table
+	// are returned anyway, with the table set to NULL.
+	Left bool
+	On   Expr
+}
+
+// Name returns the alias of the table, or its name if it doesn't have one.
+func (j JoinClause) Name() string {
+	if j.Alias != "" {
+		return j.Alias
+	}
+
+	return j.TableName
+}
+
+// joinStream returns the documents of the table joined with the tables of the JOIN clauses.
+// Each document contains one field per table, named after the alias or the name of the table,
+// whose value is the document of that table, or NULL for a LEFT JOIN without match.
+func (qo *queryOptimizer) joinStream() (document.Stream, error) {
+	names := qo.tableNames()
+
+	st := document.NewStream(qo.t).Map(func(d document.Document) (document.Document, error) {
+		return joinedDocument{
+			Document: document.NewFieldBuffer().Add(names[0], document.NewDocumentValue(d)),
+			tables:   names[:1],
+		}, nil
+	})
+
+	for i, j := range qo.joins {
+		joined := names[:i+1]
+		for _, n := range joined {
+			if n == j.Name() {
+				return st, fmt.Errorf("table name %q specified more than once", n)
+			}
+		}
+
+		it, err := qo.newJoinIterator(j, joined)
+		if err != nil {
+			return st, err
+		}
+		it.it = st
+
+		st = document.NewStream(it)
+	}
+
+	return st, nil
+}
+
+// tableNames returns the alias or the name of the table followed by the names of the joined tables.
+func (qo *queryOptimizer) tableNames() []string {
+	name := qo.tableName
+	if qo.tableAlias != "" {
+		name = qo.tableAlias
+	}
+
+	names := []string{name}
+	for _, j := range qo.joins {
+		names = append(names, j.Name())
+	}
+
+	return names
+}
+
+// newJoinIterator returns the iterator joining the table of j to the documents
+// of the tables already joined, without its input iterator.
+// It looks the documents of the table up by primary key or index if the ON clause allows it.
+func (qo *queryOptimizer) newJoinIterator(j JoinClause, joined []string) (joinIterator, error) {
+	jqo, err := newQueryOptimizer(qo.tx, j.TableName)
+	if err != nil {
+		return joinIterator{}, err
+	}
+
+	it := joinIterator{
+		tx:     qo.tx,
+		tb:     jqo.t,
+		cfg:    jqo.cfg,
+		args:   qo.args,
+		name:   j.Name(),
+		tables: append(joined[:len(joined):len(joined)], j.Name()),
+		on:     j.On,
+		left:   j.Left,
+	}
+
+	it.key, it.keyExpr = joinKey(j.On, it.name, joined)
+	if it.key != nil {
+		if f := jqo.newQueryPlanField(it.key, scanner.EQ, it.keyExpr); f != nil {
+			it.isPrimaryKey = f.isPrimaryKey
+			if !f.isPrimaryKey {
+				it.index = jqo.indexes[it.key.Name()]
+			}
+		}
+	}
+
+	return it, nil
+}
+
+// joinKey looks for an equality, in e or in the operands of its AND operators, between a field
+// of the table called name and an expression that only depends on the tables already joined.
+// It returns the path of the field within the table and the expression.
+func joinKey(e Expr, name string, joined []string) (FieldSelector, Expr) {
+	switch t := e.(type) {
+	case CmpOp:
+		if t.Token != scanner.EQ {
+			return nil, nil
+		}
+
+		sides := [][2]Expr{{t.LeftHand(), t.RightHand()}, {t.RightHand(), t.LeftHand()}}
+		for _, s := range sides {
+			fs, ok := s[0].(FieldSelector)
+			if ok && len(fs) > 1 && fs[0] == name && dependsOnTables(s[1], joined) {
+				return fs[1:], s[1]
+			}
+		}
+	case *AndOp:
+		fs, e := joinKey(t.LeftHand(), name, joined)
+		if fs != nil {
+			return fs, e
+		}
+
+		return joinKey(t.RightHand(), name, joined)
+	}
+
+	return nil, nil
+}
+
+// dependsOnTables returns true if all the fields referenced by e
+// belong to one of the given tables.
+func dependsOnTables(e Expr, tables []string) bool {
+	switch t := e.(type) {
+	case LiteralValue, NamedParam, PositionalParam:
+		return true
+	case FieldSelector:
+		for _, name := range tables {
+			if t[0] == name {
+				return true
+			}
+		}
+	case *NotOp:
+		return dependsOnTables(t.RightHand(), tables)
+	case operands:
+		return dependsOnTables(t.LeftHand(), tables) && dependsOnTables(t.RightHand(), tables)
+	case LiteralExprList:
+		for _, e := range t {
+			if !dependsOnTables(e, tables) {
+				return false
+			}
+		}
+		return true
+	case KVPairs:
+		for _, kv := range t {
+			if !dependsOnTables(kv.V, tables) {
+				return false
+			}
+		}
+		return true
+	case CastFunc:
+		return dependsOnTables(t.Expr, tables)
+	}
+
+	return false
+}
+
+// joinIterator joins every document of it with the documents of the table tb
+// that satisfy the ON expression.
+// If the ON expression compares a field of the table with an expression of the documents of it,
+// the matching documents are looked up in the index of that field or in the primary key for each document of it.
+// If the field isn't indexed, the documents of the table are first loaded in a hash table grouping them
+// by the value of the field. Without such a comparison, the table is read entirely for each document of it.
+type joinIterator struct {
+	it   document.Iterator
+	tx   *database.Transaction
+	tb   *database.Table
+	cfg  *database.TableConfig
+	args []driver.NamedValue
+	name string
+	// tables contains the names of the tables of the joined documents, including this one.
+	tables []string
+	on     Expr
+	left   bool
+
+	// key is the path of the joined field within the table,
+	// and keyExpr the expression it must be equal to.
+	key          FieldSelector
+	keyExpr      Expr
+	index        index.Index
+	isPrimaryKey bool
+}
+
+func (it joinIterator) Iterate(fn func(d document.Document) error) error {
+	var lookup func(stack EvalStack, fn func(d document.Document) error) error
+
+	switch {
+	case it.key == nil:
+		lookup = func(stack EvalStack, fn func(d document.Document) error) error {
+			return it.tb.Iterate(fn)
+		}
+	case it.isPrimaryKey || it.index != nil:
+		lookup = it.indexLookup
+	default:
+		var err error
+		lookup, err = it.hashLookup()
+		if err != nil {
+			return err
+		}
+	}
+
+	stack := EvalStack{
+		Tx:     it.tx,
+		Params: it.args,
+	}
+	match := whereClause(it.on, stack)
+
+	return it.it.Iterate(func(d document.Document) error {
+		var found bool
+
+		stack.Document = d
+		err := lookup(stack, func(r document.Document) error {
+			jd, err := joinDocument(d, it.tables, document.NewDocumentValue(r))
+			if err != nil {
+				return err
+			}
+
+			ok, err := match(jd)
+			if err != nil || !ok {
+				return err
+			}
+
+			found = true
+			return fn(jd)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !found && it.left {
+			jd, err := joinDocument(d, it.tables, nilLitteral)
+			if err != nil {
+				return err
+			}
+
+			return fn(jd)
+		}
+
+		return nil
+	})
+}
+
+// evalKey evaluates keyExpr on the document of the stack. It returns false
+// if the result is NULL, since NULL is not equal to any value.
+func (it joinIterator) evalKey(stack EvalStack) (document.Value, bool, error) {
+	v, err := it.keyExpr.Eval(stack)
+	if err == document.ErrFieldNotFound {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+
+	return v, v.Type != document.NullValue, nil
+}
+
+// indexLookup calls fn for each document of the table whose indexed key is equal to keyExpr.
+func (it joinIterator) indexLookup(stack EvalStack, fn func(d document.Document) error) error {
+	v, ok, err := it.evalKey(stack)
+	if err != nil || !ok {
+		return err
+	}
+
+	if it.isPrimaryKey {
+		return pkIterator{
+			tx:   it.tx,
+			tb:   it.tb,
+			cfg:  it.cfg,
+			args: it.args,
+			op:   scanner.EQ,
+			e:    LiteralValue(v),
+		}.Iterate(fn)
+	}
+
+	return indexIterator{
+		tx:    it.tx,
+		tb:    it.tb,
+		args:  it.args,
+		index: it.index,
+		op:    scanner.EQ,
+		e:     LiteralValue(v),
+	}.Iterate(fn)
+}
+
+// hashLookup reads the table and groups its documents by the value of the key.
+// It returns a function that calls fn for each document whose key is equal to keyExpr.
+func (it joinIterator) hashLookup() (func(stack EvalStack, fn func(d document.Document) error) error, error) {
+	table := make(map[string][][]byte)
+	var buf bytes.Buffer
+
+	err := it.tb.Iterate(func(d document.Document) error {
+		v, err := it.key.Eval(EvalStack{Document: d})
+		if err == document.ErrFieldNotFound || v.Type == document.NullValue {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		buf.Reset()
+		err = writeValueKey(&buf, v)
+		if err != nil {
+			return err
+		}
+
+		// documents read from the table are only valid during the iteration
+		data, err := encoding.EncodeDocument(d)
+		if err != nil {
+			return err
+		}
+
+		table[buf.String()] = append(table[buf.String()], data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(stack EvalStack, fn func(d document.Document) error) error {
+		v, ok, err := it.evalKey(stack)
+		if err != nil || !ok {
+			return err
+		}
+
+		buf.Reset()
+		err = writeValueKey(&buf, v)
+		if err != nil {
+			return err
+		}
+
+		for _, data := range table[buf.String()] {
+			err = fn(encoding.EncodedDocument(data))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, nil
+}
+
+// joinDocument returns a copy of the joined document d with the field of the last of the tables set to v.
+func joinDocument(d document.Document, tables []string, v document.Value) (document.Document, error) {
+	fb := document.NewFieldBuffer()
+	err := fb.ScanDocument(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return joinedDocument{
+		Document: fb.Add(tables[len(tables)-1], v),
+		tables:   tables,
+	}, nil
+}
+
+// joinedDocument is a document containing one field per table, named after the alias or the name of the table.
+// A field that isn't named after one of the tables is looked up in the documents of all the tables:
+// it is an error if more than one of them contains it.
+type joinedDocument struct {
+	document.Document
+
+	tables []string
+}
+
+// GetByField returns the document of the table called field, or the value of the field
+// in the only table whose document contains it.
+func (d joinedDocument) GetByField(field string) (document.Value, error) {
+	if containsString(d.tables, field) {
+		return d.Document.GetByField(field)
+	}
+
+	var v document.Value
+	var found string
+	for _, name := range d.tables {
+		tv, err := d.Document.GetByField(name)
+		if err != nil {
+			return v, err
+		}
+
+		// the table is NULL for a LEFT JOIN without match
+		if tv.Type != document.DocumentValue {
+			continue
+		}
+
+		td, err := tv.ConvertToDocument()
+		if err != nil {
+			return v, err
+		}
+
+		fv, err := td.GetByField(field)
+		if err == document.ErrFieldNotFound {
+			continue
+		}
+		if err != nil {
+			return v, err
+		}
+
+		if found != "" {
+			return v, fmt.Errorf("field %q is ambiguous: it exists in tables %q and %q", field, found, name)
+		}
+		v, found = fv, name
+	}
+
+	if found == "" {
+		return v, document.ErrFieldNotFound
+	}
+
+	return v, nil
+}
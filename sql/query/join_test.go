@@ -0,0 +1,96 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectStmtJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+		params   []interface{}
+	}{
+		{"Inner join", "SELECT users.name, orders.amount FROM users JOIN orders ON orders.user_id = users.id", false, `[{"users.name":"foo","orders.amount":10},{"users.name":"foo","orders.amount":20},{"users.name":"bar","orders.amount":30}]`, nil},
+		{"Inner join keyword", "SELECT u.name, o.amount FROM users u INNER JOIN orders o ON u.id = o.user_id", false, `[{"u.name":"foo","o.amount":10},{"u.name":"foo","o.amount":20},{"u.name":"bar","o.amount":30}]`, nil},
+		{"Left join", "SELECT u.name, o.amount FROM users AS u LEFT JOIN orders AS o ON u.id = o.user_id", false, `[{"u.name":"foo","o.amount":10},{"u.name":"foo","o.amount":20},{"u.name":"bar","o.amount":30},{"u.name":"baz","o.amount":null}]`, nil},
+		{"Left outer join", "SELECT u.name, o FROM users u LEFT OUTER JOIN orders o ON u.id = o.user_id WHERE u.id = 3", false, `[{"u.name":"baz","o":null}]`, nil},
+		{"Join on primary key", "SELECT o.amount, u.name FROM orders o JOIN users u ON u.id = o.user_id", false, `[{"o.amount":10,"u.name":"foo"},{"o.amount":20,"u.name":"foo"},{"o.amount":30,"u.name":"bar"}]`, nil},
+		{"Join on expression", "SELECT o.amount FROM users u JOIN orders o ON o.user_id = u.id * 2", false, `[{"o.amount":30},{"o.amount":40}]`, nil},
+		{"Join with several conditions", "SELECT o.amount FROM users u JOIN orders o ON u.id = o.user_id AND o.amount > 10", false, `[{"o.amount":20},{"o.amount":30}]`, nil},
+		{"Join without equality", "SELECT u.name, o.amount FROM users u JOIN orders o ON o.amount > u.id * 15", false, `[{"u.name":"foo","o.amount":20},{"u.name":"foo","o.amount":30},{"u.name":"foo","o.amount":40},{"u.name":"bar","o.amount":40}]`, nil},
+		{"Join with numbers of different types", "SELECT u.name FROM users u JOIN orders o ON u.id = o.user_id::FLOAT64 WHERE o.amount = 30", false, `[{"u.name":"bar"}]`, nil},
+		{"Join with wildcard", "SELECT * FROM users u JOIN orders o ON u.id = o.user_id WHERE o.amount = 30", false, `[{"u":{"id":2,"name":"bar","country":"ES"},"o":{"user_id":2,"amount":30}}]`, nil},
+		{"Join with where", "SELECT u.name FROM users u LEFT JOIN orders o ON u.id = o.user_id WHERE o IS NULL", false, `[{"u.name":"baz"}]`, nil},
+		{"Join with order by", "SELECT u.name, o.amount FROM users u JOIN orders o ON u.id = o.user_id ORDER BY o.amount DESC LIMIT 2", false, `[{"u.name":"bar","o.amount":30},{"u.name":"foo","o.amount":20}]`, nil},
+		{"Join with group by", "SELECT u.name, COUNT(o.amount), SUM(o.amount) FROM users u LEFT JOIN orders o ON u.id = o.user_id GROUP BY u.name", false, `[{"u.name":"foo","COUNT(o.amount)":2,"SUM(o.amount)":30},{"u.name":"bar","COUNT(o.amount)":1,"SUM(o.amount)":30},{"u.name":"baz","COUNT(o.amount)":0,"SUM(o.amount)":null}]`, nil},
+		{"Join with params", "SELECT o.amount FROM users u JOIN orders o ON u.id = o.user_id AND o.amount > ?", false, `[{"o.amount":30}]`, []interface{}{20}},
+		{"Multiple joins", "SELECT u.name, o.amount, c.name FROM orders o JOIN users u ON u.id = o.user_id LEFT JOIN countries c ON c.code = u.country", false, `[{"u.name":"foo","o.amount":10,"c.name":"France"},{"u.name":"foo","o.amount":20,"c.name":"France"},{"u.name":"bar","o.amount":30,"c.name":null}]`, nil},
+		{"Unqualified fields", "SELECT name, amount FROM users u JOIN orders o ON u.id = o.user_id", false, `[{"name":"foo","amount":10},{"name":"foo","amount":20},{"name":"bar","amount":30}]`, nil},
+		{"Unqualified fields in clauses", "SELECT name FROM users u JOIN orders o ON id = user_id WHERE amount > 10 ORDER BY amount DESC", false, `[{"name":"bar"},{"name":"foo"}]`, nil},
+		{"Ambiguous field", "SELECT name FROM users u JOIN countries c ON c.code = u.country", true, ``, nil},
+		{"Table name instead of alias", "SELECT users.name FROM users u JOIN orders o ON u.id = o.user_id", true, ``, nil},
+		{"Same alias twice", "SELECT * FROM users u JOIN orders u ON u.id = u.user_id", true, ``, nil},
+		{"Same table without alias", "SELECT * FROM users JOIN users ON users.id = users.id", true, ``, nil},
+		{"With key()", "SELECT key() FROM users u JOIN orders o ON u.id = o.user_id", true, ``, nil},
+		{"Table not found", "SELECT * FROM users u JOIN foo ON u.id = foo.id", true, ``, nil},
+	}
+
+	for _, test := range tests {
+		testFn := func(withIndexes bool) func(t *testing.T) {
+			return func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users (id INTEGER PRIMARY KEY);
+					CREATE TABLE orders;
+					CREATE TABLE countries;
+				`)
+				require.NoError(t, err)
+				if withIndexes {
+					err = db.Exec(`
+						CREATE INDEX idx_orders_user_id ON orders (user_id);
+						CREATE UNIQUE INDEX idx_countries_code ON countries (code);
+					`)
+					require.NoError(t, err)
+				}
+
+				err = db.Exec(`
+					INSERT INTO users VALUES {id: 1, name: 'foo', country: 'FR'}, {id: 2, name: 'bar', country: 'ES'}, {id: 3, name: 'baz'};
+					INSERT INTO orders VALUES {user_id: 1, amount: 10}, {user_id: 1, amount: 20}, {user_id: 2, amount: 30}, {user_id: 4, amount: 40};
+					INSERT INTO countries VALUES {code: 'FR', name: 'France'};
+				`)
+				require.NoError(t, err)
+
+				st, err := db.Query(test.query, test.params...)
+				if test.fails {
+					if err == nil {
+						var buf bytes.Buffer
+						err = document.IteratorToJSONArray(&buf, st)
+						st.Close()
+					}
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			}
+		}
+		t.Run("No Index/"+test.name, testFn(false))
+		t.Run("With Index/"+test.name, testFn(true))
+	}
+}
@@ -2,9 +2,9 @@ package query
 
 import (
 	"bytes"
-	"container/heap"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 
 	"github.com/asdine/genji/database"
 	"github.com/asdine/genji/document"
@@ -17,6 +17,7 @@ import (
 type queryPlan struct {
 	scanTable bool
 	field     *queryPlanField
+	composite *compositePlan
 	sorted    bool
 }
 
@@ -24,8 +25,94 @@ type queryPlanField struct {
 	indexedField FieldSelector
 	op           scanner.Token
 	e            Expr
+	// rng is set instead of op and e if the field is compared to a lower bound,
+	// an upper bound, or both.
+	rng          *valueRange
 	uniqueIndex  bool
 	isPrimaryKey bool
+
+	// union and intersection are set instead of the other fields if the plan
+	// selects the documents selected by any or by all of these plans.
+	union        []*queryPlanField
+	intersection []*queryPlanField
+}
+
+// valueRange describes the values between min and max.
+// The range is not bounded on the side of a nil bound.
+type valueRange struct {
+	min, max                   Expr
+	exclusiveMin, exclusiveMax bool
+}
+
+// newValueRange returns the range of the values that satisfy the comparison with e using op.
+// It returns nil if op is not a comparison that selects a range.
+func newValueRange(op scanner.Token, e Expr) *valueRange {
+	switch op {
+	case scanner.GT, scanner.GTE:
+		return &valueRange{min: e, exclusiveMin: op == scanner.GT}
+	case scanner.LT, scanner.LTE:
+		return &valueRange{max: e, exclusiveMax: op == scanner.LT}
+	}
+
+	return nil
+}
+
+// intersect returns the range bounded by the bounds of r, completed by the bounds of other
+// on the sides r isn't bounded. Since bounds are only known at execution, the documents
+// outside of the bounds of other that are not used are filtered by the WHERE clause.
+func (r *valueRange) intersect(other *valueRange) *valueRange {
+	rng := *r
+	if rng.min == nil {
+		rng.min, rng.exclusiveMin = other.min, other.exclusiveMin
+	}
+	if rng.max == nil {
+		rng.max, rng.exclusiveMax = other.max, other.exclusiveMax
+	}
+
+	return &rng
+}
+
+// eval evaluates the bounds of the range. The returned bounds are nil if the range isn't bounded.
+func (r *valueRange) eval(stack EvalStack) (min, max *document.Value, err error) {
+	if r.min != nil {
+		v, err := r.min.Eval(stack)
+		if err != nil {
+			return nil, nil, err
+		}
+		min = &v
+	}
+
+	if r.max != nil {
+		v, err := r.max.Eval(stack)
+		if err != nil {
+			return nil, nil, err
+		}
+		max = &v
+	}
+
+	return min, max, nil
+}
+
+// compareValues compares a with b using the comparison operator op.
+func compareValues(op scanner.Token, a, b document.Value) (bool, error) {
+	return CmpOp{simpleOperator{Token: op}}.compare(a, b)
+}
+
+// minOp and maxOp return the operators used to compare the values to the bounds.
+func (r *valueRange) minOp() scanner.Token {
+	if r.exclusiveMin {
+		return scanner.GT
+	}
+
+	return scanner.GTE
+}
+
+func (r *valueRange) maxOp() scanner.Token {
+	if r.exclusiveMax {
+		return scanner.LT
+	}
+
+	return scanner.LTE
 }
 
 func newQueryOptimizer(tx *database.Transaction, tableName string) (qo queryOptimizer, err error) {
@@ -55,45 +142,62 @@ func newQueryOptimizer(tx *database.Transaction, tableName string) (qo queryOpti
 
 // queryOptimizer is a really dumb query optimizer. gotta start somewhere. please don't be mad at me.
 type queryOptimizer struct {
-	tx               *database.Transaction
-	t                *database.Table
-	tableName        string
-	whereExpr        Expr
-	args             []driver.NamedValue
-	cfg              *database.TableConfig
-	indexes          map[string]database.Index
-	orderBy          FieldSelector
-	orderByDirection scanner.Token
-	limit            int
-	offset           int
+	tx          *database.Transaction
+	t           *database.Table
+	tableName   string
+	tableAlias  string
+	joins       []JoinClause
+	whereExpr   Expr
+	args        []driver.NamedValue
+	cfg         *database.TableConfig
+	indexes     map[string]database.Index
+	groupBy     []FieldSelector
+	havingExpr  Expr
+	aggregators []AggregatorBuilder
+	orderBy     []OrderByField
+	limit       int
+	offset      int
 }
 
 func (qo *queryOptimizer) optimizeQuery() (st document.Stream, err error) {
 	qp := qo.buildQueryPlan()
 
+	// iterators return documents in the order of the first sort key if the plan is sorted
+	orderByDirection := scanner.ASC
+	if len(qo.orderBy) != 0 {
+		orderByDirection = qo.orderBy[0].Direction
+	}
+
 	switch {
+	case len(qo.joins) != 0:
+		st, err = qo.joinStream()
+		if err != nil {
+			return
+		}
 	case qp.scanTable:
 		st = document.NewStream(qo.t)
-	case qp.field.isPrimaryKey:
+	case qp.composite != nil && qp.composite.primaryKey:
 		st = document.NewStream(pkIterator{
 			tx:               qo.tx,
 			tb:               qo.t,
 			cfg:              qo.cfg,
 			args:             qo.args,
-			op:               qp.field.op,
-			e:                qp.field.e,
-			orderByDirection: qo.orderByDirection,
+			eq:               qp.composite.eq,
+			rng:              qp.composite.rng,
+			orderByDirection: orderByDirection,
 		})
-	default:
-		st = document.NewStream(indexIterator{
+	case qp.composite != nil:
+		st = document.NewStream(compositeIndexIterator{
 			tx:               qo.tx,
 			tb:               qo.t,
 			args:             qo.args,
-			op:               qp.field.op,
-			e:                qp.field.e,
-			index:            qo.indexes[qp.field.indexedField.Name()],
-			orderByDirection: qo.orderByDirection,
+			index:            qp.composite.index,
+			eq:               qp.composite.eq,
+			rng:              qp.composite.rng,
+			orderByDirection: orderByDirection,
 		})
+	default:
+		st = document.NewStream(qo.newFieldIterator(qp.field, orderByDirection))
 	}
 
 	st = st.Filter(whereClause(qo.whereExpr, EvalStack{
@@ -101,8 +205,41 @@ func (qo *queryOptimizer) optimizeQuery() (st document.Stream, err error) {
 		Params: qo.args,
 	}))
 
-	if len(qo.orderBy) != 0 && !qp.sorted {
-		st, err = qo.sortIterator(st)
+	grouped := len(qo.groupBy) != 0 || len(qo.aggregators) != 0 || qo.havingExpr != nil
+	if grouped {
+		st = document.NewStream(groupIterator{
+			it: st,
+			stack: EvalStack{
+				Tx:     qo.tx,
+				Params: qo.args,
+			},
+			groupBy:     qo.groupBy,
+			aggregators: qo.aggregators,
+		})
+
+		st = st.Filter(whereClause(qo.havingExpr, EvalStack{
+			Tx:     qo.tx,
+			Params: qo.args,
+		}))
+	}
+
+	if len(qo.orderBy) != 0 {
+		switch {
+		case !qp.sorted:
+			st = qo.sortIterator(st)
+		case len(qo.orderBy) > 1:
+			// the documents are sorted by the first key, only the documents
+			// with the same value for that key need to be sorted
+			st = document.NewStream(runSortIterator{it: st, keys: newSortKeys(qo.orderBy)})
+		}
+
+		// sorted documents are returned in their encoded form, which doesn't know about the joined tables
+		if len(qo.joins) != 0 && !grouped {
+			names := qo.tableNames()
+			st = st.Map(func(d document.Document) (document.Document, error) {
+				return joinedDocument{Document: d, tables: names}, nil
+			})
+		}
 	}
 
 	return
@@ -111,88 +248,275 @@ func (qo *queryOptimizer) optimizeQuery() (st document.Stream, err error) {
 func (qo *queryOptimizer) buildQueryPlan() queryPlan {
 	var qp queryPlan
 
+	// with joins, the WHERE and ORDER BY clauses refer to the joined documents,
+	// whose fields are not indexed
+	if len(qo.joins) != 0 {
+		qp.scanTable = true
+		return qp
+	}
+
 	qp.field = qo.analyseExpr(qo.whereExpr)
-	if qp.field == nil {
-		if len(qo.orderBy) != 0 {
-			_, ok := qo.indexes[qo.orderBy.Name()]
-			if ok || qo.cfg.PrimaryKey.Path.String() == qo.orderBy.Name() {
-				qp.field = &queryPlanField{
-					indexedField: qo.orderBy,
-					isPrimaryKey: qo.cfg.PrimaryKey.Path.String() == qo.orderBy.Name(),
-				}
-				qp.sorted = true
 
-				return qp
-			}
+	if cp := qo.analyseCompositeIndexes(qp.field); cp != nil {
+		qp.field = nil
+		qp.composite = cp
+		qp.sorted = cp.sorted
+		return qp
+	}
+
+	if qp.field == nil {
+		qp.field = qo.orderByIndexField()
+		if qp.field != nil {
+			qp.sorted = true
+			return qp
 		}
 
 		qp.scanTable = true
+		return qp
+	}
+
+	// ranges are read in the order of the index, and only contain values of the type of
+	// their bounds, or NULL values if a bound is NULL: the position of NULL values doesn't matter
+	if qp.field.rng != nil && len(qo.orderBy) != 0 && qo.orderBy[0].Path.Name() == qp.field.indexedField.Name() {
+		qp.sorted = true
 	}
 
 	return qp
 }
 
+// newFieldIterator returns an iterator over the documents selected by f.
+func (qo *queryOptimizer) newFieldIterator(f *queryPlanField, orderByDirection scanner.Token) keyIterator {
+	var iterators []keyIterator
+	for _, sub := range append(f.union, f.intersection...) {
+		iterators = append(iterators, qo.newFieldIterator(sub, orderByDirection))
+	}
+
+	switch {
+	case f.union != nil:
+		return unionIterator{tb: qo.t, iterators: iterators}
+	case f.intersection != nil:
+		return intersectionIterator{tb: qo.t, iterators: iterators}
+	case f.isPrimaryKey:
+		return pkIterator{
+			tx:               qo.tx,
+			tb:               qo.t,
+			cfg:              qo.cfg,
+			args:             qo.args,
+			op:               f.op,
+			e:                f.e,
+			rng:              f.rng,
+			orderByDirection: orderByDirection,
+		}
+	}
+
+	return indexIterator{
+		tx:               qo.tx,
+		tb:               qo.t,
+		args:             qo.args,
+		op:               f.op,
+		e:                f.e,
+		rng:              f.rng,
+		index:            qo.indexes[f.indexedField.Name()],
+		orderByDirection: orderByDirection,
+	}
+}
+
+// orderByIndexField returns a queryPlanField that iterates over the index or the primary key
+// of the first ORDER BY key, if any.
+func (qo *queryOptimizer) orderByIndexField() *queryPlanField {
+	if len(qo.orderBy) == 0 {
+		return nil
+	}
+
+	leading := qo.orderBy[0]
+	_, ok := qo.indexes[leading.Path.Name()]
+	isPrimaryKey := qo.cfg.PrimaryKey.Path.String() == leading.Path.Name()
+	// indexes return NULL values first in ascending order and last in descending order,
+	// they can't be used if the first sort key requires otherwise.
+	key := newSortKeys(qo.orderBy[:1])[0]
+	if (ok || isPrimaryKey) && key.nullsFirst != key.desc {
+		return &queryPlanField{
+			indexedField: leading.Path,
+			isPrimaryKey: isPrimaryKey,
+		}
+	}
+
+	return nil
+}
+
 // analyseExpr is a recursive function that scans each node the e Expr tree.
 // If it contains a comparison operator, it checks if this operator and its operands
 // can benefit from using an index. This check is done in the cmpOpCanUseIndex function.
-// If it contains an AND operator it checks if one of the operands can use an index.
+// If it contains an AND operator it selects the operand that is expected to select the fewest documents,
+// combines the comparisons of both operands with the same field into a range, or intersects
+// the documents selected by non unique indexes.
+// If it contains an OR operator, the documents selected by both operands are merged, if they can both use an index.
 func (qo *queryOptimizer) analyseExpr(e Expr) *queryPlanField {
 	switch t := e.(type) {
 	case CmpOp:
-		ok, fs, e := cmpOpCanUseIndex(&t)
+		ok, fs, op, e := cmpOpCanUseIndex(&t)
 		if !ok || !evaluatesToScalarOrParam(e) {
 			return nil
 		}
 
-		idx, ok := qo.indexes[fs.Name()]
-		if ok {
-			return &queryPlanField{
-				indexedField: fs,
-				op:           t.Token,
-				e:            e,
-				uniqueIndex:  idx.Unique,
-			}
-		}
+		return qo.newQueryPlanField(fs, op, e)
 
-		if qo.cfg.PrimaryKey.Path.String() == fs.Name() {
-			return &queryPlanField{
-				indexedField: fs,
-				op:           t.Token,
-				e:            e,
-				uniqueIndex:  true,
-				isPrimaryKey: true,
-			}
+	case *InOp:
+		fs, ok := t.LeftHand().(FieldSelector)
+		if !ok || t.Token != scanner.IN || !evaluatesToScalarListOrParam(t.RightHand()) {
+			return nil
 		}
 
-		return nil
+		return qo.newQueryPlanField(fs, t.Token, t.RightHand())
 
 	case *AndOp:
 		nodeL := qo.analyseExpr(t.LeftHand())
-		nodeR := qo.analyseExpr(t.LeftHand())
+		nodeR := qo.analyseExpr(t.RightHand())
 
-		if nodeL == nil && nodeR == nil {
-			return nil
+		switch {
+		case nodeL == nil:
+			return nodeR
+		case nodeR == nil:
+			return nodeL
 		}
 
-		if nodeL != nil && nodeL.uniqueIndex {
-			return nodeL
+		// bounds of the same field are combined into a single range
+		if nodeL.rng != nil && nodeR.rng != nil && nodeL.indexedField.Name() == nodeR.indexedField.Name() {
+			f := *nodeL
+			f.rng = nodeL.rng.intersect(nodeR.rng)
+			return &f
 		}
 
-		if nodeR != nil && nodeR.uniqueIndex {
+		// equalities on several non unique indexes select the documents found in all of them
+		if nodeL.canIntersect() && nodeR.canIntersect() {
+			var f queryPlanField
+			for _, n := range []*queryPlanField{nodeL, nodeR} {
+				if n.intersection != nil {
+					f.intersection = append(f.intersection, n.intersection...)
+				} else {
+					f.intersection = append(f.intersection, n)
+				}
+			}
+			return &f
+		}
+
+		// the other operand is evaluated by the WHERE clause
+		if nodeR.cost() < nodeL.cost() {
 			return nodeR
 		}
 
 		return nodeL
+
+	case *OrOp:
+		nodeL := qo.analyseExpr(t.LeftHand())
+		nodeR := qo.analyseExpr(t.RightHand())
+
+		// if one of the operands can't use an index, the whole table must be read
+		if nodeL == nil || nodeR == nil {
+			return nil
+		}
+
+		var f queryPlanField
+		for _, n := range []*queryPlanField{nodeL, nodeR} {
+			if n.union != nil {
+				f.union = append(f.union, n.union...)
+			} else {
+				f.union = append(f.union, n)
+			}
+		}
+		return &f
 	}
 
 	return nil
 }
 
-func cmpOpCanUseIndex(cmp *CmpOp) (bool, FieldSelector, Expr) {
+// canIntersect returns true if f is an equality on a non unique index,
+// or an intersection of such equalities.
+func (f *queryPlanField) canIntersect() bool {
+	if f.intersection != nil {
+		return true
+	}
+
+	return f.op == scanner.EQ && !f.uniqueIndex && f.union == nil
+}
+
+// cost estimates the number of documents selected by the plan, relative to other plans.
+// Indexes don't keep statistics about their content, the estimation only depends on the kind of lookup:
+// an equality on a unique index selects at most one document, while other equalities and ranges
+// select more documents.
+func (f *queryPlanField) cost() int {
+	switch {
+	case f.union != nil:
+		var cost int
+		for _, u := range f.union {
+			cost += u.cost()
+		}
+		return cost
+	case f.intersection != nil:
+		// every index divides the number of selected documents
+		cost := f.intersection[0].cost()
+		for range f.intersection[1:] {
+			cost /= 2
+		}
+		return cost
+	case f.rng != nil && f.rng.min != nil && f.rng.max != nil:
+		return 50
+	case f.rng != nil:
+		return 100
+	}
+
+	cost := 10
+	if f.uniqueIndex {
+		cost = 1
+	}
+
+	if f.op == scanner.IN {
+		if l, ok := f.e.(LiteralExprList); ok {
+			return cost * len(l)
+		}
+
+		return cost * 10
+	}
+
+	return cost
+}
+
+// newQueryPlanField returns a queryPlanField if the field is indexed or if it's the primary key.
+// Comparisons other than EQ and IN are turned into ranges.
+func (qo *queryOptimizer) newQueryPlanField(fs FieldSelector, op scanner.Token, e Expr) *queryPlanField {
+	f := queryPlanField{
+		indexedField: fs,
+		op:           op,
+		e:            e,
+	}
+
+	if rng := newValueRange(op, e); rng != nil {
+		f.op, f.e, f.rng = 0, nil, rng
+	}
+
+	idx, ok := qo.indexes[fs.Name()]
+	if ok {
+		f.uniqueIndex = idx.Unique
+		return &f
+	}
+
+	if qo.cfg.PrimaryKey.Path.String() == fs.Name() {
+		f.uniqueIndex = true
+		f.isPrimaryKey = true
+		return &f
+	}
+
+	return nil
+}
+
+// cmpOpCanUseIndex returns the field and the expression it is compared to if cmp compares a field with
+// an expression. The returned operator is the operator of the comparison with the field on the left:
+// the operator of expr OP field is reversed.
+func cmpOpCanUseIndex(cmp *CmpOp) (bool, FieldSelector, scanner.Token, Expr) {
 	switch cmp.Token {
 	case scanner.EQ, scanner.GT, scanner.GTE, scanner.LT, scanner.LTE:
 	default:
-		return false, nil, nil
+		return false, nil, 0, nil
 	}
 
 	lf, leftIsField := cmp.LeftHand().(FieldSelector)
@@ -200,28 +524,89 @@ func cmpOpCanUseIndex(cmp *CmpOp) (bool, FieldSelector, Expr) {
 
 	// field OP expr
 	if leftIsField && !rightIsField {
-		return true, lf, cmp.RightHand()
+		return true, lf, cmp.Token, cmp.RightHand()
 	}
 
 	// expr OP field
 	if rightIsField && !leftIsField {
-		return true, rf, cmp.LeftHand()
+		op := cmp.Token
+		switch op {
+		case scanner.GT:
+			op = scanner.LT
+		case scanner.GTE:
+			op = scanner.LTE
+		case scanner.LT:
+			op = scanner.GT
+		case scanner.LTE:
+			op = scanner.GTE
+		}
+
+		return true, rf, op, cmp.LeftHand()
 	}
 
-	return false, nil, nil
+	return false, nil, 0, nil
 }
 
 func evaluatesToScalarOrParam(e Expr) bool {
-	switch e.(type) {
+	switch t := e.(type) {
 	case LiteralValue:
 		return true
 	case NamedParam, PositionalParam:
 		return true
+	case Subquery:
+		// subqueries that refer to the document can't be evaluated beforehand
+		return t.outer == nil
+	}
+
+	return false
+}
+
+func evaluatesToScalarListOrParam(e Expr) bool {
+	switch t := e.(type) {
+	case Subquery:
+		return t.outer == nil
+	case LiteralExprList:
+		for _, e := range t {
+			if !evaluatesToScalarOrParam(e) {
+				return false
+			}
+		}
+		return true
+	case NamedParam, PositionalParam:
+		return true
 	}
 
 	return false
 }
 
+// iterateInValues calls fn for each distinct value of the list v.
+func iterateInValues(v document.Value, fn func(v document.Value) error) error {
+	if v.Type != document.ArrayValue {
+		return fmt.Errorf("operator IN expects a list, got %s", v.Type)
+	}
+
+	a, err := v.ConvertToArray()
+	if err != nil {
+		return err
+	}
+
+	var seen []document.Value
+	return a.Iterate(func(i int, v document.Value) error {
+		for _, s := range seen {
+			ok, err := s.IsEqual(v)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+		}
+		seen = append(seen, v)
+
+		return fn(v)
+	})
+}
+
 type indexIterator struct {
 	tx               *database.Transaction
 	tb               *database.Table
@@ -229,136 +614,145 @@ type indexIterator struct {
 	index            index.Index
 	op               scanner.Token
 	e                Expr
+	rng              *valueRange
 	orderByDirection scanner.Token
 }
 
 var errStop = errors.New("stop")
 
-func (it indexIterator) Iterate(fn func(d document.Document) error) error {
-	if it.e == nil {
-		var err error
-
-		if it.orderByDirection == scanner.DESC {
-			err = it.index.DescendLessOrEqual(nil, func(val document.Value, key []byte) error {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
-				}
+// keyIterator iterates over documents and over their keys.
+// The keys are used to combine the documents selected by several iterators.
+type keyIterator interface {
+	document.Iterator
 
-				return fn(r)
-			})
-		} else {
-			err = it.index.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
-				}
+	iterateKeys(fn func(key []byte) error) error
+}
 
-				return fn(r)
-			})
+func (it indexIterator) Iterate(fn func(d document.Document) error) error {
+	return it.iterateKeys(func(key []byte) error {
+		r, err := it.tb.GetDocument(key)
+		if err != nil {
+			return err
 		}
 
-		return err
+		return fn(r)
+	})
+}
+
+// iterateKeys calls fn with the key of every document selected by the iterator.
+func (it indexIterator) iterateKeys(fn func(key []byte) error) error {
+	visit := func(val document.Value, key []byte) error {
+		return fn(key)
 	}
 
-	v, err := it.e.Eval(EvalStack{
+	stack := EvalStack{
 		Tx:     it.tx,
 		Params: it.args,
-	})
-	if err != nil {
-		return err
 	}
 
-	if v.Type.IsNumber() {
-		v, err = v.ConvertTo(document.Float64Value)
+	switch {
+	case it.rng != nil:
+		return it.iterateRange(stack, visit)
+	case it.e == nil && it.orderByDirection == scanner.DESC:
+		return it.index.DescendLessOrEqual(nil, visit)
+	case it.e == nil:
+		return it.index.AscendGreaterOrEqual(nil, visit)
+	}
+
+	// IN is evaluated as one EQ lookup per value of the list
+	if it.op == scanner.IN {
+		v, err := evalInOperand(it.e, stack)
 		if err != nil {
 			return err
 		}
+
+		return iterateInValues(v, func(v document.Value) error {
+			return it.iterateEq(v, fn)
+		})
 	}
 
-	switch it.op {
-	case scanner.EQ:
-		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			ok, err := v.IsEqual(val)
-			if err != nil {
-				return err
-			}
+	v, err := it.e.Eval(stack)
+	if err != nil {
+		return err
+	}
 
-			if ok {
-				r, err := it.tb.GetDocument(key)
-				if err != nil {
-					return err
-				}
+	return it.iterateEq(v, fn)
+}
 
-				return fn(r)
-			}
+// iterateRange calls fn for every indexed value within the range, in the order of the index
+// or in the reverse order if orderByDirection is DESC. The iteration starts from one bound
+// and stops as soon as the other one is reached.
+func (it indexIterator) iterateRange(stack EvalStack, fn func(val document.Value, key []byte) error) error {
+	min, max, err := it.rng.eval(stack)
+	if err != nil {
+		return err
+	}
 
-			return errStop
-		})
-	case scanner.GT:
-		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			ok, err := v.IsEqual(val)
+	desc := it.orderByDirection == scanner.DESC
+
+	visit := func(val document.Value, key []byte) error {
+		if min != nil {
+			ok, err := compareValues(it.rng.minOp(), val, *min)
 			if err != nil {
 				return err
 			}
-
-			if ok {
+			if !ok && desc {
+				return errStop
+			}
+			if !ok {
 				return nil
 			}
+		}
 
-			r, err := it.tb.GetDocument(key)
+		if max != nil {
+			ok, err := compareValues(it.rng.maxOp(), val, *max)
 			if err != nil {
 				return err
 			}
-
-			return fn(r)
-		})
-	case scanner.GTE:
-		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
-			r, err := it.tb.GetDocument(key)
-			if err != nil {
-				return err
+			if !ok && !desc {
+				return errStop
 			}
-
-			return fn(r)
-		})
-	case scanner.LT:
-		err = it.index.AscendGreaterOrEqual(index.EmptyPivot(v.Type), func(val document.Value, key []byte) error {
-			ok, err := v.IsLesserThanOrEqual(val)
-			if err != nil {
-				return err
+			if !ok {
+				return nil
 			}
+		}
 
-			if ok {
-				return errStop
-			}
+		return fn(val, key)
+	}
 
-			r, err := it.tb.GetDocument(key)
-			if err != nil {
-				return err
-			}
+	// the iteration only goes through the values of the type of the first bound
+	switch {
+	case desc && max != nil:
+		err = it.index.DescendLessOrEqual(&index.Pivot{Value: *max}, visit)
+	case desc:
+		err = it.index.DescendLessOrEqual(index.EmptyPivot(min.Type), visit)
+	case min != nil:
+		err = it.index.AscendGreaterOrEqual(&index.Pivot{Value: *min}, visit)
+	default:
+		err = it.index.AscendGreaterOrEqual(index.EmptyPivot(max.Type), visit)
+	}
 
-			return fn(r)
-		})
-	case scanner.LTE:
-		err = it.index.AscendGreaterOrEqual(index.EmptyPivot(v.Type), func(val document.Value, key []byte) error {
-			ok, err := v.IsLesserThan(val)
-			if err != nil {
-				return err
-			}
+	if err != nil && err != errStop {
+		return err
+	}
 
-			if ok {
-				return errStop
-			}
+	return nil
+}
 
-			r, err := it.tb.GetDocument(key)
-			if err != nil {
-				return err
-			}
+// iterateEq calls fn with the key of every document whose indexed value is equal to v.
+func (it indexIterator) iterateEq(v document.Value, fn func(key []byte) error) error {
+	err := it.index.AscendGreaterOrEqual(&index.Pivot{Value: v}, func(val document.Value, key []byte) error {
+		ok, err := v.IsEqual(val)
+		if err != nil {
+			return err
+		}
 
-			return fn(r)
-		})
-	}
+		if ok {
+			return fn(key)
+		}
+
+		return errStop
+	})
 
 	if err != nil && err != errStop {
 		return err
@@ -368,91 +762,143 @@ func (it indexIterator) Iterate(fn func(d document.Document) error) error {
 }
 
 type pkIterator struct {
-	tx               *database.Transaction
-	tb               *database.Table
-	cfg              *database.TableConfig
-	args             []driver.NamedValue
+	tx   *database.Transaction
+	tb   *database.Table
+	cfg  *database.TableConfig
+	args []driver.NamedValue
+	// eq contains the values of the leading fields of a composite primary key.
+	eq               []Expr
 	op               scanner.Token
 	e                Expr
+	rng              *valueRange
 	orderByDirection scanner.Token
 }
 
 func (it pkIterator) Iterate(fn func(d document.Document) error) error {
-	if it.e == nil {
-		var err error
+	// the document is reused at each call of fn, like the documents returned by database.Table
+	var d encodedDocumentWithKey
 
-		if it.orderByDirection == scanner.DESC {
-			err = it.tb.Store.DescendLessOrEqual(nil, func(k []byte, v []byte) error {
-				return fn(encoding.EncodedDocument(v))
-			})
-		} else {
-			err = it.tb.Store.AscendGreaterOrEqual(nil, func(k []byte, v []byte) error {
-				return fn(encoding.EncodedDocument(v))
-			})
-		}
+	return it.iterate(func(k, v []byte) error {
+		d.EncodedDocument = v
+		d.key = k
+		return fn(&d)
+	})
+}
 
-		return err
+// encodedDocumentWithKey is a document read from the store of a table, that implements document.Keyer.
+type encodedDocumentWithKey struct {
+	encoding.EncodedDocument
+
+	key []byte
+}
+
+func (e encodedDocumentWithKey) Key() []byte {
+	return e.key
+}
+
+// iterateKeys calls fn with the key of every document selected by the iterator.
+func (it pkIterator) iterateKeys(fn func(key []byte) error) error {
+	return it.iterate(func(k, v []byte) error {
+		return fn(k)
+	})
+}
+
+// iterate calls fn with the key and the encoded document of every document selected by the iterator.
+func (it pkIterator) iterate(visit func(k, v []byte) error) error {
+	if len(it.cfg.PrimaryKeyPaths) != 0 {
+		return it.iteratePrefix(visit)
 	}
 
-	v, err := it.e.Eval(EvalStack{
+	stack := EvalStack{
 		Tx:     it.tx,
 		Params: it.args,
-	})
-	if err != nil {
-		return err
 	}
 
-	if v.Type.IsNumber() {
-		v, err = v.ConvertTo(it.cfg.PrimaryKey.Type)
+	switch {
+	case it.rng != nil:
+		return it.iterateRange(stack, visit)
+	case it.e == nil && it.orderByDirection == scanner.DESC:
+		return it.tb.Store.DescendLessOrEqual(nil, visit)
+	case it.e == nil:
+		return it.tb.Store.AscendGreaterOrEqual(nil, visit)
+	}
+
+	// IN is evaluated as one EQ lookup per value of the list
+	if it.op == scanner.IN {
+		v, err := evalInOperand(it.e, stack)
 		if err != nil {
 			return err
 		}
+
+		return iterateInValues(v, func(v document.Value) error {
+			return it.iterateEq(v, visit)
+		})
 	}
 
-	data, err := encoding.EncodeValue(v)
+	v, err := it.e.Eval(stack)
 	if err != nil {
 		return err
 	}
 
-	switch it.op {
-	case scanner.EQ:
-		val, err := it.tb.Store.Get(data)
-		if err != nil {
-			if err == engine.ErrKeyNotFound {
-				return nil
-			}
+	return it.iterateEq(v, visit)
+}
 
+// iterateRange calls fn for every key within the range, in increasing order
+// or in decreasing order if orderByDirection is DESC. The iteration starts from one bound
+// and stops as soon as the other one is reached.
+func (it pkIterator) iterateRange(stack EvalStack, fn func(k, v []byte) error) error {
+	var min, max []byte
+
+	minV, maxV, err := it.rng.eval(stack)
+	if err != nil {
+		return err
+	}
+	// bounds that can't be converted to the type of the primary key are ignored,
+	// the WHERE clause filters the documents outside of the range
+	if minV != nil {
+		min, _, err = it.encodeKey(*minV)
+		if err != nil {
+			return err
+		}
+	}
+	if maxV != nil {
+		max, _, err = it.encodeKey(*maxV)
+		if err != nil {
 			return err
 		}
-		return fn(encoding.EncodedDocument(val))
-	case scanner.GT:
-		err = it.tb.Store.AscendGreaterOrEqual(data, func(key, val []byte) error {
-			if bytes.Equal(data, val) {
+	}
+
+	desc := it.orderByDirection == scanner.DESC
+
+	// keys are encoded values of the same type, their order is the order of the values
+	visit := func(k, v []byte) error {
+		if min != nil {
+			cmp := bytes.Compare(k, min)
+			if cmp < 0 || (cmp == 0 && it.rng.exclusiveMin) {
+				if desc {
+					return errStop
+				}
 				return nil
 			}
+		}
 
-			return fn(encoding.EncodedDocument(val))
-		})
-	case scanner.GTE:
-		err = it.tb.Store.AscendGreaterOrEqual(data, func(key, val []byte) error {
-			return fn(encoding.EncodedDocument(val))
-		})
-	case scanner.LT:
-		err = it.tb.Store.AscendGreaterOrEqual(nil, func(key, val []byte) error {
-			if bytes.Compare(data, val) <= 0 {
+		if max != nil {
+			cmp := bytes.Compare(k, max)
+			if cmp > 0 || (cmp == 0 && it.rng.exclusiveMax) {
+				if desc {
+					return nil
+				}
 				return errStop
 			}
+		}
 
-			return fn(encoding.EncodedDocument(val))
-		})
-	case scanner.LTE:
-		err = it.tb.Store.AscendGreaterOrEqual(nil, func(key, val []byte) error {
-			if bytes.Compare(data, val) < 0 {
-				return errStop
-			}
+		return fn(k, v)
+	}
 
-			return fn(encoding.EncodedDocument(val))
-		})
+	if desc {
+		err = it.tb.Store.DescendLessOrEqual(max, visit)
+	} else {
+		err = it.tb.Store.AscendGreaterOrEqual(min, visit)
 	}
 
 	if err != nil && err != errStop {
@@ -462,115 +908,163 @@ func (it pkIterator) Iterate(fn func(d document.Document) error) error {
 	return nil
 }
 
-// sortIterator operates a partial sort on the iterator using a heap.
-// This ensures a O(n+klog n) time complexity
-// with k being the limit of the query, or the sum of the limit + offset, when both offset and limit are used.
-// if there are no limit or offsets, k = n, the number of elements in the table.
-// If the sorting is in ascending order, a min-heap will be used
-// otherwise a max-heap will be used instead.
-// Once the heap is filled entirely with the content of the table a stream is returned.
-// During iteration, the stream will pop the k-smallest or k-largest elements, depending on
-// the chosen sorting order (ASC or DESC).
-// This function is not memory efficient as it's loading the entire table in memory before
-// returning the k-smallest or k-largest elements.
-func (qo *queryOptimizer) sortIterator(it document.Iterator) (st document.Stream, err error) {
-	k := 0
-	if qo.limit != -1 {
-		k += qo.limit
-		if qo.offset != -1 {
-			k += qo.offset
+// encodeKey converts v to the type of the primary key and encodes it.
+// It returns false and no data if v is a number that can't be converted without changing its value.
+func (it pkIterator) encodeKey(v document.Value) ([]byte, bool, error) {
+	if v.Type.IsNumber() && it.cfg.PrimaryKey.Type.IsNumber() {
+		c, err := v.ConvertTo(it.cfg.PrimaryKey.Type)
+		if err != nil {
+			return nil, false, nil
 		}
-	}
 
-	path := document.ValuePath(qo.orderBy)
+		ok, err := c.IsEqual(v)
+		if err != nil || !ok {
+			return nil, false, err
+		}
 
-	var h heap.Interface
-	if qo.orderByDirection == scanner.ASC {
-		h = new(minHeap)
-	} else {
-		h = new(maxHeap)
+		v = c
 	}
 
-	heap.Init(h)
+	data, err := encoding.EncodeValue(v)
+	return data, true, err
+}
 
-	err = it.Iterate(func(d document.Document) error {
-		v, err := path.GetValue(d)
-		if err != nil && err != document.ErrFieldNotFound {
-			return err
-		}
-		if err == document.ErrFieldNotFound {
-			v = document.NewNullValue()
-		}
+// iterateEq calls fn with the key and the document whose primary key is equal to v, if it exists.
+func (it pkIterator) iterateEq(v document.Value, fn func(k, v []byte) error) error {
+	data, ok, err := it.encodeKey(v)
+	if err != nil || !ok {
+		return err
+	}
 
-		value, err := encoding.EncodeValue(v)
-		if err != nil {
-			return err
+	val, err := it.tb.Store.Get(data)
+	if err != nil {
+		if err == engine.ErrKeyNotFound {
+			return nil
 		}
 
-		data, err := encoding.EncodeDocument(d)
-		if err != nil {
+		return err
+	}
+
+	return fn(data, val)
+}
+
+// iteratePrefix calls fn for every document whose composite primary key starts with the values of eq
+// and whose next field is within the range, if any.
+func (it pkIterator) iteratePrefix(fn func(k, v []byte) error) error {
+	tr, err := evalTupleRange(it.tx, it.args, it.eq, it.rng)
+	if err != nil {
+		return err
+	}
+
+	desc := it.orderByDirection == scanner.DESC
+
+	visit := func(key, val []byte) error {
+		ok, err := tr.match(key, desc)
+		if !ok || err != nil {
 			return err
 		}
 
-		heap.Push(h, heapNode{
-			value: value,
-			data:  data,
-		})
+		return fn(key, val)
+	}
 
-		return nil
-	})
-	if err != nil {
-		return
+	pivot := tr.pivot(desc)
+	if desc {
+		// the key of a document is greater than the pivot if it has more fields
+		err = it.tb.Store.DescendLessOrEqual(append(pivot, 0xFF), visit)
+	} else {
+		err = it.tb.Store.AscendGreaterOrEqual(pivot, visit)
 	}
 
-	st = document.NewStream(&sortedIterator{h, k})
+	if err != nil && err != errStop {
+		return err
+	}
 
-	return
+	return nil
 }
 
-type sortedIterator struct {
-	h heap.Interface
-	k int
+// unionIterator iterates over the documents selected by any of its iterators.
+// Documents selected by several iterators are only returned once.
+type unionIterator struct {
+	tb        *database.Table
+	iterators []keyIterator
 }
 
-func (s *sortedIterator) Iterate(fn func(d document.Document) error) error {
-	i := 0
-	for s.h.Len() > 0 && (s.k == 0 || i < s.k) {
-		err := fn(encoding.EncodedDocument(heap.Pop(s.h).(heapNode).data))
+func (it unionIterator) Iterate(fn func(d document.Document) error) error {
+	return it.iterateKeys(func(key []byte) error {
+		r, err := it.tb.GetDocument(key)
 		if err != nil {
 			return err
 		}
-		i++
-	}
 
-	return nil
+		return fn(r)
+	})
 }
 
-type heapNode struct {
-	value []byte
-	data  []byte
-}
+func (it unionIterator) iterateKeys(fn func(key []byte) error) error {
+	seen := make(map[string]struct{})
 
-type minHeap []heapNode
+	for _, sub := range it.iterators {
+		err := sub.iterateKeys(func(key []byte) error {
+			if _, ok := seen[string(key)]; ok {
+				return nil
+			}
+			seen[string(key)] = struct{}{}
 
-func (h minHeap) Len() int           { return len(h) }
-func (h minHeap) Less(i, j int) bool { return bytes.Compare(h[i].value, h[j].value) < 0 }
-func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+			return fn(key)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-func (h *minHeap) Push(x interface{}) {
-	*h = append(*h, x.(heapNode))
+	return nil
 }
 
-func (h *minHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
+// intersectionIterator iterates over the documents selected by all of its iterators.
+type intersectionIterator struct {
+	tb        *database.Table
+	iterators []keyIterator
 }
 
-type maxHeap struct {
-	minHeap
+func (it intersectionIterator) Iterate(fn func(d document.Document) error) error {
+	return it.iterateKeys(func(key []byte) error {
+		r, err := it.tb.GetDocument(key)
+		if err != nil {
+			return err
+		}
+
+		return fn(r)
+	})
 }
 
-func (h maxHeap) Less(i, j int) bool { return bytes.Compare(h.minHeap[i].value, h.minHeap[j].value) > 0 }
+func (it intersectionIterator) iterateKeys(fn func(key []byte) error) error {
+	// keys selected by every iterator but the last one
+	var keys map[string]struct{}
+
+	last := len(it.iterators) - 1
+	for _, sub := range it.iterators[:last] {
+		found := make(map[string]struct{})
+		err := sub.iterateKeys(func(key []byte) error {
+			if _, ok := keys[string(key)]; ok || keys == nil {
+				found[string(key)] = struct{}{}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		keys = found
+		if len(keys) == 0 {
+			return nil
+		}
+	}
+
+	return it.iterators[last].iterateKeys(func(key []byte) error {
+		if _, ok := keys[string(key)]; !ok {
+			return nil
+		}
+
+		return fn(key)
+	})
+}
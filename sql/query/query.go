@@ -147,6 +147,10 @@ func (r *Result) Close() (err error) {
 	return err
 }
 
+// whereClause returns a function that evaluates e against a document and reports
+// whether the document matches.
+// Only documents for which e evaluates to a truthy value match: documents for which
+// e evaluates to NULL or to a field that doesn't exist are filtered out.
 func whereClause(e Expr, stack EvalStack) func(d document.Document) (bool, error) {
 	if e == nil {
 		return func(d document.Document) (bool, error) {
@@ -157,10 +161,13 @@ func whereClause(e Expr, stack EvalStack) func(d document.Document) (bool, error
 	return func(d document.Document) (bool, error) {
 		stack.Document = d
 		v, err := e.Eval(stack)
+		if err == document.ErrFieldNotFound {
+			return false, nil
+		}
 		if err != nil {
 			return false, err
 		}
 
-		return v.IsTruthy(), nil
+		return isTrue(v), nil
 	}
 }
@@ -0,0 +1,52 @@
+package query
+
+import (
+	"database/sql/driver"
+
+	"github.com/asdine/genji/database"
+)
+
+// ReIndexStmt is a DSL that allows creating a full REINDEX statement.
+// If IndexName is set, only that index is rebuilt. If TableName is set,
+// all the indexes of that table are rebuilt. Otherwise, all the indexes of the database are rebuilt.
+type ReIndexStmt struct {
+	IndexName string
+	TableName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt ReIndexStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run truncates and recreates the selected indexes from the documents of their table.
+// It implements the Statement interface.
+func (stmt ReIndexStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	switch {
+	case stmt.IndexName != "":
+		return res, tx.ReIndex(stmt.IndexName)
+	case stmt.TableName != "":
+		tb, err := tx.GetTable(stmt.TableName)
+		if err != nil {
+			return res, err
+		}
+
+		indexes, err := tb.Indexes()
+		if err != nil {
+			return res, err
+		}
+
+		for _, idx := range indexes {
+			err = tx.ReIndex(idx.IndexName)
+			if err != nil {
+				return res, err
+			}
+		}
+
+		return res, nil
+	}
+
+	return res, tx.ReIndexAll()
+}
@@ -0,0 +1,128 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		reindexed []string
+		fails     bool
+	}{
+		{"All", "REINDEX", []string{"idx_test1_a", "idx_test1_b", "idx_test2_a"}, false},
+		{"Index", "REINDEX idx_test1_a", []string{"idx_test1_a"}, false},
+		{"Table", "REINDEX TABLE test1", []string{"idx_test1_a", "idx_test1_b"}, false},
+		{"Unknown index", "REINDEX foo", nil, true},
+		{"Unknown table", "REINDEX TABLE foo", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test1;
+				CREATE TABLE test2;
+				CREATE INDEX idx_test1_a ON test1 (a);
+				CREATE INDEX idx_test1_b ON test1 (b);
+				CREATE INDEX idx_test2_a ON test2 (a);
+				INSERT INTO test1 VALUES {a: 1, b: 10}, {a: 2, b: 20};
+				INSERT INTO test2 VALUES {a: 1}, {a: 2};
+			`)
+			require.NoError(t, err)
+
+			// empty the indexes, to see which ones are rebuilt
+			err = db.Update(func(tx *genji.Tx) error {
+				for _, name := range []string{"idx_test1_a", "idx_test1_b", "idx_test2_a"} {
+					idx, err := tx.GetIndex(name)
+					require.NoError(t, err)
+					require.NoError(t, idx.Truncate())
+				}
+				return nil
+			})
+			require.NoError(t, err)
+
+			err = db.Exec(test.query)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = db.View(func(tx *genji.Tx) error {
+				for _, name := range []string{"idx_test1_a", "idx_test1_b", "idx_test2_a"} {
+					idx, err := tx.GetIndex(name)
+					require.NoError(t, err)
+
+					var i int
+					err = idx.AscendGreaterOrEqual(nil, func(val document.Value, key []byte) error {
+						i++
+						return nil
+					})
+					require.NoError(t, err)
+
+					if containsString(test.reindexed, name) {
+						require.Equal(t, 2, i, name)
+					} else {
+						require.Zero(t, i, name)
+					}
+				}
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("Unique index with duplicate values", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE UNIQUE INDEX idx_test_a ON test (a);
+			INSERT INTO test VALUES {a: 1}, {a: 2};
+		`)
+		require.NoError(t, err)
+
+		// store a duplicate value without updating the index
+		err = db.Update(func(tx *genji.Tx) error {
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+
+			data, err := encoding.EncodeDocument(document.NewFieldBuffer().Add("a", document.NewIntValue(1)))
+			if err != nil {
+				return err
+			}
+
+			return tb.Store.Put([]byte("duplicate"), data)
+		})
+		require.NoError(t, err)
+
+		err = db.Exec("REINDEX idx_test_a")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `"idx_test_a"`)
+	})
+}
+
+func containsString(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
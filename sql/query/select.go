@@ -1,6 +1,7 @@
 package query
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"errors"
 	"fmt"
@@ -15,13 +16,308 @@ import (
 
 // SelectStmt is a DSL that allows creating a full Select query.
 type SelectStmt struct {
-	TableName        string
-	WhereExpr        Expr
-	OrderBy          FieldSelector
-	OrderByDirection scanner.Token
-	OffsetExpr       Expr
-	LimitExpr        Expr
-	Selectors        []ResultField
+	TableName  string
+	TableAlias string
+	Joins      []JoinClause
+	Distinct   bool
+	WhereExpr  Expr
+	GroupBy    []FieldSelector
+	HavingExpr Expr
+	OrderBy    []OrderByField
+	OffsetExpr Expr
+	LimitExpr  Expr
+	Selectors  []ResultField
+}
+
+// OrderByField is one of the sort keys of the ORDER BY clause.
+// Documents are sorted by the first key, then documents with the same value
+// are sorted by the second key, and so on.
+type OrderByField struct {
+	Path FieldSelector
+	// Aggregate is the aggregate function used to sort the groups, if any. Path is then ignored.
+	Aggregate AggregatorBuilder
+	// Direction is either scanner.ASC or scanner.DESC. Any other value is considered as scanner.ASC.
+	Direction scanner.Token
+	Nulls     NullsOrder
+}
+
+// NullsOrder specifies where an ORDER BY clause places the documents
+// where the sort key is NULL or doesn't exist.
+type NullsOrder uint8
+
+// Values of NullsOrder.
+const (
+	// NullsDefault considers NULL as the smallest value:
+	// NULLs are first in ascending order and last in descending order.
+	NullsDefault NullsOrder = iota
+	NullsFirst
+	NullsLast
+)
+
+// String returns the SQL representation of the statement.
+func (stmt SelectStmt) String() string {
+	var b strings.Builder
+
+	b.WriteString("SELECT ")
+	if stmt.Distinct {
+		b.WriteString("DISTINCT ")
+	}
+
+	for i, rf := range stmt.Selectors {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+
+		switch t := rf.(type) {
+		case ResultFieldExpr:
+			b.WriteString(exprString(t.Expr))
+			if t.ExprName != exprString(t.Expr) {
+				b.WriteString(" AS " + t.ExprName)
+			}
+		default:
+			b.WriteString(rf.Name())
+		}
+	}
+
+	b.WriteString(" FROM " + stmt.TableName)
+	if stmt.TableAlias != "" {
+		b.WriteString(" AS " + stmt.TableAlias)
+	}
+
+	for _, j := range stmt.Joins {
+		if j.Left {
+			b.WriteString(" LEFT")
+		}
+		b.WriteString(" JOIN " + j.TableName)
+		if j.Alias != "" {
+			b.WriteString(" AS " + j.Alias)
+		}
+		b.WriteString(" ON " + exprString(j.On))
+	}
+
+	if stmt.WhereExpr != nil {
+		b.WriteString(" WHERE " + exprString(stmt.WhereExpr))
+	}
+
+	for i, f := range stmt.GroupBy {
+		if i == 0 {
+			b.WriteString(" GROUP BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(f.String())
+	}
+
+	if stmt.HavingExpr != nil {
+		b.WriteString(" HAVING " + exprString(stmt.HavingExpr))
+	}
+
+	for i, f := range stmt.OrderBy {
+		if i == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		if f.Aggregate != nil {
+			b.WriteString(f.Aggregate.Name())
+		} else {
+			b.WriteString(f.Path.String())
+		}
+		if f.Direction == scanner.DESC {
+			b.WriteString(" DESC")
+		}
+		switch f.Nulls {
+		case NullsFirst:
+			b.WriteString(" NULLS FIRST")
+		case NullsLast:
+			b.WriteString(" NULLS LAST")
+		}
+	}
+
+	if stmt.LimitExpr != nil {
+		b.WriteString(" LIMIT " + exprString(stmt.LimitExpr))
+	}
+
+	if stmt.OffsetExpr != nil {
+		b.WriteString(" OFFSET " + exprString(stmt.OffsetExpr))
+	}
+
+	return b.String()
+}
+
+// tableNames returns the names used to refer to the tables of the statement:
+// their alias, or their name if they don't have one.
+func (stmt SelectStmt) tableNames() []string {
+	name := stmt.TableName
+	if stmt.TableAlias != "" {
+		name = stmt.TableAlias
+	}
+
+	names := []string{name}
+	for _, j := range stmt.Joins {
+		names = append(names, j.Name())
+	}
+
+	return names
+}
+
+// transform returns a copy of stmt where transformExpr has been called with fn
+// on the expressions of the selectors and of the ON, WHERE, HAVING, LIMIT and OFFSET clauses.
+func (stmt SelectStmt) transform(fn func(e Expr) (Expr, bool)) SelectStmt {
+	stmt.WhereExpr, _ = transformExpr(stmt.WhereExpr, fn)
+	stmt.HavingExpr, _ = transformExpr(stmt.HavingExpr, fn)
+	stmt.LimitExpr, _ = transformExpr(stmt.LimitExpr, fn)
+	stmt.OffsetExpr, _ = transformExpr(stmt.OffsetExpr, fn)
+
+	joins := make([]JoinClause, len(stmt.Joins))
+	for i, j := range stmt.Joins {
+		j.On, _ = transformExpr(j.On, fn)
+		joins[i] = j
+	}
+	stmt.Joins = joins
+
+	selectors := make([]ResultField, len(stmt.Selectors))
+	for i, rf := range stmt.Selectors {
+		selectors[i] = rf
+
+		switch t := rf.(type) {
+		case ResultFieldExpr:
+			if e, ok := transformExpr(t.Expr, fn); ok {
+				selectors[i] = ResultFieldExpr{Expr: e, ExprName: t.ExprName}
+			}
+		case Expr:
+			// the transformed expression keeps the name of the original one
+			if e, ok := transformExpr(t, fn); ok {
+				selectors[i] = ResultFieldExpr{Expr: e, ExprName: rf.Name()}
+			}
+		}
+	}
+	stmt.Selectors = selectors
+
+	return stmt
+}
+
+// resolveFields returns a copy of stmt where the fields are resolved against the tables of the statement.
+// Without joins, documents are not qualified: the fields qualified by the name or the alias
+// of the table lose their qualifier. With joins, documents contain one field per table and
+// fields that are not qualified are looked up in every table when the documents are read.
+// The ORDER BY fields that are aliases of result fields are replaced by the fields they refer to.
+// It returns an error if a field is qualified by the name of a table that has an alias.
+func (stmt SelectStmt) resolveFields() (SelectStmt, error) {
+	names := stmt.tableNames()
+
+	var hidden []string
+	if stmt.TableAlias != "" {
+		hidden = append(hidden, stmt.TableName)
+	}
+	for _, j := range stmt.Joins {
+		if j.Alias != "" {
+			hidden = append(hidden, j.TableName)
+		}
+	}
+
+	var err error
+	resolve := func(fs FieldSelector) FieldSelector {
+		if len(fs) < 2 {
+			return fs
+		}
+
+		switch {
+		case containsString(names, fs[0]):
+			if len(stmt.Joins) == 0 {
+				return fs[1:]
+			}
+		case containsString(hidden, fs[0]) && err == nil:
+			err = fmt.Errorf("table %q must be referred to by its alias", fs[0])
+		}
+
+		return fs
+	}
+
+	resolveExpr := func(e Expr) (Expr, bool) {
+		switch t := e.(type) {
+		case FieldSelector:
+			return resolve(t), true
+		case CountFunc:
+			if !t.Wildcard {
+				t.Path = resolve(t.Path)
+			}
+			return t, true
+		case SumFunc:
+			t.Path = resolve(t.Path)
+			return t, true
+		case AvgFunc:
+			t.Path = resolve(t.Path)
+			return t, true
+		case MinFunc:
+			t.Path = resolve(t.Path)
+			return t, true
+		case MaxFunc:
+			t.Path = resolve(t.Path)
+			return t, true
+		}
+
+		return e, false
+	}
+	stmt = stmt.transform(resolveExpr)
+
+	groupBy := make([]FieldSelector, len(stmt.GroupBy))
+	for i, fs := range stmt.GroupBy {
+		groupBy[i] = resolve(fs)
+	}
+	stmt.GroupBy = groupBy
+
+	orderBy := make([]OrderByField, len(stmt.OrderBy))
+	for i, f := range stmt.OrderBy {
+		if f.Aggregate != nil {
+			e, _ := resolveExpr(f.Aggregate)
+			f.Aggregate = e.(AggregatorBuilder)
+			// the result of the aggregate function is stored under its name in the documents of each group
+			f.Path = FieldSelector{f.Aggregate.Name()}
+		} else if rf, ok := stmt.aliasedField(f.Path); ok {
+			path, aerr := orderByAlias(rf)
+			if aerr != nil && err == nil {
+				err = aerr
+			}
+			f.Path = path
+		} else {
+			f.Path = resolve(f.Path)
+		}
+		orderBy[i] = f
+	}
+	stmt.OrderBy = orderBy
+
+	return stmt, err
+}
+
+// aliasedField returns the result field whose alias is fs, if any.
+func (stmt SelectStmt) aliasedField(fs FieldSelector) (ResultFieldExpr, bool) {
+	if len(fs) != 1 {
+		return ResultFieldExpr{}, false
+	}
+
+	for _, rf := range stmt.Selectors {
+		if t, ok := rf.(ResultFieldExpr); ok && t.ExprName == fs[0] {
+			return t, true
+		}
+	}
+
+	return ResultFieldExpr{}, false
+}
+
+// orderByAlias returns the field used to sort the documents by the result field rf.
+// Documents are sorted before the result fields are evaluated: only the aliases
+// of fields and of aggregate functions, whose results are stored in the documents
+// of each group, can be used to sort them.
+func orderByAlias(rf ResultFieldExpr) (FieldSelector, error) {
+	switch t := rf.Expr.(type) {
+	case FieldSelector:
+		return t, nil
+	case AggregatorBuilder:
+		return FieldSelector{t.Name()}, nil
+	}
+
+	return FieldSelector{rf.ExprName}, fmt.Errorf("cannot sort by %q: only the aliases of fields and aggregate functions can be used in ORDER BY", rf.ExprName)
 }
 
 // IsReadOnly always returns true. It implements the Statement interface.
@@ -39,110 +335,294 @@ func (stmt SelectStmt) Run(tx *database.Transaction, args []driver.NamedValue) (
 func (stmt SelectStmt) exec(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
 	var res Result
 
-	if stmt.TableName == "" {
-		return res, errors.New("missing table selector")
+	stmt, err := stmt.resolveFields()
+	if err != nil {
+		return res, err
+	}
+
+	stmt = stmt.transform(bindSubqueries(stmt.tableNames(), len(stmt.Joins) != 0))
+
+	qo, limit, offset, err := stmt.prepare(tx, args)
+	if err != nil {
+		return res, err
 	}
 
-	if stmt.OrderByDirection != scanner.DESC {
-		stmt.OrderByDirection = scanner.ASC
+	st, err := qo.optimizeQuery()
+	if err != nil {
+		return res, err
 	}
 
-	offset := -1
-	limit := -1
+	st = st.Map(func(d document.Document) (document.Document, error) {
+		return documentMask{
+			tx:           tx,
+			cfg:          qo.cfg,
+			r:            d,
+			params:       args,
+			resultFields: stmt.Selectors,
+		}, nil
+	})
+
+	if stmt.Distinct {
+		st = document.NewStream(distinctIterator{it: st})
+	}
+
+	if offset > 0 {
+		st = st.Offset(offset)
+	}
+
+	if limit >= 0 {
+		st = st.Limit(limit)
+	}
+
+	return Result{Stream: st}, nil
+}
+
+// explain returns a document describing how the statement reads the table,
+// without running it. It implements the explainer interface.
+func (stmt SelectStmt) explain(tx *database.Transaction, args []driver.NamedValue) (document.Document, error) {
+	stmt, err := stmt.resolveFields()
+	if err != nil {
+		return nil, err
+	}
+
+	qo, limit, offset, err := stmt.transform(bindSubqueries(stmt.tableNames(), len(stmt.Joins) != 0)).prepare(tx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	fb, err := qo.explain()
+	if err != nil {
+		return nil, err
+	}
+
+	if limit >= 0 {
+		fb.Add("limit", document.NewIntValue(limit))
+	}
+
+	if offset >= 0 {
+		fb.Add("offset", document.NewIntValue(offset))
+	}
+
+	return fb, nil
+}
+
+// prepare checks the statement and evaluates its LIMIT and OFFSET clauses.
+// It returns the query optimizer used to read the documents, and -1 for the clauses that are not set.
+func (stmt SelectStmt) prepare(tx *database.Transaction, args []driver.NamedValue) (qo queryOptimizer, limit, offset int, err error) {
+	if stmt.TableName == "" {
+		return qo, 0, 0, errors.New("missing table selector")
+	}
+
+	if len(collectAggregators(nil, stmt.WhereExpr)) > 0 {
+		return qo, 0, 0, errAggregateOutsideGroup
+	}
 
 	stack := EvalStack{
 		Tx:     tx,
 		Params: args,
 	}
 
-	if stmt.OffsetExpr != nil {
-		v, err := stmt.OffsetExpr.Eval(stack)
-		if err != nil {
-			return res, err
-		}
+	offset, err = evalLimitOffset(stmt.OffsetExpr, "offset", stack)
+	if err != nil {
+		return qo, 0, 0, err
+	}
 
-		if !v.Type.IsNumber() {
-			return res, fmt.Errorf("offset expression must evaluate to a number, got %q", v.Type)
-		}
+	limit, err = evalLimitOffset(stmt.LimitExpr, "limit", stack)
+	if err != nil {
+		return qo, 0, 0, err
+	}
 
-		voff, err := v.ConvertTo(document.IntValue)
-		if err != nil {
-			return res, err
+	qo, err = newQueryOptimizer(tx, stmt.TableName)
+	if err != nil {
+		return qo, 0, 0, err
+	}
+	qo.tableAlias = stmt.TableAlias
+	qo.joins = stmt.Joins
+	qo.whereExpr = stmt.WhereExpr
+	qo.args = args
+	qo.groupBy = stmt.GroupBy
+	qo.havingExpr = stmt.HavingExpr
+	for _, rf := range stmt.Selectors {
+		switch t := rf.(type) {
+		case KeyFunc:
+			if len(stmt.Joins) != 0 {
+				return qo, 0, 0, errors.New("key() cannot be used in a query with joins")
+			}
+		case ResultFieldExpr:
+			qo.aggregators = collectAggregators(qo.aggregators, t.Expr)
+		case Expr:
+			qo.aggregators = collectAggregators(qo.aggregators, t)
 		}
-		offset, err = voff.ConvertToInt()
+	}
+	qo.aggregators = collectAggregators(qo.aggregators, stmt.HavingExpr)
+	for _, f := range stmt.OrderBy {
+		qo.aggregators = collectAggregators(qo.aggregators, f.Aggregate)
+	}
+	if len(qo.groupBy) != 0 || len(qo.aggregators) != 0 || qo.havingExpr != nil {
+		err = stmt.checkGroupedFields(qo.aggregators)
 		if err != nil {
-			return res, err
+			return qo, 0, 0, err
 		}
 	}
+	qo.orderBy = stmt.OrderBy
+	// the sort can only stop after limit + offset documents if none of them are removed afterwards
+	qo.limit = -1
+	qo.offset = -1
+	if !stmt.Distinct {
+		qo.limit = limit
+		qo.offset = offset
+	}
 
-	if stmt.LimitExpr != nil {
-		v, err := stmt.LimitExpr.Eval(stack)
-		if err != nil {
-			return res, err
-		}
+	return qo, limit, offset, nil
+}
 
-		if !v.Type.IsNumber() {
-			return res, fmt.Errorf("limit expression must evaluate to a number, got %q", v.Type)
+// checkGroupedFields returns an error if the selectors, the HAVING clause or the ORDER BY clause
+// of a grouped query refer to a field that is neither a GROUP BY field, or one of its sub-fields,
+// nor the argument of an aggregate function: the documents of each group don't contain it.
+// For the same reason, the selectors can't contain a wildcard.
+func (stmt SelectStmt) checkGroupedFields(aggs []AggregatorBuilder) error {
+	grouped := func(fs FieldSelector) bool {
+		for _, g := range stmt.GroupBy {
+			if len(g) <= len(fs) && g.Name() == fs[:len(g)].Name() {
+				return true
+			}
 		}
 
-		vlim, err := v.ConvertTo(document.IntValue)
-		if err != nil {
-			return res, err
+		return false
+	}
+
+	var err error
+	check := func(e Expr) {
+		transformExpr(e, func(e Expr) (Expr, bool) {
+			switch t := e.(type) {
+			case AggregatorBuilder:
+				// the fields of aggregate functions are evaluated on every document of the group
+				return e, true
+			case FieldSelector:
+				if !grouped(t) && err == nil {
+					err = fmt.Errorf("field %q must appear in the GROUP BY clause or be used in an aggregate function", t.Name())
+				}
+			}
+			return e, false
+		})
+	}
+
+	for _, rf := range stmt.Selectors {
+		switch t := rf.(type) {
+		case Wildcard:
+			// the documents of each group only contain the GROUP BY fields
+			if err == nil {
+				err = errors.New("wildcard can't be used with GROUP BY or aggregate functions")
+			}
+		case ResultFieldExpr:
+			check(t.Expr)
+		case Expr:
+			check(t)
 		}
-		limit, err = vlim.ConvertToInt()
-		if err != nil {
-			return res, err
+	}
+	check(stmt.HavingExpr)
+	for _, f := range stmt.OrderBy {
+		// aliases of aggregate functions refer to their result
+		if f.Aggregate == nil && !(len(f.Path) == 1 && containsAggregator(aggs, f.Path[0])) {
+			check(f.Path)
 		}
 	}
 
-	qo, err := newQueryOptimizer(tx, stmt.TableName)
-	if err != nil {
-		return res, err
+	return err
+}
+
+// containsAggregator reports whether one of aggs is named name.
+func containsAggregator(aggs []AggregatorBuilder, name string) bool {
+	for _, agg := range aggs {
+		if agg.Name() == name {
+			return true
+		}
 	}
-	qo.whereExpr = stmt.WhereExpr
-	qo.args = args
-	qo.orderBy = stmt.OrderBy
-	qo.orderByDirection = stmt.OrderByDirection
-	qo.limit = limit
-	qo.offset = offset
 
-	st, err := qo.optimizeQuery()
+	return false
+}
+
+// evalLimitOffset evaluates the expression of the LIMIT or OFFSET clause.
+// It returns -1 if e is nil.
+func evalLimitOffset(e Expr, clause string, stack EvalStack) (int, error) {
+	if e == nil {
+		return -1, nil
+	}
+
+	v, err := e.Eval(stack)
 	if err != nil {
-		return res, err
+		return 0, err
 	}
 
-	if offset > 0 {
-		st = st.Offset(offset)
+	if !v.Type.IsNumber() {
+		return 0, fmt.Errorf("%s expression must evaluate to a number, got %q", clause, v.Type)
 	}
 
-	if limit >= 0 {
-		st = st.Limit(limit)
+	v, err = v.ConvertTo(document.IntValue)
+	if err != nil {
+		return 0, err
 	}
 
-	st = st.Map(func(d document.Document) (document.Document, error) {
-		return documentMask{
-			cfg:          qo.cfg,
-			r:            d,
-			resultFields: stmt.Selectors,
-		}, nil
-	})
+	return v.ConvertToInt()
+}
 
-	return Result{Stream: st}, nil
+// distinctIterator returns the documents of an iterator, skipping the documents
+// that are equal to a previously returned one.
+// Documents are compared by value following the comparison rules of the document package, except that
+// booleans are only equal to booleans: they are identified by a binary key that is the same for all equal documents,
+// and only the keys of the documents already returned are kept in memory.
+// Documents are returned in the order of the iterator, as soon as they are read.
+type distinctIterator struct {
+	it document.Iterator
+}
+
+func (it distinctIterator) Iterate(fn func(d document.Document) error) error {
+	seen := make(map[string]struct{})
+	var buf bytes.Buffer
+
+	return it.it.Iterate(func(d document.Document) error {
+		buf.Reset()
+		err := writeValueKey(&buf, document.NewDocumentValue(d))
+		if err != nil {
+			return err
+		}
+
+		if _, ok := seen[buf.String()]; ok {
+			return nil
+		}
+		seen[buf.String()] = struct{}{}
+
+		return fn(d)
+	})
 }
 
 type documentMask struct {
+	tx           *database.Transaction
 	cfg          *database.TableConfig
 	r            document.Document
+	params       []driver.NamedValue
 	resultFields []ResultField
 }
 
 var _ document.Document = documentMask{}
 
-func (r documentMask) GetByField(name string) (document.Value, error) {
-	for _, rf := range r.resultFields {
-		if rf.Name() == name || rf.Name() == "*" {
-			return r.r.GetByField(name)
+// GetByField returns the value of the first result field with the given name.
+func (r documentMask) GetByField(field string) (document.Value, error) {
+	var v document.Value
+
+	err := r.Iterate(func(f string, value document.Value) error {
+		if f == field {
+			v = value
+			return errStop
 		}
+
+		return nil
+	})
+	if err == errStop {
+		return v, nil
+	}
+	if err != nil {
+		return document.Value{}, err
 	}
 
 	return document.Value{}, document.ErrFieldNotFound
@@ -150,8 +630,10 @@ func (r documentMask) GetByField(name string) (document.Value, error) {
 
 func (r documentMask) Iterate(fn func(f string, v document.Value) error) error {
 	stack := EvalStack{
+		Tx:       r.tx,
 		Document: r.r,
 		Cfg:      r.cfg,
+		Params:   r.params,
 	}
 
 	for _, rf := range r.resultFields {
@@ -178,6 +660,11 @@ func (f FieldSelector) Name() string {
 	return strings.Join(f, ".")
 }
 
+// String returns the name of the field selector. It implements the fmt.Stringer interface.
+func (f FieldSelector) String() string {
+	return f.Name()
+}
+
 func (f FieldSelector) selectField(d document.Document) (string, document.Value, error) {
 	if d == nil {
 		return f.Name(), nilLitteral, document.ErrFieldNotFound
@@ -196,6 +683,9 @@ func (f FieldSelector) selectField(d document.Document) (string, document.Value,
 				return f.Name(), nilLitteral, document.ErrFieldNotFound
 			}
 			v, err = a.GetByIndex(idx)
+			if err == document.ErrValueNotFound {
+				err = document.ErrFieldNotFound
+			}
 		}
 		if err != nil {
 			return f.Name(), nilLitteral, err
@@ -235,6 +725,8 @@ func (f FieldSelector) Iterate(stack EvalStack, fn func(fd string, v document.Va
 }
 
 // Eval extracts the document from the context and selects the right field.
+// If the field doesn't exist, it returns document.ErrFieldNotFound, which operators
+// interpret following the rules of their three-valued logic.
 // It implements the Expr interface.
 func (f FieldSelector) Eval(stack EvalStack) (document.Value, error) {
 	if stack.Document == nil {
@@ -243,12 +735,39 @@ func (f FieldSelector) Eval(stack EvalStack) (document.Value, error) {
 
 	_, v, err := f.selectField(stack.Document)
 	if err != nil {
-		return nilLitteral, document.ErrFieldNotFound
+		return nilLitteral, err
 	}
 
 	return v, nil
 }
 
+// A ResultFieldExpr is a ResultField that evaluates an expression and stores the result
+// under ExprName, which is either the alias chosen with the AS keyword or the
+// string representation of the expression.
+type ResultFieldExpr struct {
+	Expr     Expr
+	ExprName string
+}
+
+// Name returns ExprName.
+func (r ResultFieldExpr) Name() string {
+	return r.ExprName
+}
+
+// Iterate evaluates the expression and calls fn once with the result.
+// If the expression evaluates to a field that doesn't exist, the result is NULL.
+func (r ResultFieldExpr) Iterate(stack EvalStack, fn func(fd string, v document.Value) error) error {
+	v, err := r.Expr.Eval(stack)
+	if err == document.ErrFieldNotFound {
+		v, err = nilLitteral, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fn(r.ExprName, v)
+}
+
 // A Wildcard is a ResultField that iterates over all the fields of a document.
 type Wildcard struct{}
 
@@ -272,6 +791,22 @@ func (k KeyFunc) Name() string {
 
 // Iterate identifies the primary key for the document and calls fn with it.
 func (k KeyFunc) Iterate(stack EvalStack, fn func(fd string, v document.Value) error) error {
+	// a composite primary key is returned as one field per path
+	for _, p := range stack.Cfg.PrimaryKeyPaths {
+		v, err := p.GetValue(stack.Document)
+		if err != nil {
+			return err
+		}
+
+		err = fn(p.String(), v)
+		if err != nil {
+			return err
+		}
+	}
+	if len(stack.Cfg.PrimaryKeyPaths) != 0 {
+		return nil
+	}
+
 	if len(stack.Cfg.PrimaryKey.Path) != 0 {
 		v, err := stack.Cfg.PrimaryKey.Path.GetValue(stack.Document)
 		if err != nil {
@@ -280,7 +815,12 @@ func (k KeyFunc) Iterate(stack EvalStack, fn func(fd string, v document.Value) e
 		return fn(stack.Cfg.PrimaryKey.Path.String(), v)
 	}
 
-	v, err := encoding.DecodeValue(document.Int64Value, stack.Document.(document.Keyer).Key())
+	keyer, ok := stack.Document.(document.Keyer)
+	if !ok {
+		return errors.New("key() is not available for this document")
+	}
+
+	v, err := encoding.DecodeValue(document.Int64Value, keyer.Key())
 	if err != nil {
 		return err
 	}
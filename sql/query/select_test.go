@@ -3,6 +3,9 @@ package query_test
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/asdine/genji"
@@ -23,7 +26,7 @@ func TestSelectStmt(t *testing.T) {
 		{"Multiple wildcards cond", "SELECT *, *, color FROM test", false, `[{"k":1,"color":"red","size":10,"shape":"square","k":1,"color":"red","size":10,"shape":"square","color":"red"},{"k":2,"color":"blue","size":10,"weight":1,"k":2,"color":"blue","size":10,"weight":1,"color":"blue"},{"k":3,"height":100,"weight":20,"k":3,"height":100,"weight":20,"color":null}]`, nil},
 		{"With fields", "SELECT color, shape FROM test", false, `[{"color":"red","shape":"square"},{"color":"blue","shape":null},{"color":null,"shape":null}]`, nil},
 		{"With eq cond", "SELECT * FROM test WHERE size = 10", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
-		{"With neq cond", "SELECT * FROM test WHERE color != 'red'", false, `[{"k":2,"color":"blue","size":10,"weight":1},{"k":3,"height":100,"weight":20}]`, nil},
+		{"With neq cond", "SELECT * FROM test WHERE color != 'red'", false, `[{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
 		{"With gt cond", "SELECT * FROM test WHERE size > 10", false, `[]`, nil},
 		{"With lt cond", "SELECT * FROM test WHERE size < 15", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
 		{"With lte cond", "SELECT * FROM test WHERE color <= 'salmon' ORDER BY k ASC", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
@@ -41,6 +44,11 @@ func TestSelectStmt(t *testing.T) {
 		{"With order by pk asc", "SELECT * FROM test ORDER BY k ASC", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1},{"k":3,"height":100,"weight":20}]`, nil},
 		{"With order by pk desc", "SELECT * FROM test ORDER BY k DESC", false, `[{"k":3,"height":100,"weight":20},{"k":2,"color":"blue","size":10,"weight":1},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With order by and where", "SELECT * FROM test WHERE color != 'blue' ORDER BY color DESC LIMIT 1", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With multiple order by", "SELECT k FROM test ORDER BY size DESC, k DESC", false, `[{"k":2},{"k":1},{"k":3}]`, nil},
+		{"With multiple order by and limit", "SELECT k FROM test ORDER BY size, k DESC LIMIT 2", false, `[{"k":3},{"k":2}]`, nil},
+		{"With multiple order by and nulls last", "SELECT k FROM test ORDER BY size NULLS LAST, color", false, `[{"k":2},{"k":1},{"k":3}]`, nil},
+		{"With order by desc and nulls first", "SELECT k FROM test ORDER BY size DESC NULLS FIRST, k", false, `[{"k":3},{"k":1},{"k":2}]`, nil},
+		{"With order by and nulls first on non-indexed field", "SELECT k FROM test ORDER BY weight DESC NULLS FIRST", false, `[{"k":1},{"k":3},{"k":2}]`, nil},
 		{"With limit", "SELECT * FROM test WHERE size = 10 LIMIT 1", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
 		{"With offset", "SELECT *, key() FROM test WHERE size = 10 OFFSET 1", false, `[{"k":2,"color":"blue","size":10,"weight":1,"k":2}]`, nil},
 		{"With limit then offset", "SELECT * FROM test WHERE size = 10 LIMIT 1 OFFSET 1", false, `[{"k":2,"color":"blue","size":10,"weight":1,"k":2}]`, nil},
@@ -50,9 +58,60 @@ func TestSelectStmt(t *testing.T) {
 		{"With key()", "SELECT key(), color FROM test", false, `[{"k":1,"color":"red"},{"k":2,"color":"blue"},{"k":3,"color":null}]`, []interface{}{sql.Named("a", "red"), sql.Named("d", 100)}},
 		{"With pk in cond, gt", "SELECT * FROM test WHERE k > 0 AND weight = 1", false, `[{"k":2,"color":"blue","size":10,"weight":1,"k":2}]`, nil},
 		{"With pk in cond, =", "SELECT * FROM test WHERE k = 2.0 AND weight = 1", false, `[{"k":2,"color":"blue","size":10,"weight":1,"k":2}]`, nil},
+		{"With pk in cond, = non integer", "SELECT k FROM test WHERE k = 2.5", false, `[]`, nil},
+		{"With range", "SELECT k FROM test WHERE size >= 5 AND size < 15", false, `[{"k":1},{"k":2}]`, nil},
+		{"With range and reversed comparisons", "SELECT k FROM test WHERE 150 > height AND 100 <= height", false, `[{"k":3}]`, nil},
+		{"With exclusive range", "SELECT k FROM test WHERE size > 10 AND size < 15", false, `[]`, nil},
+		{"With range and order by desc", "SELECT k FROM test WHERE color > 'a' AND color < 'z' ORDER BY color DESC", false, `[{"k":1},{"k":2}]`, nil},
+		{"With range on another field", "SELECT k FROM test WHERE color < 'z' AND size > 5 ORDER BY k DESC", false, `[{"k":2},{"k":1}]`, nil},
+		{"With pk range", "SELECT k FROM test WHERE k > 1 AND k <= 3", false, `[{"k":2},{"k":3}]`, nil},
+		{"With pk range and order by desc", "SELECT k FROM test WHERE k >= 1 AND k < 3 ORDER BY k DESC", false, `[{"k":2},{"k":1}]`, nil},
+		{"With pk range beyond the type of the key", "SELECT k FROM test WHERE k >= 2 AND k < 100000000000000000000.0", false, `[{"k":2},{"k":3}]`, nil},
+		{"With OR on indexed fields", "SELECT k FROM test WHERE size = 10 OR color = 'red' ORDER BY k", false, `[{"k":1},{"k":2}]`, nil},
+		{"With OR on pk and indexed field", "SELECT k FROM test WHERE k = 3 OR color = 'blue' ORDER BY k", false, `[{"k":2},{"k":3}]`, nil},
+		{"With OR on non indexed field", "SELECT k FROM test WHERE weight = 20 OR color = 'red' ORDER BY k", false, `[{"k":1},{"k":3}]`, nil},
+		{"With OR and AND", "SELECT k FROM test WHERE (size = 10 AND color = 'blue') OR height > 50 ORDER BY k", false, `[{"k":2},{"k":3}]`, nil},
+		{"With AND and index on the right side", "SELECT k FROM test WHERE weight = 1 AND size = 10", false, `[{"k":2}]`, nil},
+		{"With AND on two indexed fields", "SELECT k FROM test WHERE size = 10 AND color = 'red'", false, `[{"k":1}]`, nil},
 		{"With two non existing idents, =", "SELECT * FROM test WHERE z = y", false, `[]`, nil},
 		{"With two non existing idents, >", "SELECT * FROM test WHERE z > y", false, `[]`, nil},
-		{"With two non existing idents, !=", "SELECT * FROM test WHERE z != y", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1},{"k":3,"height":100,"weight":20}]`, nil},
+		{"With two non existing idents, !=", "SELECT * FROM test WHERE z != y", false, `[]`, nil},
+		{"With regex", "SELECT * FROM test WHERE color =~ /^r.d$/", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With not regex", "SELECT * FROM test WHERE color !~ /^r.d$/", false, `[{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
+		{"With regex on non-text values", "SELECT * FROM test WHERE size =~ /10/", false, `[]`, nil},
+		{"With IN", "SELECT * FROM test WHERE color IN ('red', 'purple', 'red')", false, `[{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With IN and one value", "SELECT * FROM test WHERE size IN (10)", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
+		{"With IN on pk", "SELECT * FROM test WHERE k IN (3, 1, 3.0, 4)", false, `[{"k":3,"height":100,"weight":20},{"k":1,"color":"red","size":10,"shape":"square"}]`, nil},
+		{"With IN on pk and order by", "SELECT * FROM test WHERE k IN [3, 1] ORDER BY k", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":3,"height":100,"weight":20}]`, nil},
+		{"With IN and param", "SELECT * FROM test WHERE color IN ? ORDER BY k", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, []interface{}{[]string{"blue", "red"}}},
+		{"With IN and named param", "SELECT * FROM test WHERE height IN $h", false, `[{"k":3,"height":100,"weight":20}]`, []interface{}{sql.Named("h", []int{100, 200})}},
+		{"With NOT IN", "SELECT * FROM test WHERE color NOT IN ('red', 'purple')", false, `[{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
+		{"With NOT IN on pk", "SELECT * FROM test WHERE k NOT IN (1, 2)", false, `[{"k":3,"height":100,"weight":20}]`, nil},
+		{"With arithmetic operators", "SELECT * FROM test WHERE size * 2 + 1 = 21", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
+		{"With arithmetic operators and parentheses", "SELECT * FROM test WHERE (height - weight) / 2 = 40", false, `[{"k":3,"height":100,"weight":20}]`, nil},
+		{"With bitwise operators", "SELECT * FROM test WHERE k & 1 = 1", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":3,"height":100,"weight":20}]`, nil},
+		{"With arithmetic operators and float", "SELECT * FROM test WHERE k / 2.0 = 1.5", false, `[{"k":3,"height":100,"weight":20}]`, nil},
+		{"With cast", "SELECT * FROM test WHERE size::TEXT = '10'", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
+		{"With CAST", "SELECT * FROM test WHERE CAST(k AS FLOAT64) / 2 = 1.5", false, `[{"k":3,"height":100,"weight":20}]`, nil},
+		{"With aliases", "SELECT color AS c, size * 2 AS double, {k: k, s: size} AS pair FROM test", false, `[{"c":"red","double":20,"pair":{"k":1,"s":10}},{"c":"blue","double":20,"pair":{"k":2,"s":10}},{"c":null,"double":null,"pair":null}]`, nil},
+		{"With computed fields", "SELECT k + 1, color = 'red', size FROM test", false, `[{"k + 1":2,"color = \"red\"":true,"size":10},{"k + 1":3,"color = \"red\"":false,"size":10},{"k + 1":4,"color = \"red\"":null,"size":null}]`, nil},
+		{"With same alias as a field", "SELECT size + 1 AS size, size AS original FROM test WHERE k = 1", false, `[{"size":11,"original":10}]`, nil},
+		{"With alias and param", "SELECT k * ? AS x FROM test WHERE k = 1", false, `[{"x":10}]`, []interface{}{10}},
+		{"With casts in projection", "SELECT k::TEXT, CAST(size AS FLOAT64), CAST(k::TEXT AS INT8) FROM test", false, `[{"CAST(k AS STRING)":"1","CAST(size AS FLOAT64)":10.0,"CAST(CAST(k AS STRING) AS INT8)":1},{"CAST(k AS STRING)":"2","CAST(size AS FLOAT64)":10.0,"CAST(CAST(k AS STRING) AS INT8)":2},{"CAST(k AS STRING)":"3","CAST(size AS FLOAT64)":null,"CAST(CAST(k AS STRING) AS INT8)":3}]`, nil},
+		{"With cast of a param", "SELECT * FROM test WHERE k = ?::INT64", false, `[{"k":2,"color":"blue","size":10,"weight":1}]`, []interface{}{"2"}},
+		{"With distinct", "SELECT DISTINCT size FROM test", false, `[{"size":10},{"size":null}]`, nil},
+		{"With distinct and multiple fields", "SELECT DISTINCT size, weight FROM test", false, `[{"size":10,"weight":null},{"size":10,"weight":1},{"size":null,"weight":20}]`, nil},
+		{"With distinct and order by", "SELECT DISTINCT size FROM test ORDER BY size DESC", false, `[{"size":10},{"size":null}]`, nil},
+		{"With distinct and limit offset", "SELECT DISTINCT size FROM test ORDER BY k LIMIT 1 OFFSET 1", false, `[{"size":null}]`, nil},
+		{"With order by alias", "SELECT k, color AS c FROM test ORDER BY c", false, `[{"k":3,"c":null},{"k":2,"c":"blue"},{"k":1,"c":"red"}]`, nil},
+		{"With order by alias of expression", "SELECT k + 1 AS c FROM test ORDER BY c", true, ``, nil},
+		{"With qualified fields", "SELECT test.color FROM test WHERE test.size = 10 ORDER BY test.k DESC", false, `[{"test.color":"blue"},{"test.color":"red"}]`, nil},
+		{"With table alias", "SELECT color, x.size FROM test AS x WHERE x.k = 1", false, `[{"color":"red","x.size":10}]`, nil},
+		{"With table name instead of alias", "SELECT test.color FROM test AS x", true, ``, nil},
+		{"With parentheses in projection", "SELECT (k + 1) AS x, (size) FROM test WHERE k = 1", false, `[{"x":2,"size":10}]`, nil},
+		{"With parentheses in cond", "SELECT k FROM test WHERE (k = 2)", false, `[{"k":2}]`, nil},
+		{"With parentheses in cond on indexed field", "SELECT k FROM test WHERE ((color = 'blue'))", false, `[{"k":2}]`, nil},
+		{"With distinct and wildcard", "SELECT DISTINCT * FROM test WHERE size = 10", false, `[{"k":1,"color":"red","size":10,"shape":"square"},{"k":2,"color":"blue","size":10,"weight":1}]`, nil},
 	}
 
 	for _, test := range tests {
@@ -157,6 +216,455 @@ func TestSelectStmt(t *testing.T) {
 		call("SELECT a.2.1 FROM test", `{"a.2.1": null}`, `{"a.2.1": null}`, `{"a.2.1": 9}`)
 	})
 
+	t.Run("with null values and missing fields", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`CREATE TABLE test;
+			INSERT INTO test (id, a) VALUES (1, 1);
+			INSERT INTO test (id, a) VALUES (2, NULL);
+			INSERT INTO test (id) VALUES (3);
+			INSERT INTO test (id, a) VALUES (4, false);
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			expected string
+		}{
+			{"SELECT id FROM test WHERE a IS NULL", `[{"id":2},{"id":3}]`},
+			{"SELECT id FROM test WHERE a IS NOT NULL", `[{"id":1},{"id":4}]`},
+			{"SELECT id FROM test WHERE a = NULL", `[]`},
+			{"SELECT id FROM test WHERE a != NULL", `[]`},
+			{"SELECT id FROM test WHERE a != 1", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE a < 2", `[{"id":1},{"id":4}]`},
+			{"SELECT id FROM test WHERE a IS 1", `[{"id":1}]`},
+			{"SELECT id FROM test WHERE a IS NOT 1", `[{"id":2},{"id":3},{"id":4}]`},
+			{"SELECT id FROM test WHERE a", `[{"id":1}]`},
+			{"SELECT id FROM test WHERE NOT a", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE NOT a = 1", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE NOT (a = 1 OR id = 2)", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE a OR id > 2", `[{"id":1},{"id":3},{"id":4}]`},
+			{"SELECT id FROM test WHERE NOT (a AND id > 0)", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE NOT (a OR id = 4)", `[]`},
+			{"SELECT id FROM test WHERE NOT a IN (1)", `[{"id":4}]`},
+			{"SELECT id FROM test WHERE a NOT IN (2)", `[{"id":1},{"id":4}]`},
+			{"SELECT id FROM test WHERE a NOT IN (2, NULL)", `[]`},
+			{"SELECT id FROM test WHERE a IN (1, NULL)", `[{"id":1}]`},
+			{"SELECT id FROM test WHERE a !~ /x/", `[{"id":1},{"id":4}]`},
+			{"SELECT id FROM test WHERE NOT a =~ /x/", `[{"id":1},{"id":4}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				st, err := db.Query(test.query)
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("with evaluation errors", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test; INSERT INTO test (a, b) VALUES (1, 'foo')")
+		require.NoError(t, err)
+
+		tests := []string{
+			"SELECT * FROM test WHERE a / 0 = 1",
+			"SELECT * FROM test WHERE a % 0 = 1",
+			"SELECT * FROM test WHERE b + 1 = 1",
+			"SELECT * FROM test WHERE a * 9223372036854775807 * 2 > 0",
+			"SELECT * FROM test WHERE a & 1.5 = 1",
+			"SELECT * FROM test WHERE a IN 1",
+			"SELECT * FROM test WHERE b::INT64 = 1",
+			"SELECT * FROM test WHERE CAST(a * 300 AS INT8) > 0",
+			"SELECT b::BOOL FROM test",
+		}
+
+		for _, q := range tests {
+			t.Run(q, func(t *testing.T) {
+				st, err := db.Query(q)
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("with group by", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+
+		err = db.Exec(`INSERT INTO test VALUES
+			{a: 1, b: {c: 'x'}, n: 10},
+			{a: 1.0, b: {c: 'y'}, n: 5.5},
+			{a: 2, b: {c: 'x'}},
+			{b: {c: 'x'}, n: 'foo'}`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			name     string
+			query    string
+			expected string
+		}{
+			{"aggregates", "SELECT a, COUNT(*), COUNT(n), SUM(n), AVG(n), MIN(n), MAX(n) FROM test GROUP BY a",
+				`[{"a":1,"COUNT(*)":2,"COUNT(n)":2,"SUM(n)":15.5,"AVG(n)":7.75,"MIN(n)":5.5,"MAX(n)":10},
+				  {"a":2,"COUNT(*)":1,"COUNT(n)":0,"SUM(n)":null,"AVG(n)":null,"MIN(n)":null,"MAX(n)":null},
+				  {"a":null,"COUNT(*)":1,"COUNT(n)":1,"SUM(n)":null,"AVG(n)":null,"MIN(n)":"foo","MAX(n)":"foo"}]`},
+			{"nested path", "SELECT b.c, COUNT(*) FROM test GROUP BY b.c", `[{"b.c":"x","COUNT(*)":3},{"b.c":"y","COUNT(*)":1}]`},
+			{"having", "SELECT b.c FROM test GROUP BY b.c HAVING COUNT(*) > 1", `[{"b.c":"x"}]`},
+			{"with where", "SELECT b.c, SUM(n) FROM test WHERE n > 6 GROUP BY b.c", `[{"b.c":"x","SUM(n)":10}]`},
+			{"no group by", "SELECT COUNT(*), SUM(a), MAX(b.c) FROM test", `[{"COUNT(*)":4,"SUM(a)":4,"MAX(b.c)":"y"}]`},
+			{"no group by, no document", "SELECT COUNT(*), SUM(a) FROM test WHERE a > 10", `[{"COUNT(*)":0,"SUM(a)":null}]`},
+			{"group by, no document", "SELECT COUNT(*) FROM test WHERE a > 10 GROUP BY a", `[]`},
+			{"order by and limit", "SELECT b.c, COUNT(*) FROM test GROUP BY b.c ORDER BY b.c DESC LIMIT 1", `[{"b.c":"y","COUNT(*)":1}]`},
+			{"aliases", "SELECT b.c AS c, COUNT(*) AS total, COUNT(*) * 10 + 1 AS computed FROM test GROUP BY b.c", `[{"c":"x","total":3,"computed":31},{"c":"y","total":1,"computed":11}]`},
+			{"expression without alias", "SELECT COUNT(*) + 1 FROM test", `[{"COUNT(*) + 1":5}]`},
+			{"order by alias of aggregate", "SELECT b.c AS c, COUNT(*) AS total FROM test GROUP BY b.c ORDER BY total", `[{"c":"y","total":1},{"c":"x","total":3}]`},
+			{"order by aggregate", "SELECT b.c FROM test GROUP BY b.c ORDER BY COUNT(*), b.c DESC", `[{"b.c":"y"},{"b.c":"x"}]`},
+			{"order by aggregate desc", "SELECT a, SUM(n) AS total FROM test GROUP BY a ORDER BY MAX(n) DESC", `[{"a":null,"total":null},{"a":1,"total":15.5},{"a":2,"total":null}]`},
+			{"sub-field of grouped field", "SELECT b.c, COUNT(*) FROM test GROUP BY b", `[{"b.c":"x","COUNT(*)":3},{"b.c":"y","COUNT(*)":1}]`},
+			{"order by alias of grouped field", "SELECT b.c AS c, COUNT(*) AS total FROM test GROUP BY b.c ORDER BY c DESC", `[{"c":"y","total":1},{"c":"x","total":3}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				st, err := db.Query(test.query)
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+
+		t.Run("aggregate in where clause", func(t *testing.T) {
+			err := db.Exec("SELECT * FROM test WHERE COUNT(*) > 1")
+			require.Error(t, err)
+		})
+
+		t.Run("wildcard", func(t *testing.T) {
+			queries := []string{
+				"SELECT * FROM test GROUP BY a",
+				"SELECT *, COUNT(*) FROM test",
+			}
+
+			for _, q := range queries {
+				err := db.Exec(q)
+				require.Error(t, err, q)
+			}
+		})
+
+		t.Run("field neither grouped nor aggregated", func(t *testing.T) {
+			queries := []string{
+				"SELECT n, COUNT(*) FROM test GROUP BY a",
+				"SELECT n, COUNT(*) FROM test",
+				"SELECT b, COUNT(*) FROM test GROUP BY b.c",
+				"SELECT a FROM test GROUP BY a HAVING n > 1",
+				"SELECT a FROM test GROUP BY a ORDER BY n",
+				"SELECT a FROM test ORDER BY COUNT(*)",
+				"SELECT a + n AS x FROM test GROUP BY a",
+			}
+
+			for _, q := range queries {
+				err := db.Exec(q)
+				require.Error(t, err, q)
+			}
+		})
+	})
+
+	t.Run("with distinct on nested values", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+
+		err = db.Exec(`INSERT INTO test VALUES
+			{a: 1, b: {x: 1, y: 'foo'}, c: [1, 2]},
+			{a: 1.0, b: {y: 'foo', x: 1.0}, c: [1.0, 2]},
+			{a: true, b: {x: 1, y: 'foo', z: null}, c: [2, 1]},
+			{a: 1, b: {x: 1, y: 'foo'}, c: [1, [2]]},
+			{a: 1, b: {x: 1, y: 'foo'}, c: [1, [2.0]]}`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			expected string
+		}{
+			{"SELECT DISTINCT a FROM test", `[{"a":1},{"a":true}]`},
+			{"SELECT DISTINCT b FROM test", `[{"b":{"x":1,"y":"foo"}},{"b":{"x":1,"y":"foo","z":null}}]`},
+			{"SELECT DISTINCT c FROM test", `[{"c":[1,2]},{"c":[2,1]},{"c":[1,[2]]}]`},
+			{"SELECT DISTINCT a, b, c FROM test", `[{"a":1,"b":{"x":1,"y":"foo"},"c":[1,2]},{"a":true,"b":{"x":1,"y":"foo","z":null},"c":[2,1]},{"a":1,"b":{"x":1,"y":"foo"},"c":[1,[2]]}]`},
+			{"SELECT DISTINCT b.x FROM test", `[{"b.x":1}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				st, err := db.Query(test.query)
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("with order by on mixed types", func(t *testing.T) {
+		for _, withIndex := range []bool{false, true} {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec("CREATE TABLE test")
+			require.NoError(t, err)
+			if withIndex {
+				err = db.Exec("CREATE INDEX idx_a ON test (a)")
+				require.NoError(t, err)
+			}
+
+			err = db.Exec(`INSERT INTO test VALUES {a: 2, b: 1}, {a: 1.5, b: 2}, {a: 'x', b: 3}, {a: 1, b: 4}, {b: 5}, {a: null, b: 6}, {a: true, b: 7}, {a: 1.0, b: 8}`)
+			require.NoError(t, err)
+
+			tests := []struct {
+				query    string
+				expected string
+			}{
+				{"SELECT b FROM test ORDER BY a", `[{"b":5},{"b":6},{"b":7},{"b":4},{"b":8},{"b":2},{"b":1},{"b":3}]`},
+				{"SELECT b FROM test ORDER BY a DESC, b", `[{"b":3},{"b":1},{"b":2},{"b":4},{"b":8},{"b":7},{"b":5},{"b":6}]`},
+				{"SELECT b FROM test ORDER BY a DESC, b DESC", `[{"b":3},{"b":1},{"b":2},{"b":8},{"b":4},{"b":7},{"b":6},{"b":5}]`},
+				{"SELECT b FROM test ORDER BY a NULLS LAST, b DESC LIMIT 4", `[{"b":7},{"b":8},{"b":4},{"b":2}]`},
+			}
+
+			for _, test := range tests {
+				t.Run(fmt.Sprintf("%s/index:%v", test.query, withIndex), func(t *testing.T) {
+					st, err := db.Query(test.query)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = document.IteratorToJSONArray(&buf, st)
+					require.NoError(t, err)
+					require.JSONEq(t, test.expected, buf.String())
+				})
+			}
+		}
+	})
+
+	t.Run("with index ranges", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test (a);
+			INSERT INTO test VALUES {id: 1, a: 2}, {id: 2, a: 1}, {id: 3, a: 2}, {id: 4, a: 3}, {id: 5, a: 4}, {id: 6, a: 'b'};
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			expected string
+		}{
+			{"SELECT id FROM test WHERE a >= 2 AND a < 4", `[{"id":1},{"id":3},{"id":4}]`},
+			{"SELECT id FROM test WHERE a > 1 AND a <= 3 ORDER BY a DESC", `[{"id":4},{"id":3},{"id":1}]`},
+			{"SELECT id FROM test WHERE 3 > a ORDER BY a DESC", `[{"id":3},{"id":1},{"id":2}]`},
+			{"SELECT id FROM test WHERE a > 3 AND a < 'z'", `[]`},
+		}
+
+		for _, test := range tests {
+			d, err := db.QueryDocument("EXPLAIN " + test.query)
+			require.NoError(t, err)
+			v, err := document.ValuePath{"access", "index"}.GetValue(d)
+			require.NoError(t, err)
+			require.Equal(t, document.NewStringValue("idx_test_a"), v, test.query)
+
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String(), test.query)
+		}
+	})
+
+	t.Run("with index unions and intersections", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test (a);
+			CREATE INDEX idx_test_b ON test (b);
+			INSERT INTO test VALUES {id: 1, a: 1, b: 1}, {id: 2, a: 1, b: 2}, {id: 3, a: 2, b: 1}, {id: 4, a: 3, b: 3};
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			access   string
+			expected string
+		}{
+			{"SELECT id FROM test WHERE a = 1 OR b = 1 ORDER BY id", "union", `[{"id":1},{"id":2},{"id":3}]`},
+			{"SELECT id FROM test WHERE a > 1 OR b = 2 OR a = 2 ORDER BY id", "union", `[{"id":2},{"id":3},{"id":4}]`},
+			{"SELECT id FROM test WHERE a = 1 OR c = 1 ORDER BY id", "table scan", `[{"id":1},{"id":2}]`},
+			{"SELECT id FROM test WHERE a = 1 AND b = 1", "intersection", `[{"id":1}]`},
+			{"SELECT id FROM test WHERE b = 1 AND a = 2 AND id > 0", "intersection", `[{"id":3}]`},
+			{"SELECT id FROM test WHERE id >= 1 AND a = 2", "index iterator", `[{"id":3}]`},
+		}
+
+		for _, test := range tests {
+			d, err := db.QueryDocument("EXPLAIN " + test.query)
+			require.NoError(t, err)
+			v, err := document.ValuePath{"access", "type"}.GetValue(d)
+			require.NoError(t, err)
+			require.Equal(t, document.NewStringValue(test.access), v, test.query)
+
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String(), test.query)
+		}
+	})
+
+	t.Run("with large integers", func(t *testing.T) {
+		for _, withIndex := range []bool{false, true} {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec("CREATE TABLE test")
+			require.NoError(t, err)
+			if withIndex {
+				err = db.Exec("CREATE UNIQUE INDEX idx_a ON test (a)")
+				require.NoError(t, err)
+			}
+
+			// integers above 2^53 can't be represented exactly by a float64
+			err = db.Exec(`INSERT INTO test VALUES {a: 1152921504606846978, b: 2}, {a: 1152921504606846977, b: 1}, {a: 1152921504606846979, b: 3}, {a: 1152921504606846976.0, b: 0}`)
+			require.NoError(t, err)
+
+			tests := []struct {
+				query    string
+				expected string
+			}{
+				{"SELECT b FROM test WHERE a = 1152921504606846978", `[{"b":2}]`},
+				{"SELECT b FROM test WHERE a > 1152921504606846977", `[{"b":2},{"b":3}]`},
+				{"SELECT b FROM test WHERE a <= 1152921504606846977 ORDER BY a", `[{"b":0},{"b":1}]`},
+				{"SELECT b FROM test ORDER BY a DESC", `[{"b":3},{"b":2},{"b":1},{"b":0}]`},
+			}
+
+			for _, test := range tests {
+				t.Run(fmt.Sprintf("%s/index:%v", test.query, withIndex), func(t *testing.T) {
+					st, err := db.Query(test.query)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = document.IteratorToJSONArray(&buf, st)
+					require.NoError(t, err)
+					require.JSONEq(t, test.expected, buf.String())
+				})
+			}
+		}
+	})
+
+	t.Run("with sort memory limit", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		dir, err := ioutil.TempDir("", "genji")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		// every few documents are written to a temporary file
+		db.DB.SortMemoryLimit = 1000
+		db.DB.SortTempDir = dir
+
+		err = db.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			// a is missing for some documents, and has the same value for others
+			if i%10 == 0 {
+				err = db.Exec("INSERT INTO test (id) VALUES (?)", i)
+			} else {
+				err = db.Exec("INSERT INTO test (id, a) VALUES (?, ?)", i, (i*37)%50)
+			}
+			require.NoError(t, err)
+		}
+
+		tests := []string{
+			"SELECT id, a FROM test ORDER BY a",
+			"SELECT id, a FROM test ORDER BY a DESC",
+			"SELECT id, a FROM test ORDER BY a NULLS LAST, id DESC",
+			"SELECT id, a FROM test ORDER BY a LIMIT 15 OFFSET 5",
+		}
+
+		for _, test := range tests {
+			t.Run(test, func(t *testing.T) {
+				query := func(limit int) string {
+					db.DB.SortMemoryLimit = limit
+					st, err := db.Query(test)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = st.Iterate(func(d document.Document) error {
+						// the runs are written to files until all the documents are returned
+						if limit > 0 {
+							files, err := ioutil.ReadDir(dir)
+							require.NoError(t, err)
+							require.NotEmpty(t, files)
+						}
+
+						return document.ToJSON(&buf, d)
+					})
+					require.NoError(t, err)
+					return buf.String()
+				}
+
+				// sorting with temporary files returns the same documents as sorting in memory,
+				// in the same order
+				require.Equal(t, query(0), query(1000))
+
+				files, err := ioutil.ReadDir(dir)
+				require.NoError(t, err)
+				require.Empty(t, files)
+			})
+		}
+	})
+
 	t.Run("table not found", func(t *testing.T) {
 		db, err := genji.New(memoryengine.NewEngine())
 		require.NoError(t, err)
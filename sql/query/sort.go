@@ -0,0 +1,561 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+	"github.com/asdine/genji/index"
+	"github.com/asdine/genji/sql/scanner"
+)
+
+// sortKey is an ORDER BY field used to compare documents.
+type sortKey struct {
+	path       document.ValuePath
+	desc       bool
+	nullsFirst bool
+}
+
+func newSortKeys(orderBy []OrderByField) []sortKey {
+	keys := make([]sortKey, len(orderBy))
+	for i, f := range orderBy {
+		keys[i] = sortKey{
+			path: document.ValuePath(f.Path),
+			desc: f.Direction == scanner.DESC,
+		}
+
+		switch f.Nulls {
+		case NullsFirst:
+			keys[i].nullsFirst = true
+		case NullsDefault:
+			keys[i].nullsFirst = !keys[i].desc
+		}
+	}
+
+	return keys
+}
+
+// sortNode is a document and the encoded values of its sort keys.
+// A nil value represents NULL or a field that doesn't exist.
+type sortNode struct {
+	values [][]byte
+	data   []byte
+	// position of the document in the iterator, used to keep the sort stable.
+	seq int
+}
+
+// size returns the approximate memory used by the node.
+func (n *sortNode) size() int {
+	size := len(n.data) + 64
+	for _, v := range n.values {
+		size += len(v) + 24
+	}
+
+	return size
+}
+
+func newSortNode(keys []sortKey, d document.Document, seq int) (sortNode, error) {
+	n := sortNode{
+		values: make([][]byte, len(keys)),
+		seq:    seq,
+	}
+
+	for i, k := range keys {
+		v, err := k.path.GetValue(d)
+		if err == document.ErrFieldNotFound {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		n.values[i], err = encodeSortValue(v)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	var err error
+	n.data, err = encoding.EncodeDocument(d)
+	return n, err
+}
+
+// encodeSortValue encodes v the same way indexes do, so that documents are
+// sorted in the same order whether an index is used or not: values are ordered by type
+// first, and numbers of all types are compared by value.
+// It returns nil for NULL values.
+func encodeSortValue(v document.Value) ([]byte, error) {
+	switch v.Type {
+	case document.NullValue:
+		return nil, nil
+	case document.DocumentValue, document.ArrayValue:
+	default:
+		return index.EncodeTuple([]document.Value{v})
+	}
+
+	data, err := encoding.EncodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{byte(index.NewTypeFromValueType(v.Type))}, data...), nil
+}
+
+// compareSortKey compares the values of the i-th sort key of a and b.
+func compareSortKey(k sortKey, a, b []byte) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		if k.nullsFirst {
+			return -1
+		}
+		return 1
+	case b == nil:
+		if k.nullsFirst {
+			return 1
+		}
+		return -1
+	}
+
+	c := bytes.Compare(a, b)
+	if k.desc {
+		return -c
+	}
+	return c
+}
+
+// lessSortNodes reports whether a must be returned before b.
+func lessSortNodes(keys []sortKey, a, b *sortNode) bool {
+	for i, k := range keys {
+		if c := compareSortKey(k, a.values[i], b.values[i]); c != 0 {
+			return c < 0
+		}
+	}
+
+	return a.seq < b.seq
+}
+
+// sortIterator operates a partial sort on the iterator using a heap.
+// This ensures a O(n+klog n) time complexity
+// with k being the limit of the query, or the sum of the limit + offset, when both offset and limit are used.
+// if there are no limit or offsets, k = n, the number of elements in the table.
+// Once the heap is filled entirely with the content of the table, the iterator
+// pops the k first elements, following the order of the sort keys.
+// If the documents read exceed memoryLimit, they are sorted and written to a temporary file,
+// as a sorted run of at most k documents, and the documents read afterwards are buffered again.
+// The runs are then merged, reading one document of each run at a time.
+type sortIterator struct {
+	it   document.Iterator
+	keys []sortKey
+	k    int
+	// memoryLimit is the size of the buffered documents above which they are written to a temporary file
+	// in tempDir. There is no limit if it is zero or negative.
+	memoryLimit int
+	tempDir     string
+}
+
+func (qo *queryOptimizer) sortIterator(it document.Iterator) document.Stream {
+	k := 0
+	if qo.limit != -1 {
+		k += qo.limit
+		if qo.offset != -1 {
+			k += qo.offset
+		}
+	}
+
+	return document.NewStream(sortIterator{
+		it:          it,
+		keys:        newSortKeys(qo.orderBy),
+		k:           k,
+		memoryLimit: qo.tx.DB().SortMemoryLimit,
+		tempDir:     qo.tx.DB().SortTempDir,
+	})
+}
+
+func (s sortIterator) Iterate(fn func(d document.Document) error) error {
+	h := sortHeap{keys: s.keys}
+	var size int
+
+	var runs []*sortRun
+	defer func() {
+		for _, r := range runs {
+			r.Close()
+		}
+	}()
+
+	var seq int
+	err := s.it.Iterate(func(d document.Document) error {
+		n, err := newSortNode(s.keys, d, seq)
+		if err != nil {
+			return err
+		}
+		seq++
+
+		h.nodes = append(h.nodes, n)
+		size += n.size()
+		if s.memoryLimit <= 0 || size <= s.memoryLimit {
+			return nil
+		}
+
+		r, err := s.writeRun(h.nodes)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, r)
+
+		// release the documents written to the run and reuse the buffer
+		for i := range h.nodes {
+			h.nodes[i] = sortNode{}
+		}
+		h.nodes = h.nodes[:0]
+		size = 0
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(runs) == 0 {
+		heap.Init(&h)
+
+		for i := 0; h.Len() > 0 && (s.k == 0 || i < s.k); i++ {
+			err := fn(encoding.EncodedDocument(heap.Pop(&h).(sortNode).data))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// the documents left in memory are merged with the runs
+	sortNodes(s.keys, h.nodes)
+	nodes := h.nodes
+	cursors := []func() (sortNode, bool, error){
+		func() (sortNode, bool, error) {
+			if len(nodes) == 0 {
+				return sortNode{}, false, nil
+			}
+
+			n := nodes[0]
+			nodes = nodes[1:]
+			return n, true, nil
+		},
+	}
+	for _, r := range runs {
+		cursors = append(cursors, r.next)
+	}
+
+	return mergeSortRuns(s.keys, s.k, cursors, fn)
+}
+
+// writeRun sorts the nodes and writes the first k of them to a temporary file.
+func (s sortIterator) writeRun(nodes []sortNode) (*sortRun, error) {
+	sortNodes(s.keys, nodes)
+	if s.k > 0 && len(nodes) > s.k {
+		nodes = nodes[:s.k]
+	}
+
+	r, err := newSortRun(s.tempDir, len(s.keys))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range nodes {
+		err = r.write(&nodes[i])
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	err = r.rewind()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func sortNodes(keys []sortKey, nodes []sortNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return lessSortNodes(keys, &nodes[i], &nodes[j])
+	})
+}
+
+// mergeSortRuns calls fn with the documents of sorted runs, in order, until k documents are returned
+// or, if k is zero, until all the runs are read. Each cursor returns the next node of a run,
+// or false when the run is over.
+func mergeSortRuns(keys []sortKey, k int, cursors []func() (sortNode, bool, error), fn func(d document.Document) error) error {
+	h := mergeHeap{keys: keys}
+
+	for _, next := range cursors {
+		n, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.cursors = append(h.cursors, mergeCursor{node: n, next: next})
+		}
+	}
+
+	heap.Init(&h)
+
+	for i := 0; h.Len() > 0 && (k == 0 || i < k); i++ {
+		c := &h.cursors[0]
+		err := fn(encoding.EncodedDocument(c.node.data))
+		if err != nil {
+			return err
+		}
+
+		n, ok, err := c.next()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			c.node = n
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+
+	return nil
+}
+
+// mergeCursor is the current node of a sorted run and the function returning its next node.
+type mergeCursor struct {
+	node sortNode
+	next func() (sortNode, bool, error)
+}
+
+type mergeHeap struct {
+	keys    []sortKey
+	cursors []mergeCursor
+}
+
+func (h mergeHeap) Len() int { return len(h.cursors) }
+func (h mergeHeap) Less(i, j int) bool {
+	return lessSortNodes(h.keys, &h.cursors[i].node, &h.cursors[j].node)
+}
+func (h mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x interface{}) {
+	h.cursors = append(h.cursors, x.(mergeCursor))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	old := h.cursors
+	n := len(old)
+	x := old[n-1]
+	h.cursors = old[0 : n-1]
+	return x
+}
+
+// sortRun is a temporary file containing sorted nodes.
+// Each node is written as its position, the values of its sort keys and its document,
+// each value being prefixed by its length plus one, or zero for NULL values.
+type sortRun struct {
+	f     *os.File
+	w     *bufio.Writer
+	r     *bufio.Reader
+	nkeys int
+}
+
+func newSortRun(dir string, nkeys int) (*sortRun, error) {
+	f, err := ioutil.TempFile(dir, "genji-sort-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sortRun{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		nkeys: nkeys,
+	}, nil
+}
+
+func (r *sortRun) write(n *sortNode) error {
+	var buf [binary.MaxVarintLen64]byte
+
+	_, err := r.w.Write(buf[:binary.PutUvarint(buf[:], uint64(n.seq))])
+	if err != nil {
+		return err
+	}
+
+	for _, v := range n.values {
+		err = r.writeBytes(v, v == nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.writeBytes(n.data, false)
+}
+
+func (r *sortRun) writeBytes(data []byte, null bool) error {
+	var buf [binary.MaxVarintLen64]byte
+
+	l := uint64(len(data)) + 1
+	if null {
+		l = 0
+	}
+
+	_, err := r.w.Write(buf[:binary.PutUvarint(buf[:], l)])
+	if err != nil {
+		return err
+	}
+
+	_, err = r.w.Write(data)
+	return err
+}
+
+// rewind flushes the written nodes and prepares the file for reading.
+func (r *sortRun) rewind() error {
+	err := r.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	r.r = bufio.NewReader(r.f)
+	return nil
+}
+
+// next reads the next node of the run. It returns false if all the nodes have been read.
+func (r *sortRun) next() (sortNode, bool, error) {
+	n := sortNode{
+		values: make([][]byte, r.nkeys),
+	}
+
+	seq, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return n, false, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	n.seq = int(seq)
+
+	for i := range n.values {
+		n.values[i], err = r.readBytes()
+		if err != nil {
+			return n, false, err
+		}
+	}
+
+	n.data, err = r.readBytes()
+	if err != nil {
+		return n, false, err
+	}
+
+	return n, true, nil
+}
+
+func (r *sortRun) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if l == 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, l-1)
+	_, err = io.ReadFull(r.r, data)
+	return data, err
+}
+
+// Close closes and removes the file.
+func (r *sortRun) Close() error {
+	err := r.f.Close()
+	if rerr := os.Remove(r.f.Name()); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+type sortHeap struct {
+	keys  []sortKey
+	nodes []sortNode
+}
+
+func (h sortHeap) Len() int           { return len(h.nodes) }
+func (h sortHeap) Less(i, j int) bool { return lessSortNodes(h.keys, &h.nodes[i], &h.nodes[j]) }
+func (h sortHeap) Swap(i, j int)      { h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i] }
+
+func (h *sortHeap) Push(x interface{}) {
+	h.nodes = append(h.nodes, x.(sortNode))
+}
+
+func (h *sortHeap) Pop() interface{} {
+	old := h.nodes
+	n := len(old)
+	x := old[n-1]
+	h.nodes = old[0 : n-1]
+	return x
+}
+
+// runSortIterator sorts documents that are already sorted by the first sort key,
+// for example when they are read from an index.
+// It only buffers and sorts the consecutive documents that have the same value
+// for the first key, instead of the entire table.
+type runSortIterator struct {
+	it   document.Iterator
+	keys []sortKey
+}
+
+func (s runSortIterator) Iterate(fn func(d document.Document) error) error {
+	var run []sortNode
+
+	flush := func() error {
+		sortNodes(s.keys, run)
+
+		for _, n := range run {
+			if err := fn(encoding.EncodedDocument(n.data)); err != nil {
+				return err
+			}
+		}
+
+		run = run[:0]
+		return nil
+	}
+
+	var seq int
+	err := s.it.Iterate(func(d document.Document) error {
+		n, err := newSortNode(s.keys, d, seq)
+		if err != nil {
+			return err
+		}
+		seq++
+
+		if len(run) > 0 && compareSortKey(s.keys[0], run[0].values[0], n.values[0]) != 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		run = append(run, n)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
@@ -0,0 +1,375 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/document/encoding"
+)
+
+// A Subquery is a SELECT statement used as an expression. It evaluates to the value
+// of the only field of the document returned by the statement, or to NULL
+// if the statement doesn't return any document.
+// As the right-hand operand of IN, it evaluates to the list of the values returned by the statement.
+// The statement can refer to the fields of the document of the enclosing statement, by qualifying them
+// with the name or the alias of one of its tables.
+type Subquery struct {
+	Stmt SelectStmt
+
+	// outer is set if the statement refers to the enclosing statement,
+	// otherwise cache stores its result once evaluated.
+	outer *outerScope
+	cache *subqueryCache
+}
+
+// outerScope describes the documents of the enclosing statement of a subquery.
+type outerScope struct {
+	names []string
+	// joined is true if the documents contain one field per table.
+	joined bool
+}
+
+type subqueryCache struct {
+	done bool
+	v    document.Value
+}
+
+// Eval runs the statement and returns the value it returns.
+// It returns an error if the statement returns more than one document.
+func (s Subquery) Eval(stack EvalStack) (document.Value, error) {
+	return s.evalOnce(stack, func() (document.Value, error) {
+		v := nilLitteral
+		var found bool
+
+		err := s.run(stack, func(d document.Document) error {
+			if found {
+				return errors.New("subquery returned more than one document")
+			}
+			found = true
+
+			var err error
+			v, err = subqueryValue(d)
+			return err
+		})
+
+		return v, err
+	})
+}
+
+// evalList runs the statement and returns the list of values it returns.
+func (s Subquery) evalList(stack EvalStack) (document.Value, error) {
+	return s.evalOnce(stack, func() (document.Value, error) {
+		var vb document.ValueBuffer
+
+		err := s.run(stack, func(d document.Document) error {
+			v, err := subqueryValue(d)
+			if err != nil {
+				return err
+			}
+
+			vb = vb.Append(v)
+			return nil
+		})
+
+		return document.NewArrayValue(vb), err
+	})
+}
+
+// String returns the statement enclosed in parentheses. It implements the fmt.Stringer interface.
+func (s Subquery) String() string {
+	return "(" + s.Stmt.String() + ")"
+}
+
+// evalOnce calls eval, or returns the result of the first call to eval
+// if the subquery doesn't depend on the enclosing statement.
+func (s Subquery) evalOnce(stack EvalStack, eval func() (document.Value, error)) (document.Value, error) {
+	if s.cache != nil && s.cache.done {
+		return s.cache.v, nil
+	}
+
+	v, err := eval()
+	if err != nil {
+		return nilLitteral, err
+	}
+
+	if s.cache != nil {
+		s.cache.done = true
+		s.cache.v = v
+	}
+
+	return v, nil
+}
+
+// run runs the statement in the transaction of the stack and calls fn for each document.
+// The fields of the enclosing statement are replaced by their value in the document of the stack.
+func (s Subquery) run(stack EvalStack, fn func(d document.Document) error) error {
+	stmt := s.Stmt
+
+	if s.outer != nil {
+		var err error
+		stmt = replaceOuterFields(stmt, s.outer.names, func(fs FieldSelector) Expr {
+			// without joins, the documents of the enclosing statement are not qualified
+			if !s.outer.joined {
+				fs = fs[1:]
+			}
+
+			v, ferr := fs.Eval(stack)
+			if ferr == document.ErrFieldNotFound {
+				return LiteralValue(nilLitteral)
+			}
+			if ferr != nil && err == nil {
+				err = ferr
+			}
+
+			return LiteralValue(v)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := stmt.exec(stack.Tx, stack.Params)
+	if err != nil {
+		return err
+	}
+
+	err = res.Iterate(fn)
+	if err != nil && err != errStop {
+		return err
+	}
+
+	return nil
+}
+
+// subqueryValue returns a copy of the value of the only field of d.
+// Documents returned by the statement are only valid during the iteration.
+func subqueryValue(d document.Document) (document.Value, error) {
+	var v document.Value
+	var n int
+
+	err := d.Iterate(func(f string, fv document.Value) error {
+		n++
+		v = fv
+		return nil
+	})
+	if err != nil {
+		return v, err
+	}
+
+	if n != 1 {
+		return v, fmt.Errorf("subquery must return exactly one field, got %d", n)
+	}
+
+	if v.Type == document.NullValue {
+		return v, nil
+	}
+
+	data, err := encoding.EncodeValue(v)
+	if err != nil {
+		return v, err
+	}
+
+	return encoding.DecodeValue(v.Type, data)
+}
+
+// ExistsOp is the EXISTS operator. It returns true if its subquery returns at least one document.
+type ExistsOp struct {
+	Subquery Subquery
+}
+
+// Exists creates an expression that returns true if the subquery s returns at least one document.
+func Exists(s Subquery) ExistsOp {
+	return ExistsOp{Subquery: s}
+}
+
+// Eval runs the subquery until it returns a document.
+func (op ExistsOp) Eval(stack EvalStack) (document.Value, error) {
+	return op.Subquery.evalOnce(stack, func() (document.Value, error) {
+		var found bool
+
+		err := op.Subquery.run(stack, func(d document.Document) error {
+			found = true
+			return errStop
+		})
+
+		return document.NewBoolValue(found), err
+	})
+}
+
+// String returns the subquery prefixed with EXISTS. It implements the fmt.Stringer interface.
+func (op ExistsOp) String() string {
+	return "EXISTS " + op.Subquery.String()
+}
+
+// evalInOperand evaluates the right-hand operand of the IN operator.
+// Subqueries evaluate to the list of the values they return.
+func evalInOperand(e Expr, stack EvalStack) (document.Value, error) {
+	if s, ok := e.(Subquery); ok {
+		return s.evalList(stack)
+	}
+
+	return e.Eval(stack)
+}
+
+// bindSubqueries returns a function to use with transformExpr that prepares the subqueries of a statement
+// whose tables are called names, before running it: subqueries that refer to these tables will
+// replace the fields of the tables by their value for each document, and the others will only run once.
+func bindSubqueries(names []string, joined bool) func(e Expr) (Expr, bool) {
+	return func(e Expr) (Expr, bool) {
+		s, ok := e.(Subquery)
+		if !ok {
+			return e, false
+		}
+
+		var correlated bool
+		replaceOuterFields(s.Stmt, names, func(fs FieldSelector) Expr {
+			correlated = true
+			return fs
+		})
+
+		if correlated {
+			s.outer = &outerScope{names: names, joined: joined}
+		} else {
+			s.cache = new(subqueryCache)
+		}
+
+		return s, true
+	}
+}
+
+// replaceOuterFields returns a copy of stmt where the fields qualified by one of the names,
+// including the ones of its own subqueries, are replaced by the result of fn.
+// Within a statement, a name that is also the name of one of its tables refers to that table.
+func replaceOuterFields(stmt SelectStmt, names []string, fn func(fs FieldSelector) Expr) SelectStmt {
+	tables := stmt.tableNames()
+
+	var visible []string
+	for _, name := range names {
+		if !containsString(tables, name) {
+			visible = append(visible, name)
+		}
+	}
+
+	if len(visible) == 0 {
+		return stmt
+	}
+
+	return stmt.transform(func(e Expr) (Expr, bool) {
+		switch t := e.(type) {
+		case FieldSelector:
+			if len(t) > 1 && containsString(visible, t[0]) {
+				return fn(t), true
+			}
+		case Subquery:
+			t.Stmt = replaceOuterFields(t.Stmt, visible, fn)
+			return t, true
+		}
+
+		return e, false
+	})
+}
+
+func containsString(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// transformExpr calls fn on e and, unless fn replaces it, on each of its operands recursively.
+// fn returns the expression to use instead of e and true, or e and false to keep it.
+// It returns a copy of e with the replaced expressions and true if at least one expression was replaced,
+// otherwise it returns e and false.
+func transformExpr(e Expr, fn func(e Expr) (Expr, bool)) (Expr, bool) {
+	if e == nil {
+		return nil, false
+	}
+
+	if r, ok := fn(e); ok {
+		return r, true
+	}
+
+	switch t := e.(type) {
+	case CmpOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return CmpOp{op}, true
+		}
+	case *RegexOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &RegexOp{op}, true
+		}
+	case *InOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &InOp{op}, true
+		}
+	case *AndOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &AndOp{op}, true
+		}
+	case *OrOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &OrOp{op}, true
+		}
+	case *NotOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &NotOp{op}, true
+		}
+	case *IsOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &IsOp{op}, true
+		}
+	case *ArithmeticOp:
+		if op, ok := t.simpleOperator.transform(fn); ok {
+			return &ArithmeticOp{op}, true
+		}
+	case LiteralExprList:
+		var changed bool
+		l := make(LiteralExprList, len(t))
+		for i, e := range t {
+			var ok bool
+			l[i], ok = transformExpr(e, fn)
+			changed = changed || ok
+		}
+		if changed {
+			return l, true
+		}
+	case KVPairs:
+		var changed bool
+		kvp := make(KVPairs, len(t))
+		for i, kv := range t {
+			var ok bool
+			kvp[i].K = kv.K
+			kvp[i].V, ok = transformExpr(kv.V, fn)
+			changed = changed || ok
+		}
+		if changed {
+			return kvp, true
+		}
+	case CastFunc:
+		if x, ok := transformExpr(t.Expr, fn); ok {
+			t.Expr = x
+			return t, true
+		}
+	case ExistsOp:
+		if x, ok := transformExpr(t.Subquery, fn); ok {
+			if s, ok := x.(Subquery); ok {
+				t.Subquery = s
+				return t, true
+			}
+		}
+	}
+
+	return e, false
+}
+
+func (op simpleOperator) transform(fn func(e Expr) (Expr, bool)) (simpleOperator, bool) {
+	a, okA := transformExpr(op.a, fn)
+	b, okB := transformExpr(op.b, fn)
+	op.a, op.b = a, b
+
+	return op, okA || okB
+}
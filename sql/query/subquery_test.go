@@ -0,0 +1,121 @@
+package query_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asdine/genji"
+	"github.com/asdine/genji/document"
+	"github.com/asdine/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubquery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		fails    bool
+		expected string
+		params   []interface{}
+	}{
+		{"IN", "SELECT id FROM users WHERE id IN (SELECT user_id FROM banned)", false, `[{"id":2},{"id":3}]`, nil},
+		{"NOT IN", "SELECT id FROM users WHERE id NOT IN (SELECT user_id FROM banned)", false, `[{"id":1},{"id":4}]`, nil},
+		{"IN with where", "SELECT id FROM users WHERE id IN (SELECT user_id FROM banned WHERE reason = ?)", false, `[{"id":3}]`, []interface{}{"spam"}},
+		{"IN on indexed field", "SELECT id FROM users WHERE country IN (SELECT code FROM countries)", false, `[{"id":1},{"id":3}]`, nil},
+		{"IN with empty result", "SELECT id FROM users WHERE id IN (SELECT user_id FROM banned WHERE reason = 'none')", false, `[]`, nil},
+		{"IN with several fields", "SELECT id FROM users WHERE id IN (SELECT * FROM banned)", true, ``, nil},
+		{"EXISTS", "SELECT id FROM users WHERE EXISTS (SELECT * FROM orders WHERE user_id = users.id)", false, `[{"id":1},{"id":2}]`, nil},
+		{"NOT EXISTS", "SELECT id FROM users WHERE NOT EXISTS (SELECT * FROM orders WHERE user_id = users.id)", false, `[{"id":3},{"id":4}]`, nil},
+		{"EXISTS with alias", "SELECT id FROM users AS u WHERE EXISTS (SELECT * FROM orders WHERE user_id = u.id AND amount < 15)", false, `[{"id":1}]`, nil},
+		{"EXISTS with qualified fields", "SELECT id FROM users WHERE EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id)", false, `[{"id":1},{"id":2}]`, nil},
+		{"EXISTS with qualified fields and aliases", "SELECT id FROM users AS u WHERE EXISTS (SELECT * FROM orders AS o WHERE o.user_id = u.id AND o.amount < 15)", false, `[{"id":1}]`, nil},
+		{"Uncorrelated EXISTS", "SELECT id FROM users WHERE EXISTS (SELECT * FROM banned WHERE reason = 'spam')", false, `[{"id":1},{"id":2},{"id":3},{"id":4}]`, nil},
+		{"Scalar subquery", "SELECT id FROM users WHERE id = (SELECT MAX(user_id) FROM orders)", false, `[{"id":2}]`, nil},
+		{"Scalar subquery in projection", "SELECT id, (SELECT COUNT(*) FROM orders WHERE user_id = users.id) AS orders FROM users", false, `[{"id":1,"orders":2},{"id":2,"orders":1},{"id":3,"orders":0},{"id":4,"orders":0}]`, nil},
+		{"Scalar subquery without alias", "SELECT (SELECT MAX(amount) FROM orders) FROM users WHERE id = 1", false, `[{"(SELECT MAX(amount) FROM orders)":30}]`, nil},
+		{"Scalar subquery without result", "SELECT id, (SELECT amount FROM orders WHERE user_id = users.id) AS amount FROM users WHERE id > 1", false, `[{"id":2,"amount":30},{"id":3,"amount":null},{"id":4,"amount":null}]`, nil},
+		{"Scalar subquery with several results", "SELECT id, (SELECT amount FROM orders WHERE user_id = users.id) AS amount FROM users", true, ``, nil},
+		{"Nested subqueries", "SELECT id FROM users WHERE id IN (SELECT user_id FROM orders WHERE EXISTS (SELECT * FROM banned WHERE user_id = orders.user_id AND reason = 'late'))", false, `[{"id":2}]`, nil},
+		{"Nested subqueries referring to the outermost table", "SELECT id FROM users WHERE EXISTS (SELECT * FROM orders WHERE EXISTS (SELECT * FROM banned WHERE user_id = users.id AND orders.user_id = users.id))", false, `[{"id":2}]`, nil},
+		{"Subquery on the same table", "SELECT id FROM users WHERE id > (SELECT MIN(id) FROM users) AND EXISTS (SELECT * FROM users AS u WHERE id = users.id + 1)", false, `[{"id":2},{"id":3}]`, nil},
+		{"Subquery with join", "SELECT u.id FROM users u JOIN orders o ON o.user_id = u.id WHERE o.amount = (SELECT MAX(amount) FROM orders WHERE user_id = u.id)", false, `[{"u.id":1},{"u.id":2}]`, nil},
+	}
+
+	for _, test := range tests {
+		testFn := func(withIndexes bool) func(t *testing.T) {
+			return func(t *testing.T) {
+				db, err := genji.New(memoryengine.NewEngine())
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(`
+					CREATE TABLE users (id INTEGER PRIMARY KEY);
+					CREATE TABLE orders;
+					CREATE TABLE banned;
+					CREATE TABLE countries;
+				`)
+				require.NoError(t, err)
+				if withIndexes {
+					err = db.Exec(`
+						CREATE INDEX idx_users_country ON users (country);
+						CREATE INDEX idx_orders_user_id ON orders (user_id);
+					`)
+					require.NoError(t, err)
+				}
+
+				err = db.Exec(`
+					INSERT INTO users VALUES {id: 1, country: 'FR'}, {id: 2, country: 'ES'}, {id: 3, country: 'IT'}, {id: 4};
+					INSERT INTO orders VALUES {user_id: 1, amount: 10}, {user_id: 1, amount: 20}, {user_id: 2, amount: 30};
+					INSERT INTO banned VALUES {user_id: 2, reason: 'late'}, {user_id: 3, reason: 'spam'};
+					INSERT INTO countries VALUES {code: 'FR'}, {code: 'IT'};
+				`)
+				require.NoError(t, err)
+
+				st, err := db.Query(test.query, test.params...)
+				if test.fails {
+					if err == nil {
+						var buf bytes.Buffer
+						err = document.IteratorToJSONArray(&buf, st)
+						st.Close()
+					}
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			}
+		}
+		t.Run("No Index/"+test.name, testFn(false))
+		t.Run("With Index/"+test.name, testFn(true))
+	}
+
+	t.Run("in update and delete", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE users;
+			CREATE TABLE orders;
+			INSERT INTO users VALUES {id: 1, total: 0}, {id: 2, total: 0}, {id: 3, total: 0};
+			INSERT INTO orders VALUES {user_id: 1, amount: 10}, {user_id: 1, amount: 20}, {user_id: 2, amount: 30};
+			UPDATE users SET total = (SELECT SUM(amount) FROM orders WHERE user_id = users.id) WHERE EXISTS (SELECT * FROM orders WHERE user_id = users.id);
+			DELETE FROM users WHERE id NOT IN (SELECT user_id FROM orders);
+		`)
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT id, total FROM users")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"id":1,"total":30},{"id":2,"total":30}]`, buf.String())
+	})
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"errors"
 
@@ -9,7 +10,7 @@ import (
 	"github.com/asdine/genji/engine"
 )
 
-// updateBufferSize is the size of the buffer used to update documents.
+// updateBufferSize is the number of documents updated per batch when the table is scanned.
 const updateBufferSize = 100
 
 // UpdateStmt is a DSL that allows creating a full Update query.
@@ -24,100 +25,169 @@ func (stmt UpdateStmt) IsReadOnly() bool {
 	return false
 }
 
-// Run runs the Update table statement in the given transaction.
-// It implements the Statement interface.
-func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
-	var res Result
+// explain returns a document describing how the statement reads the table,
+// without running it. It implements the explainer interface.
+func (stmt UpdateStmt) explain(tx *database.Transaction, args []driver.NamedValue) (document.Document, error) {
+	qo, _, err := stmt.prepare(tx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return qo.explain()
+}
 
+// prepare returns the query optimizer used to select the documents to update,
+// and the expressions of the SET clause.
+func (stmt UpdateStmt) prepare(tx *database.Transaction, args []driver.NamedValue) (queryOptimizer, map[string]Expr, error) {
 	if stmt.TableName == "" {
-		return res, errors.New("missing table name")
+		return queryOptimizer{}, nil, errors.New("missing table name")
 	}
 
 	if len(stmt.Pairs) == 0 {
-		return res, errors.New("Set method not called")
+		return queryOptimizer{}, nil, errors.New("Set method not called")
 	}
 
-	stack := EvalStack{
-		Tx:     tx,
-		Params: args,
+	qo, err := newQueryOptimizer(tx, stmt.TableName)
+	if err != nil {
+		return qo, nil, err
 	}
 
-	t, err := tx.GetTable(stmt.TableName)
+	bind := bindSubqueries([]string{stmt.TableName}, false)
+	qo.whereExpr, _ = transformExpr(stmt.WhereExpr, bind)
+	qo.args = args
+
+	pairs := make(map[string]Expr, len(stmt.Pairs))
+	for fname, e := range stmt.Pairs {
+		pairs[fname], _ = transformExpr(e, bind)
+	}
+
+	return qo, pairs, nil
+}
+
+// Run updates the matching documents.
+// The documents are selected using the primary key or an index if the WHERE clause allows it.
+// Some engines can't modify a store while iterating on it, and updating an indexed field moves the
+// document within the index, where it could be read again: the keys of the selected documents are
+// read before updating them.
+// When the table is scanned and the primary key isn't modified, the documents are read in the order
+// of their keys, by batches of updateBufferSize documents, and each batch resumes the scan after
+// the last updated key.
+// Otherwise, the keys of all the selected documents are read in a single pass.
+// It implements the Statement interface.
+func (stmt UpdateStmt) Run(tx *database.Transaction, args []driver.NamedValue) (Result, error) {
+	var res Result
+
+	qo, pairs, err := stmt.prepare(tx, args)
 	if err != nil {
 		return res, err
 	}
 
 	// replace store implementation by a resumable store, temporarily.
-	resumableStore := storeFromKey{Store: t.Store}
-	t.Store = &resumableStore
-
-	st := document.NewStream(t)
-	st = st.Filter(whereClause(stmt.WhereExpr, stack)).Limit(updateBufferSize)
+	// documents whose primary key is modified are moved to another key,
+	// where a resumed scan could read them again.
+	var resumableStore *storeFromKey
+	if qo.buildQueryPlan().scanTable && !stmt.modifiesPrimaryKey(qo.cfg) {
+		resumableStore = &storeFromKey{Store: qo.t.Store}
+		qo.t.Store = resumableStore
+	}
 
-	keys := make([][]byte, updateBufferSize)
-	docs := make([]document.FieldBuffer, updateBufferSize)
+	st, err := qo.optimizeQuery()
+	if err != nil {
+		return res, err
+	}
+	if resumableStore != nil {
+		st = st.Limit(updateBufferSize)
+	}
 
+	var fb document.FieldBuffer
 	for {
-		var i int
-
+		var keys [][]byte
 		err = st.Iterate(func(d document.Document) error {
-			rk, ok := d.(document.Keyer)
+			k, ok := d.(document.Keyer)
 			if !ok {
 				return errors.New("attempt to update document without key")
 			}
 
-			docs[i].Reset()
-			err := docs[i].ScanDocument(d)
-			if err != nil {
-				return err
-			}
-
-			for fname, e := range stmt.Pairs {
-				_, err := docs[i].GetByField(fname)
-				if err != nil {
-					continue
-				}
-
-				ev, err := e.Eval(EvalStack{
-					Tx:       tx,
-					Document: d,
-					Params:   args,
-				})
-				if err != nil && err != document.ErrFieldNotFound {
-					return err
-				}
-
-				err = docs[i].Replace(fname, ev)
-				if err != nil {
-					return err
-				}
-			}
-
-			// copy the key and reuse the buffer
-			keys[i] = append(keys[i][0:0], rk.Key()...)
-			i++
-
+			// the key is copied to a new buffer because engines may keep
+			// a reference to the keys of the documents that are replaced
+			keys = append(keys, append([]byte(nil), k.Key()...))
 			return nil
 		})
+		if err != nil {
+			return res, err
+		}
 
-		for j := 0; j < i; j++ {
-			err = t.Replace(keys[j], docs[j])
+		for _, key := range keys {
+			err = stmt.updateDocument(tx, args, qo.t, pairs, &fb, key)
 			if err != nil {
 				return res, err
 			}
 		}
 
-		if i < deleteBufferSize {
+		if resumableStore == nil || len(keys) < updateBufferSize {
 			break
 		}
 
-		resumableStore.key = keys[i-1]
+		resumableStore.key = keys[len(keys)-1]
 	}
 
-	return res, err
+	return res, nil
 }
 
-// storeFromKey implements an engine.Store which iterates from a certain key.
+// modifiesPrimaryKey returns true if the SET clause modifies a field of the primary key of cfg.
+func (stmt UpdateStmt) modifiesPrimaryKey(cfg *database.TableConfig) bool {
+	paths := cfg.PrimaryKeyPaths
+	if len(cfg.PrimaryKey.Path) != 0 {
+		paths = []document.ValuePath{cfg.PrimaryKey.Path}
+	}
+
+	for _, p := range paths {
+		if _, ok := stmt.Pairs[p[0]]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateDocument applies the SET clause to the document stored under the given key.
+func (stmt UpdateStmt) updateDocument(tx *database.Transaction, args []driver.NamedValue, t *database.Table, pairs map[string]Expr, fb *document.FieldBuffer, key []byte) error {
+	d, err := t.GetDocument(key)
+	if err != nil {
+		return err
+	}
+
+	fb.Reset()
+	err = fb.ScanDocument(d)
+	if err != nil {
+		return err
+	}
+
+	for fname, e := range pairs {
+		_, err := fb.GetByField(fname)
+		if err != nil {
+			continue
+		}
+
+		ev, err := e.Eval(EvalStack{
+			Tx:       tx,
+			Document: d,
+			Params:   args,
+		})
+		if err != nil && err != document.ErrFieldNotFound {
+			return err
+		}
+
+		err = fb.Replace(fname, ev)
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.Replace(key, fb)
+}
+
+// storeFromKey implements an engine.Store which iterates from after a certain key.
 // it is used to resume iteration.
 type storeFromKey struct {
 	engine.Store
@@ -125,11 +195,17 @@ type storeFromKey struct {
 	key []byte
 }
 
-// AscendGreaterOrEqual uses key as pivot if pivot is nil
+// AscendGreaterOrEqual skips the keys up to key, included, if pivot is nil.
 func (s *storeFromKey) AscendGreaterOrEqual(pivot []byte, fn func(k, v []byte) error) error {
-	if len(pivot) == 0 {
-		pivot = s.key
+	if len(pivot) != 0 || len(s.key) == 0 {
+		return s.Store.AscendGreaterOrEqual(pivot, fn)
 	}
 
-	return s.Store.AscendGreaterOrEqual(pivot, fn)
+	return s.Store.AscendGreaterOrEqual(s.key, func(k, v []byte) error {
+		if bytes.Equal(k, s.key) {
+			return nil
+		}
+
+		return fn(k, v)
+	})
 }
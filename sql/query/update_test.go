@@ -3,6 +3,7 @@ package query_test
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
 	"testing"
 
 	"github.com/asdine/genji"
@@ -26,6 +27,10 @@ func TestUpdateStmt(t *testing.T) {
 		{"With cond", "UPDATE test SET a = 1, b = 2 WHERE a = 'foo2'", false, `[{"a":"foo1","b":"bar1","c":"baz1"},{"a":1,"b":2},{"d":"foo3","e":"bar3"}]`, nil},
 		{"Field not found", "UPDATE test SET a = 1, b = 2 WHERE a = f", false, `[{"a":"foo1","b":"bar1","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
 		{"Positional params", "UPDATE test SET a = ?, b = ? WHERE a = ?", false, `[{"a":"a","b":"b","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, []interface{}{"a", "b", "foo1"}},
+		{"With arithmetic operators", "UPDATE test SET a = 10 * 2 + 1 WHERE a = 'foo1'", false, `[{"a":21,"b":"bar1","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"With arithmetic operators on non-numeric values", "UPDATE test SET a = a + 1", true, "", nil},
+		{"With casts", "UPDATE test SET a = '10'::INT64, b = CAST(1.5 AS TEXT) WHERE a = 'foo1'", false, `[{"a":10,"b":"1.5","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, nil},
+		{"With invalid cast", "UPDATE test SET a = a::INT64", true, "", nil},
 		{"Named params", "UPDATE test SET a = $a, b = $b WHERE a = $c", false, `[{"a":"a","b":"b","c":"baz1"},{"a":"foo2","b":"bar2"},{"d":"foo3","e":"bar3"}]`, []interface{}{sql.Named("b", "b"), sql.Named("a", "a"), sql.Named("c", "foo1")}},
 	}
 
@@ -62,4 +67,128 @@ func TestUpdateStmt(t *testing.T) {
 			require.JSONEq(t, test.expected, buf.String())
 		})
 	}
+
+	t.Run("with indexes", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY);
+			CREATE INDEX idx_test_a ON test (a);
+			INSERT INTO test VALUES {id: 1, a: 0}, {id: 2, a: 1}, {id: 3, a: 2}, {id: 4, a: 3};
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query    string
+			access   string
+			expected string
+		}{
+			{"UPDATE test SET a = 10 WHERE a = 1", "index iterator", `[{"id":1,"a":0},{"id":2,"a":10},{"id":3,"a":2},{"id":4,"a":3}]`},
+			{"UPDATE test SET a = 20 WHERE id = 2", "pk iterator", `[{"id":1,"a":0},{"id":2,"a":20},{"id":3,"a":2},{"id":4,"a":3}]`},
+			// every document is updated once, even if it moves forward within the index
+			{"UPDATE test SET a = a + 1 WHERE a >= 1", "index iterator", `[{"id":1,"a":0},{"id":2,"a":2},{"id":3,"a":3},{"id":4,"a":4}]`},
+			{"UPDATE test SET a = a + 1 WHERE id > 1", "pk iterator", `[{"id":1,"a":0},{"id":2,"a":2},{"id":3,"a":3},{"id":4,"a":4}]`},
+			{"UPDATE test SET a = 0 WHERE a = 1 OR id = 4", "union", `[{"id":1,"a":0},{"id":2,"a":0},{"id":3,"a":2},{"id":4,"a":0}]`},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				// changes are rolled back after each test
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				d, err := tx.QueryDocument("EXPLAIN " + test.query)
+				require.NoError(t, err)
+				v, err := document.ValuePath{"access", "type"}.GetValue(d)
+				require.NoError(t, err)
+				require.Equal(t, document.NewStringValue(test.access), v)
+
+				err = tx.Exec(test.query)
+				require.NoError(t, err)
+
+				st, err := tx.Query("SELECT * FROM test")
+				require.NoError(t, err)
+				defer st.Close()
+
+				var buf bytes.Buffer
+				err = document.IteratorToJSONArray(&buf, st)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expected, buf.String())
+			})
+		}
+	})
+
+	t.Run("with more documents than a batch", func(t *testing.T) {
+		db, err := genji.New(memoryengine.NewEngine())
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (id INTEGER PRIMARY KEY);
+			CREATE INDEX idx_test_a ON test (a);
+		`)
+		require.NoError(t, err)
+
+		// the documents are read in the reverse order of their keys from the index
+		for i := 1; i <= 250; i++ {
+			err = db.Exec("INSERT INTO test VALUES {id: ?, a: ?}", i, 1000-i)
+			require.NoError(t, err)
+		}
+
+		// every document moves forward within the index and is updated once
+		err = db.Exec("UPDATE test SET a = a + 1000 WHERE a > 0")
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*), MIN(a), MAX(a) FROM test")
+		require.NoError(t, err)
+		var count, min, max int
+		err = document.Scan(d, &count, &min, &max)
+		require.NoError(t, err)
+		require.Equal(t, 250, count)
+		require.Equal(t, 1750, min)
+		require.Equal(t, 1999, max)
+
+		// the table is scanned by batches, each one starting after the last updated document
+		err = db.Exec("UPDATE test SET a = a + 1000")
+		require.NoError(t, err)
+		err = db.Exec("UPDATE test SET a = 0 WHERE id % 2 = 0")
+		require.NoError(t, err)
+
+		d, err = db.QueryDocument("SELECT COUNT(*), MIN(a), MAX(a) FROM test WHERE a > 0")
+		require.NoError(t, err)
+		err = document.Scan(d, &count, &min, &max)
+		require.NoError(t, err)
+		require.Equal(t, 125, count)
+		require.Equal(t, 2751, min)
+		require.Equal(t, 2999, max)
+	})
+}
+
+// BenchmarkUpdateStmt benchmarks updating every document of tables of 1, 10, 1000 and 10000 documents.
+func BenchmarkUpdateStmt(b *testing.B) {
+	for size := 1; size <= 10000; size *= 10 {
+		b.Run(fmt.Sprintf("%.05d", size), func(b *testing.B) {
+			db, err := genji.New(memoryengine.NewEngine())
+			require.NoError(b, err)
+			defer db.Close()
+
+			err = db.Exec("CREATE TABLE test")
+			require.NoError(b, err)
+
+			for i := 0; i < size; i++ {
+				err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, i)
+				require.NoError(b, err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = db.Exec("UPDATE test SET a = ?", i)
+				require.NoError(b, err)
+			}
+			b.StopTimer()
+		})
+	}
 }
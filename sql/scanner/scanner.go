@@ -263,9 +263,14 @@ func (s *Scanner) scanString() (tok Token, pos Pos, lit string) {
 	return STRING, pos, lit
 }
 
-// ScanRegex consumes a token to find escapes
+// ScanRegex consumes a token to find escapes.
+// Leading whitespaces are ignored.
 func (s *Scanner) ScanRegex() (tok Token, pos Pos, lit string) {
-	_, pos = s.r.curr()
+	ch, pos := s.r.read()
+	for isWhitespace(ch) {
+		ch, pos = s.r.read()
+	}
+	s.r.unread()
 
 	// Start & end sentinels.
 	start, end := '/', '/'
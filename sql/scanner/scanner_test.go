@@ -41,6 +41,10 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `and`, tok: scanner.AND},
 		{s: `OR`, tok: scanner.OR},
 		{s: `or`, tok: scanner.OR},
+		{s: `IN`, tok: scanner.IN},
+		{s: `in`, tok: scanner.IN},
+		{s: `IS`, tok: scanner.IS},
+		{s: `is`, tok: scanner.IS},
 
 		{s: `=`, tok: scanner.EQ},
 		{s: `==`, tok: scanner.EQ},
@@ -130,9 +134,18 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `BY`, tok: scanner.BY},
 		{s: `DELETE`, tok: scanner.DELETE},
 		{s: `DESC`, tok: scanner.DESC},
+		{s: `DISTINCT`, tok: scanner.DISTINCT},
+		{s: `INNER`, tok: scanner.INNER},
+		{s: `JOIN`, tok: scanner.JOIN},
+		{s: `LEFT`, tok: scanner.LEFT},
+		{s: `OUTER`, tok: scanner.OUTER},
+		{s: `REINDEX`, tok: scanner.REINDEX},
 		{s: `DROP`, tok: scanner.DROP},
 		{s: `DURATION`, tok: scanner.DURATION},
+		{s: `EXPLAIN`, tok: scanner.EXPLAIN},
 		{s: `FROM`, tok: scanner.FROM},
+		{s: `GROUP`, tok: scanner.GROUP},
+		{s: `HAVING`, tok: scanner.HAVING},
 		{s: `INSERT`, tok: scanner.INSERT},
 		{s: `INTO`, tok: scanner.INTO},
 		{s: `LIMIT`, tok: scanner.LIMIT},
@@ -281,6 +294,9 @@ func TestScanRegex(t *testing.T) {
 		{in: `/foo\\/bar/`, tok: scanner.REGEX, lit: `foo\/bar`},
 		{in: `/foo\\bar/`, tok: scanner.REGEX, lit: `foo\\bar`},
 		{in: `/http\:\/\/www\.example\.com/`, tok: scanner.REGEX, lit: `http\://www\.example\.com`},
+		{in: `  /foo/`, tok: scanner.REGEX, lit: `foo`},
+		{in: `/foo`, tok: scanner.BADREGEX},
+		{in: `foo/`, tok: scanner.BADREGEX},
 	}
 
 	for i, tt := range tests {
@@ -55,6 +55,10 @@ const (
 	LTE      // <=
 	GT       // >
 	GTE      // >=
+	IN       // IN
+	NIN      // NOT IN
+	IS       // IS
+	ISN      // IS NOT
 	operatorEnd
 
 	LPAREN      // (
@@ -79,23 +83,31 @@ const (
 	CREATE
 	DELETE
 	DESC
+	DISTINCT
 	DROP
 	DURATION
 	EXISTS
+	EXPLAIN
 	FROM
+	GROUP
+	HAVING
 	IF
-	IN
 	INDEX
 	INF
+	INNER
 	INSERT
 	INTO
+	JOIN
 	KEY
+	LEFT
 	LIMIT
 	NOT
 	OFFSET
 	ON
 	ORDER
+	OUTER
 	PRIMARY
+	REINDEX
 	SELECT
 	SET
 	TABLE
@@ -163,6 +175,10 @@ var tokens = [...]string{
 	LTE:      "<=",
 	GT:       ">",
 	GTE:      ">=",
+	IN:       "IN",
+	NIN:      "NOT IN",
+	IS:       "IS",
+	ISN:      "IS NOT",
 
 	LPAREN:      "(",
 	RPAREN:      ")",
@@ -184,22 +200,30 @@ var tokens = [...]string{
 	CREATE:   "CREATE",
 	DELETE:   "DELETE",
 	DESC:     "DESC",
+	DISTINCT: "DISTINCT",
 	DROP:     "DROP",
 	DURATION: "DURATION",
 	EXISTS:   "EXISTS",
+	EXPLAIN:  "EXPLAIN",
 	KEY:      "KEY",
 	FROM:     "FROM",
+	GROUP:    "GROUP",
+	HAVING:   "HAVING",
 	IF:       "IF",
-	IN:       "IN",
 	INDEX:    "INDEX",
+	INNER:    "INNER",
 	INSERT:   "INSERT",
 	INTO:     "INTO",
+	JOIN:     "JOIN",
+	LEFT:     "LEFT",
 	LIMIT:    "LIMIT",
 	NOT:      "NOT",
 	OFFSET:   "OFFSET",
 	ON:       "ON",
 	ORDER:    "ORDER",
+	OUTER:    "OUTER",
 	PRIMARY:  "PRIMARY",
+	REINDEX:  "REINDEX",
 	SELECT:   "SELECT",
 	SET:      "SET",
 	TABLE:    "TABLE",
@@ -236,7 +260,7 @@ func init() {
 	for tok := keywordBeg + 1; tok < keywordEnd; tok++ {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
-	for _, tok := range []Token{AND, OR, TRUE, FALSE, NULL} {
+	for _, tok := range []Token{AND, OR, TRUE, FALSE, NULL, IN, IS} {
 		keywords[strings.ToLower(tokens[tok])] = tok
 	}
 }
@@ -250,18 +274,22 @@ func (tok Token) String() string {
 }
 
 // Precedence returns the operator precedence of the binary operator token.
+// The unary NOT operator has a precedence lower than comparison operators,
+// i.e. NOT a = b is evaluated as NOT (a = b).
 func (tok Token) Precedence() int {
 	switch tok {
 	case OR:
 		return 1
 	case AND:
 		return 2
-	case EQ, NEQ, EQREGEX, NEQREGEX, LT, LTE, GT, GTE:
+	case NOT:
 		return 3
-	case ADD, SUB, BITWISEOR, BITWISEXOR:
+	case EQ, NEQ, EQREGEX, NEQREGEX, LT, LTE, GT, GTE, IN, NIN, IS, ISN:
 		return 4
-	case MUL, DIV, MOD, BITWISEAND:
+	case ADD, SUB, BITWISEOR, BITWISEXOR:
 		return 5
+	case MUL, DIV, MOD, BITWISEAND:
+		return 6
 	}
 	return 0
 }